@@ -0,0 +1,41 @@
+package main
+
+import (
+	"GO_player/internal/analysis"
+	"GO_player/internal/models"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func runAnalyze(args []string) error {
+	fs := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	var store storeFlags
+	store.register(fs)
+	force := fs.Bool("force", false, "measure every song again, even unchanged ones")
+	withFeatures := fs.Bool("features", true, "also extract the audio features used to start new songs off")
+	workers := fs.Int("workers", 0, "songs decoded at the same time (0 uses every CPU)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cat, db, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer db.Shutdown()
+
+	res, err := analysis.Library(cat, analysis.Options{
+		Force:    *force,
+		Features: *withFeatures,
+		Workers:  *workers,
+		OnError: func(song *models.Song, err error) {
+			fmt.Fprintf(os.Stderr, "song %d: %v\n", song.ID, err)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("analyzed %d, unchanged %d, failed %d, albums updated %d\n", res.Analyzed, res.Skipped, res.Failed, res.Albums)
+	return nil
+}
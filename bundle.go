@@ -0,0 +1,89 @@
+package main
+
+import (
+	"GO_player/internal/bundle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+)
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	var store storeFlags
+	store.register(fs)
+	out := fs.String("out", "", "bundle file to write, - for stdout")
+	format := fs.String("format", "json", "bundle format: json or tar")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return errors.New("-out is required")
+	}
+
+	cat, db, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer db.Shutdown()
+
+	b, err := bundle.Export(cat)
+	if err != nil {
+		return err
+	}
+	if *out == "-" {
+		return bundle.Write(os.Stdout, b, bundle.Format(*format))
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := bundle.Write(f, b, bundle.Format(*format)); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	var store storeFlags
+	store.register(fs)
+	mode := fs.String("mode", string(bundle.ModeMerge), "replace or merge")
+	dryRun := fs.Bool("dry-run", false, "print what would change without writing")
+	fs.Usage = func() {
+		fs.Output().Write([]byte("usage: GO_player import -db PATH [flags] BUNDLE\n"))
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected one bundle file")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := bundle.Read(f)
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+
+	cat, db, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer db.Shutdown()
+
+	report, err := bundle.Import(cat, b, bundle.Options{Mode: bundle.Mode(*mode), DryRun: *dryRun})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
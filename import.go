@@ -0,0 +1,65 @@
+package main
+
+import (
+	"GO_player/internal/importer"
+	"GO_player/internal/memory/feedback"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+)
+
+func runImportHistory(args []string) error {
+	fs := flag.NewFlagSet("import-history", flag.ContinueOnError)
+	var store storeFlags
+	store.register(fs)
+	format := fs.String("format", "", "export format: lastfm-csv, lastfm-json, listenbrainz or spotify")
+	minScore := fs.Float64("min-score", 0, "fuzzy match score a song needs, 0 to 1 (default 0.85)")
+	dryRun := fs.Bool("dry-run", false, "match and count without changing the graphs")
+	policy := fs.String("feedback", "thresholds", "how plays are learned from: thresholds or curve")
+	fs.Usage = func() {
+		fs.Output().Write([]byte("usage: GO_player import-history -db PATH -format FORMAT [flags] FILE...\n"))
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format == "" {
+		return errors.New("-format is required")
+	}
+	feedbackPolicy, err := feedback.ParsePolicy(*policy)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("no export files given")
+	}
+
+	var plays []importer.Play
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		p, err := importer.Parse(importer.Format(*format), f)
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+		plays = append(plays, p...)
+	}
+
+	cat, db, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer db.Shutdown()
+
+	res, err := importer.Import(cat, plays, importer.Options{MinScore: *minScore, Policy: feedbackPolicy, DryRun: *dryRun})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(res)
+}
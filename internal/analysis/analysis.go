@@ -0,0 +1,176 @@
+package analysis
+
+import (
+	"GO_player/internal/audio"
+	"GO_player/internal/catalog"
+	"GO_player/internal/features"
+	"GO_player/internal/loudness"
+	"GO_player/internal/models"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+type Options struct {
+	// Force analyzes every song again, even when its file did not change.
+	Force bool
+	// Features also extracts the features used to start new songs off.
+	Features bool
+	// Workers is how many songs are decoded at the same time.
+	Workers int
+	// OnError is called for every song that could not be analyzed.
+	OnError func(song *models.Song, err error)
+}
+
+type Result struct {
+	Analyzed int `json:"analyzed"`
+	Skipped  int `json:"skipped"`
+	Failed   int `json:"failed"`
+	Albums   int `json:"albums"`
+}
+
+// File decodes a file once, measuring its loudness and, with withFeatures
+// set, extracting its features. The features are nil otherwise.
+func File(path string, withFeatures bool) (*models.Loudness, *models.Features, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	dec, err := audio.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer dec.Close()
+
+	format := dec.Format()
+	meter := loudness.NewMeter(format)
+	var an *features.Analyzer
+	if withFeatures {
+		an = features.NewAnalyzer(format)
+	}
+	buf := make([]float32, 4096*format.Channels)
+	for {
+		n, err := dec.Read(buf)
+		meter.Write(buf[:n])
+		if an != nil {
+			an.Write(buf[:n])
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	l := meter.Measurement(info)
+	if an == nil {
+		return l, nil, nil
+	}
+	return l, an.Features(l), nil
+}
+
+// Library analyzes the songs whose file changed since their last analysis, or
+// that miss a measurement, and then measures again the albums they belong to.
+// Each song is saved as soon as it is done, so an interrupted run picks up
+// where it stopped.
+func Library(cat catalog.Catalog, opts Options) (*Result, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	songs, err := cat.ListSongs()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{}
+	var todo []*models.Song
+	for _, song := range songs {
+		if song.Path == "" {
+			continue
+		}
+		info, err := os.Stat(song.Path)
+		if err != nil {
+			res.Failed++
+			if opts.OnError != nil {
+				opts.OnError(song, err)
+			}
+			continue
+		}
+		stale := !loudness.Current(song, info) || (opts.Features && !features.Current(song, info))
+		if !opts.Force && !stale {
+			res.Skipped++
+			continue
+		}
+		todo = append(todo, song)
+	}
+
+	type analyzed struct {
+		song *models.Song
+		l    *models.Loudness
+		f    *models.Features
+		err  error
+	}
+	jobs := make(chan *models.Song)
+	results := make(chan analyzed)
+	var wg sync.WaitGroup
+	for range min(opts.Workers, max(1, len(todo))) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for song := range jobs {
+				l, f, err := File(song.Path, opts.Features)
+				results <- analyzed{song: song, l: l, f: f, err: err}
+			}
+		}()
+	}
+	go func() {
+		for _, song := range todo {
+			jobs <- song
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	changed := make(map[int64]bool)
+	var saveErr error
+	for r := range results {
+		if saveErr != nil {
+			continue
+		}
+		if r.err != nil {
+			res.Failed++
+			if opts.OnError != nil {
+				opts.OnError(r.song, r.err)
+			}
+			continue
+		}
+		r.song.Loudness = r.l
+		if r.f != nil {
+			r.song.Features = r.f
+		}
+		if r.song.Duration == 0 {
+			r.song.Duration = r.l.Duration
+		}
+		if err := cat.SaveSong(r.song.ID, r.song); err != nil {
+			saveErr = err
+			continue
+		}
+		res.Analyzed++
+		if r.song.AlbumID != 0 {
+			changed[r.song.AlbumID] = true
+		}
+	}
+	if saveErr != nil {
+		return nil, saveErr
+	}
+
+	if res.Albums, err = loudness.UpdateAlbums(cat, songs, changed, opts.Force); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -3,10 +3,13 @@ package app
 import (
 	"GO_player/internal/catalog"
 	"GO_player/internal/memory/basegraph"
+	"GO_player/internal/memory/feedback"
+	"GO_player/internal/memory/library"
 	"GO_player/internal/memory/runtime"
 	"GO_player/internal/memory/selector"
 	"GO_player/internal/models"
 	"GO_player/internal/orchestrator"
+	"GO_player/internal/playback"
 	"GO_player/internal/storage"
 	"context"
 	"errors"
@@ -15,9 +18,18 @@ import (
 )
 
 type App struct {
-	db                   *storage.DB
+	mu                   sync.RWMutex
+	db                   storage.Store
+	ownsDB               bool
 	catalog              catalog.Catalog
+	history              *historyRecorder
+	profile              string
 	albumID              int64
+	radio                *library.Library
+	albumWeight          float64
+	libraryRefresh       time.Duration
+	graphConfig          graphConfig
+	deviceID             string
 	orch                 *orchestrator.Orchestrator
 	baseGraphRebuildChan <-chan bool
 	ctx                  context.Context
@@ -25,58 +37,245 @@ type App struct {
 	wg                   *sync.WaitGroup
 }
 
+type Options struct {
+	Backend                storage.BackendKind
+	Path                   string
+	AlbumID                int64
+	Profile                string
+	Storage                storage.Options
+	Radio                  bool
+	LibraryAlbumWeight     float64
+	LibraryRefreshInterval time.Duration
+	// DeviceID names this device in memory sync. A random ID is used when
+	// the profile is synced for the first time without one.
+	DeviceID string
+	// ColdStartWeight scales the pseudo-edges that lead to songs with no
+	// incoming edge yet, from the songs that sound the most like them. 0 uses
+	// the default and a negative weight turns them off.
+	ColdStartWeight float64
+	// Explore makes the player occasionally pick songs that were rarely or
+	// never played. It is off unless a mode is set.
+	Explore selector.ExploreOptions
+	// Constraints keep the player from repeating songs, artists, albums
+	// and genres too soon. Album gaps are ignored in album mode.
+	Constraints selector.Constraints
+	// Feedback decides how plays and explicit signals change the graph. The
+	// default policy is used when it is nil.
+	Feedback feedback.Policy
+}
+
+// graphConfig is how an orchestrator is set up on top of its base graph.
+type graphConfig struct {
+	coldStartWeight float64
+	explore         selector.ExploreOptions
+	constraints     selector.Constraints
+	feedback        feedback.Policy
+}
+
 func NewApp(dpPath string, albumID int64) (*App, error) {
-	if dpPath == "" {
+	return NewAppWithOptions(Options{Path: dpPath, AlbumID: albumID})
+}
+
+func NewAppWithOptions(opts Options) (*App, error) {
+	if opts.Path == "" && opts.Backend != storage.BackendMemory {
 		return nil, errors.New("empty db path")
 	}
-	if albumID < 0 {
+
+	db, err := storage.Open(opts.Backend, opts.Path, opts.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	app, err := newApp(db, opts)
+	if err != nil {
+		_ = db.Shutdown()
+		return nil, err
+	}
+	app.ownsDB = true
+	return app, nil
+}
+
+// NewAppWithStore starts an App on a store that is shared with other Apps,
+// typically one per profile. The store is left open on Shutdown.
+func NewAppWithStore(db storage.Store, opts Options) (*App, error) {
+	if db == nil {
+		return nil, errors.New("nil store")
+	}
+	return newApp(db, opts)
+}
+
+func newApp(db storage.Store, opts Options) (*App, error) {
+	if opts.AlbumID < 0 {
 		return nil, errors.New("invalid album id")
 	}
+	albumID := opts.AlbumID
 
-	db, err := storage.NewDB(dpPath, "", 0)
+	cat, err := catalog.NewProfileCatalog(db, opts.Profile)
 	if err != nil {
 		return nil, err
 	}
+	if err := registerProfile(cat, opts.Profile); err != nil {
+		return nil, err
+	}
+
+	if opts.LibraryAlbumWeight <= 0 {
+		opts.LibraryAlbumWeight = defaultLibraryAlbumWeight
+	}
+	if opts.LibraryRefreshInterval <= 0 {
+		opts.LibraryRefreshInterval = defaultLibraryRefresh
+	}
+	if opts.ColdStartWeight == 0 {
+		opts.ColdStartWeight = defaultColdStartWeight
+	}
+	cfg := graphConfig{
+		coldStartWeight: opts.ColdStartWeight,
+		explore:         opts.Explore,
+		constraints:     opts.Constraints,
+		feedback:        opts.Feedback,
+	}
+
+	var lib *library.Library
+	var orch *orchestrator.Orchestrator
+	if opts.Radio {
+		lib = library.NewLibrary(opts.LibraryAlbumWeight)
+		orch, err = loadRadioOrchestrator(cat, lib, cfg)
+	} else {
+		orch, err = loadOrchestrator(cat, albumID, cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	bgChan := orch.GetBGRebuildChan()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+
+	app := &App{
+		db:                   db,
+		catalog:              cat,
+		history:              newHistoryRecorder(cat),
+		profile:              opts.Profile,
+		albumID:              albumID,
+		radio:                lib,
+		albumWeight:          opts.LibraryAlbumWeight,
+		libraryRefresh:       opts.LibraryRefreshInterval,
+		graphConfig:          cfg,
+		deviceID:             opts.DeviceID,
+		orch:                 orch,
+		baseGraphRebuildChan: bgChan,
+		ctx:                  ctx,
+		cancel:               cancel,
+		wg:                   wg,
+	}
+	app.start()
 
-	cat := catalog.NewCatalog(db)
+	return app, nil
+}
 
+// loadOrchestrator starts an orchestrator on an album's graph. Album 0 holds
+// the songs without an album.
+func loadOrchestrator(cat catalog.Catalog, albumID int64, cfg graphConfig) (*orchestrator.Orchestrator, error) {
 	edges, err := cat.LoadBaseGraphEdges(albumID)
 	if err != nil {
-		_ = db.Close()
 		return nil, err
 	}
 
-	pb, err := cat.LoadPlaybackSession()
+	pb, err := cat.LoadAlbumPlaybackSession(albumID)
 	if err != nil {
-		_ = db.Close()
 		return nil, err
 	}
 
 	bg := basegraph.NewBaseGraph()
 	if err := bg.SetEdges(edges); err != nil {
-		_ = db.Close()
+		return nil, err
+	}
+
+	// Every song of an album shares it, so an album gap would only ever be
+	// given up.
+	cfg.constraints.AlbumGap = 0
+	return startOrchestrator(cat, bg, pb, func(song *models.Song) bool { return song.AlbumID == albumID }, cfg)
+}
+
+// startOrchestrator starts an orchestrator on bg with the cold start prior and
+// exploration set up for the songs in scope.
+func startOrchestrator(cat catalog.Catalog, bg *basegraph.BaseGraph, pb *playback.PlaybackChain, inScope func(song *models.Song) bool, cfg graphConfig) (*orchestrator.Orchestrator, error) {
+	all, err := cat.ListSongs()
+	if err != nil {
+		return nil, err
+	}
+	var songs []*models.Song
+	for _, song := range all {
+		if inScope(song) {
+			songs = append(songs, song)
+		}
+	}
+	explorer, err := newExplorer(cat, songs, cfg.explore)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := newFilter(cat, all, cfg.constraints)
+	if err != nil {
+		return nil, err
+	}
+	if explorer != nil {
+		explorer.SetFilter(filter)
+	}
+
+	ratings, err := loadRatings(cat)
+	if err != nil {
 		return nil, err
 	}
 
 	s := selector.NewSelector()
+	s.SetFilter(filter)
+	s.SetRatings(ratings)
 	rg := runtime.NewRuntimeGraph()
 	rg.BuildFromBase(bg)
 
 	orch := orchestrator.NewOrchestrator(bg, rg, s, pb)
-	bgChan := orch.GetBGRebuildChan()
-
-	ctx, cancel := context.WithCancel(context.Background())
-	wg := &sync.WaitGroup{}
-
-	app := &App{db: db, catalog: cat, albumID: albumID, orch: orch, baseGraphRebuildChan: bgChan, ctx: ctx, cancel: cancel, wg: wg}
-	app.start()
+	orch.SetPrior(coldStartPrior(songs, bg, cfg.coldStartWeight))
+	orch.SetExplorer(explorer)
+	orch.SetFeedbackPolicy(cfg.feedback)
+	return orch, nil
+}
 
-	return app, nil
+func registerProfile(cat catalog.Catalog, name string) error {
+	if name == "" {
+		return nil
+	}
+	existing, err := cat.LoadProfile(name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return nil
+	}
+	return cat.SaveProfile(&models.Profile{Name: name, CreatedAt: time.Now()})
 }
 
 func (a *App) start() {
 	a.wg.Add(1)
-	go a.manageBaseGraphRebuild()
+	go a.manageBaseGraphRebuild(a.ctx, a.orch, a.graphSaver(), a.baseGraphRebuildChan)
+	if a.radio != nil {
+		a.wg.Add(1)
+		go a.manageLibraryRefresh(a.ctx, a.orch, a.radio)
+	}
+}
+
+// graphSaver returns how the running orchestrator's base graph is persisted:
+// as the current album's graph, or as the learned library edges in radio mode.
+func (a *App) graphSaver() func(bg *basegraph.BaseGraph) error {
+	if lib := a.radio; lib != nil {
+		return func(bg *basegraph.BaseGraph) error {
+			return a.catalog.Update(func(uow catalog.UnitOfWork) error {
+				return saveLibraryLearning(uow, lib, bg)
+			})
+		}
+	}
+	albumID := a.albumID
+	return func(bg *basegraph.BaseGraph) error {
+		return a.catalog.SaveBaseGraph(albumID, bg)
+	}
 }
 
 func (a *App) stop() {
@@ -87,34 +286,36 @@ func (a *App) stop() {
 }
 
 func (a *App) Shutdown() error {
-	a.stop()
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	if a.orch != nil {
 		a.orch.Shutdown()
 	}
-	if a.db != nil {
+	a.stop()
+	if a.db != nil && a.ownsDB {
 		return a.db.Shutdown()
 	}
 	return nil
 }
 
-func (a *App) manageBaseGraphRebuild() {
+func (a *App) manageBaseGraphRebuild(ctx context.Context, orch *orchestrator.Orchestrator, save func(bg *basegraph.BaseGraph) error, rebuildChan <-chan bool) {
 	defer a.wg.Done()
 	for {
 		select {
-		case <-a.ctx.Done():
+		case <-ctx.Done():
 			return
-		case _, ok := <-a.baseGraphRebuildChan:
+		case _, ok := <-rebuildChan:
 			if !ok {
 				return
 			}
-			if a.orch == nil {
+			if orch == nil {
 				return //TODO: hadle error
 			}
-			bg := a.orch.GetBaseGraph()
+			bg := orch.GetBaseGraph()
 			if bg == nil {
 				return //TODO: hadle error
 			}
-			err := a.catalog.SaveBaseGraph(a.albumID, bg)
+			err := save(bg)
 			if err != nil {
 				return //TODO: hadle error
 			}
@@ -140,7 +341,7 @@ func (a *App) manageRuntimeGraphTS() {
 			if pb == nil {
 				return //TODO: handle error
 			}
-			err := a.catalog.SavePlaybackSession(pb)
+			err := a.saveSessionLocked(pb)
 			if err != nil {
 				return //TODO: handle error
 			}
@@ -149,13 +350,16 @@ func (a *App) manageRuntimeGraphTS() {
 }
 
 func (a *App) PlayNext() (int64, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 	if a.orch == nil {
 		return 0, false
 	}
 	id, ok := a.orch.PlayNext()
 	if ok {
+		a.history.started(id, a.historyAlbumID(), a.orch.CurrentExplored(), time.Now())
 		if pb := a.orch.GetPlayBackChain(); pb != nil {
-			err := a.catalog.SavePlaybackSession(pb)
+			err := a.saveSessionLocked(pb)
 			if err != nil {
 				return 0, false
 				//TODO: handle error
@@ -165,14 +369,28 @@ func (a *App) PlayNext() (int64, bool) {
 	return id, ok
 }
 
+// PrepareNext picks the song that will follow the current one without
+// playing it yet; see Orchestrator.PrepareNext.
+func (a *App) PrepareNext() (int64, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.orch == nil {
+		return 0, false
+	}
+	return a.orch.PrepareNext()
+}
+
 func (a *App) PlayBack() (int64, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 	if a.orch == nil {
 		return 0, false
 	}
 	id, ok := a.orch.PlayBack()
 	if ok {
+		a.history.back(id, a.historyAlbumID(), time.Now())
 		if pb := a.orch.GetPlayBackChain(); pb != nil {
-			err := a.catalog.SavePlaybackSession(pb)
+			err := a.saveSessionLocked(pb)
 			if err != nil {
 				return 0, false
 				//TODO: handle
@@ -182,11 +400,195 @@ func (a *App) PlayBack() (int64, bool) {
 	return id, ok
 }
 
-func (a *App) ProcessFeedback(fromID, toID int64, listened, duration float64) {
+// ProcessFeedback learns from a play and records it in the history. It
+// returns a handle to what was learned, which UndoFeedback takes.
+func (a *App) ProcessFeedback(fromID, toID int64, listened, duration float64) (orchestrator.Feedback, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 	if a.orch == nil {
-		return
+		return orchestrator.Feedback{}, false
+	}
+	fb, ok := a.orch.ProcessFeedback(fromID, toID, listened, duration)
+	skipped := playSkipped(a.orch.FeedbackPolicy(), fb, ok, listened, duration)
+	a.history.feedback(fromID, toID, a.historyAlbumID(), listened, duration, skipped, time.Now())
+	return fb, ok
+}
+
+// Signal applies explicit feedback on the transition from fromID to toID and
+// returns a handle to it. The handle's ID is 0 when the policy learns nothing
+// from the signal.
+func (a *App) Signal(fromID, toID int64, s feedback.Signal) (orchestrator.Feedback, error) {
+	if _, err := feedback.ParseSignal(string(s)); err != nil {
+		return orchestrator.Feedback{}, err
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.orch == nil {
+		return orchestrator.Feedback{}, errors.New("app is shut down")
+	}
+	fb, _ := a.orch.Signal(fromID, toID, s)
+	return fb, nil
+}
+
+// SignalCurrent applies explicit feedback on the transition that led to the
+// song playing now.
+func (a *App) SignalCurrent(s feedback.Signal) (orchestrator.Feedback, error) {
+	a.mu.RLock()
+	orch := a.orch
+	a.mu.RUnlock()
+	if orch == nil {
+		return orchestrator.Feedback{}, errors.New("app is shut down")
+	}
+	fromID, toID := orch.CurrentTransition()
+	if toID == 0 {
+		return orchestrator.Feedback{}, errors.New("nothing is playing")
+	}
+	return a.Signal(fromID, toID, s)
+}
+
+func (a *App) historyAlbumID() int64 {
+	if a.radio != nil {
+		return 0
+	}
+	return a.albumID
+}
+
+// History returns the play events of the profile started in [from, to). A
+// zero time leaves that end open.
+func (a *App) History(from, to time.Time) ([]*models.PlayEvent, error) {
+	return a.catalog.ListPlayEvents(from, to)
+}
+
+func (a *App) SongHistory(songID int64, from, to time.Time) ([]*models.PlayEvent, error) {
+	return a.catalog.ListSongPlayEvents(songID, from, to)
+}
+
+func (a *App) AlbumID() int64 {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.albumID
+}
+
+// SwitchAlbum moves playback to another album without reopening the store.
+// The current album's learning is flushed and saved together with its
+// playback chain, so coming back to it later resumes where it was left.
+func (a *App) SwitchAlbum(albumID int64) error {
+	if albumID < 0 {
+		return errors.New("invalid album id")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.orch == nil {
+		return errors.New("app is shut down")
+	}
+	if albumID == a.albumID && a.radio == nil {
+		return nil
+	}
+
+	if err := a.persistLocked(); err != nil {
+		return err
+	}
+	next, err := loadOrchestrator(a.catalog, albumID, a.graphConfig)
+	if err != nil {
+		return err
+	}
+
+	a.albumID = albumID
+	a.radio = nil
+	a.replaceOrchestratorLocked(next)
+	return nil
+}
+
+func (a *App) replaceOrchestratorLocked(next *orchestrator.Orchestrator) {
+	a.orch.Shutdown()
+	a.stop()
+
+	a.orch = next
+	a.baseGraphRebuildChan = next.GetBGRebuildChan()
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+	a.start()
+}
+
+// Save stores the learning done so far together with the playback chain.
+func (a *App) Save() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.orch == nil {
+		return errors.New("app is shut down")
+	}
+	return a.persistLocked()
+}
+
+// persistLocked flushes the orchestrator's learning and stores its graph and
+// playback chain for the current album, or the library in radio mode, in one
+// unit of work.
+func (a *App) persistLocked() error {
+	a.orch.FlushLearning()
+	bg := a.orch.GetBaseGraph()
+	pb := a.orch.GetPlayBackChain()
+	if bg == nil || pb == nil {
+		return errors.New("orchestrator is shut down")
+	}
+
+	return a.catalog.Update(func(uow catalog.UnitOfWork) error {
+		if a.radio != nil {
+			if err := saveLibraryLearning(uow, a.radio, bg); err != nil {
+				return err
+			}
+			return uow.SaveLibraryPlaybackSession(pb)
+		}
+		if err := uow.SaveBaseGraph(a.albumID, bg); err != nil {
+			return err
+		}
+		return uow.SaveAlbumPlaybackSession(a.albumID, pb)
+	})
+}
+
+func (a *App) saveSessionLocked(pb *playback.PlaybackChain) error {
+	if a.radio != nil {
+		return a.catalog.SaveLibraryPlaybackSession(pb)
+	}
+	return a.catalog.SaveAlbumPlaybackSession(a.albumID, pb)
+}
+
+func (a *App) Profile() string {
+	return a.profile
+}
+
+func (a *App) ListProfiles() ([]*models.Profile, error) {
+	return a.catalog.ListProfiles()
+}
+
+// CopyGraphFromProfile copies the current album's graph of another profile
+// into this one, summing the weights when merge is set, and reloads the
+// orchestrator from the result.
+func (a *App) CopyGraphFromProfile(profile string, merge bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.orch == nil {
+		return errors.New("app is shut down")
+	}
+	if profile == a.profile {
+		return errors.New("source and target profile are the same")
+	}
+	if a.radio != nil {
+		return errors.New("not available in radio mode")
+	}
+
+	src, err := catalog.NewProfileCatalog(a.db, profile)
+	if err != nil {
+		return err
+	}
+
+	if err := a.persistLocked(); err != nil {
+		return err
+	}
+
+	if err := catalog.CopyGraph(src, a.catalog, a.albumID, merge); err != nil {
+		return err
 	}
-	a.orch.ProcessFeedback(fromID, toID, listened, duration)
+	return a.reloadGraphLocked()
 }
 
 // for tests
@@ -199,5 +601,7 @@ func (a *App) ListAlbums() ([]*models.Album, error) {
 }
 
 func (a *App) Orchestrator() *orchestrator.Orchestrator {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 	return a.orch
 }
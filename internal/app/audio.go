@@ -0,0 +1,89 @@
+package app
+
+import (
+	"GO_player/internal/audio"
+	"GO_player/internal/loudness"
+	"fmt"
+	"time"
+)
+
+// NewEngine returns an audio engine that plays the songs this App picks and
+// feeds back how much of each was heard. Unless opts says otherwise, the
+// crossfade of a song comes from its album.
+func (a *App) NewEngine(out audio.Output, opts audio.Options) *audio.Engine {
+	if opts.CrossfadeFor == nil {
+		opts.CrossfadeFor = a.songCrossfade
+	}
+	return audio.NewEngine(a, a.songPath, out, opts)
+}
+
+// SetAlbumCrossfade sets how long the songs of an album overlap; 0 joins them
+// gaplessly and a negative length goes back to the engine's default.
+func (a *App) SetAlbumCrossfade(albumID int64, length time.Duration) error {
+	album, err := a.catalog.LoadAlbum(albumID)
+	if err != nil {
+		return err
+	}
+	album.ID = albumID
+	album.Crossfade = nil
+	if length >= 0 {
+		seconds := length.Seconds()
+		album.Crossfade = &seconds
+	}
+	return a.catalog.SaveAlbum(albumID, album)
+}
+
+func (a *App) songPath(songID int64) (string, error) {
+	song, err := a.catalog.LoadSong(songID)
+	if err != nil {
+		return "", err
+	}
+	if song == nil || song.Path == "" {
+		return "", fmt.Errorf("song %d has no file", songID)
+	}
+	return song.Path, nil
+}
+
+// songCrossfade returns the crossfade of the song's album. Songs without an
+// album take the one being played, outside radio mode.
+func (a *App) songCrossfade(songID int64) (time.Duration, bool) {
+	song, err := a.catalog.LoadSong(songID)
+	if err != nil || song == nil {
+		return 0, false
+	}
+	albumID := song.AlbumID
+	if albumID == 0 {
+		a.mu.RLock()
+		if a.radio == nil {
+			albumID = a.albumID
+		}
+		a.mu.RUnlock()
+	}
+
+	album, err := a.catalog.LoadAlbum(albumID)
+	if err != nil || album.Crossfade == nil {
+		return 0, false
+	}
+	return time.Duration(*album.Crossfade * float64(time.Second)), true
+}
+
+// LoudnessGain returns a gain for audio.Options.GainFor that brings songs to
+// target LUFS using their stored measurements; see the loudness package.
+func (a *App) LoudnessGain(mode loudness.Mode, target float64) func(songID int64) (float64, bool) {
+	return func(songID int64) (float64, bool) {
+		if mode == loudness.ModeOff {
+			return 0, false
+		}
+		song, err := a.catalog.LoadSong(songID)
+		if err != nil || song == nil || song.Loudness == nil {
+			return 0, false
+		}
+		if mode == loudness.ModeAlbum && song.AlbumID != 0 {
+			album, err := a.catalog.LoadAlbum(song.AlbumID)
+			if err == nil && album.Loudness != nil {
+				return loudness.Gain(album.Loudness, target), true
+			}
+		}
+		return loudness.Gain(song.Loudness, target), true
+	}
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"GO_player/internal/features"
+	"GO_player/internal/memory/basegraph"
+	"GO_player/internal/models"
+)
+
+const (
+	defaultColdStartWeight = 0.25
+	coldStartNeighbors     = 5
+)
+
+// coldStartPrior connects the songs that no edge of bg leads to, or leads
+// away from, with the songs that sound the most like them. A weight of 0 or
+// less disables it.
+func coldStartPrior(songs []*models.Song, bg *basegraph.BaseGraph, weight float64) map[int64]map[int64]float64 {
+	if weight <= 0 {
+		return nil
+	}
+
+	incoming := make(map[int64]bool)
+	outgoing := make(map[int64]bool)
+	for fromID, neighbors := range bg.GetEdges() {
+		for toID := range neighbors {
+			incoming[toID] = true
+			outgoing[fromID] = true
+		}
+	}
+
+	cold := make(map[int64]bool)
+	for _, song := range songs {
+		if song.Features != nil && (!incoming[song.ID] || !outgoing[song.ID]) {
+			cold[song.ID] = true
+		}
+	}
+	if len(cold) == 0 {
+		return nil
+	}
+	return features.ColdStart(songs, cold, coldStartNeighbors, weight)
+}
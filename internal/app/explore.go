@@ -0,0 +1,67 @@
+package app
+
+import (
+	"GO_player/internal/catalog"
+	"GO_player/internal/memory/selector"
+	"GO_player/internal/models"
+	"time"
+)
+
+func exploring(opts selector.ExploreOptions) bool {
+	return opts.Mode != "" && opts.Mode != selector.ExploreOff
+}
+
+// newExplorer returns an explorer over songs that knows from the history how
+// often each was played, or nil when exploration is off.
+func newExplorer(cat catalog.Catalog, songs []*models.Song, opts selector.ExploreOptions) (*selector.Explorer, error) {
+	if !exploring(opts) {
+		return nil, nil
+	}
+	all, err := cat.CountPlayEvents()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(songs))
+	counts := make(map[int64]int)
+	for _, song := range songs {
+		ids = append(ids, song.ID)
+		if n := all[song.ID]; n > 0 {
+			counts[song.ID] = n
+		}
+	}
+
+	e := selector.NewExplorer(opts)
+	e.SetSongs(ids)
+	e.SetPlayCounts(counts)
+	return e, nil
+}
+
+// newFilter returns a filter enforcing c that already knows the recent plays
+// of the history, or nil when no constraint is set. Only the plays the
+// constraints can still look at are read.
+func newFilter(cat catalog.Catalog, songs []*models.Song, c selector.Constraints) (*selector.Filter, error) {
+	if !c.Enabled() {
+		return nil, nil
+	}
+	var since time.Time
+	if c.RepeatWindow > 0 {
+		since = time.Now().Add(-c.RepeatWindow)
+	}
+	events, err := cat.ListRecentPlayEvents(c.RecentPlays(), since)
+	if err != nil {
+		return nil, err
+	}
+
+	info := make(map[int64]selector.SongInfo, len(songs))
+	for _, song := range songs {
+		info[song.ID] = selector.SongInfo{Artist: song.Artist, AlbumID: song.AlbumID, Genre: song.Genre}
+	}
+
+	f := selector.NewFilter(c)
+	f.SetSongs(info)
+	for _, event := range events {
+		f.Played(event.SongID, event.StartedAt)
+	}
+	return f, nil
+}
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"GO_player/internal/catalog"
+	"GO_player/internal/logger"
+	"GO_player/internal/memory/feedback"
+	"GO_player/internal/models"
+	"GO_player/internal/orchestrator"
+	"sync"
+	"time"
+)
+
+// historyRecorder turns the playback calls into play events. A song that
+// starts playing is kept pending until feedback for it arrives or playback
+// moves on, and is written out once its outcome is known.
+type historyRecorder struct {
+	mu      sync.Mutex
+	catalog catalog.Catalog
+	pending *models.PlayEvent
+	current int64
+}
+
+func newHistoryRecorder(cat catalog.Catalog) *historyRecorder {
+	return &historyRecorder{catalog: cat}
+}
+
+// started records that songID began playing after PlayNext. A pending event
+// that got no feedback is written as skipped.
+func (h *historyRecorder) started(songID, albumID int64, explored bool, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closePending(models.OutcomeSkipped, now)
+	h.begin(songID, albumID, now)
+	h.pending.Explored = explored
+}
+
+// back records that playback went back to songID.
+func (h *historyRecorder) back(songID, albumID int64, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closePending(models.OutcomeBack, now)
+	h.begin(songID, albumID, now)
+}
+
+// feedback completes the event of toID with how much of it was heard and
+// whether that counted as a skip.
+func (h *historyRecorder) feedback(fromID, toID, albumID int64, listened, duration float64, skipped bool, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	event := h.pending
+	if event == nil || event.SongID != toID {
+		h.closePending(models.OutcomeSkipped, now)
+		event = &models.PlayEvent{
+			SongID:     toID,
+			PreviousID: fromID,
+			AlbumID:    albumID,
+			StartedAt:  now.Add(-time.Duration(listened * float64(time.Second))),
+		}
+		h.current = toID
+	}
+	h.pending = nil
+
+	event.Listened = listened
+	event.Duration = duration
+	event.Outcome = models.OutcomeCompleted
+	if skipped {
+		event.Outcome = models.OutcomeSkipped
+	}
+	h.write(event)
+}
+
+// playSkipped reports whether a play counts as skipped, so that the history
+// agrees with what the graph learned: when feedback was applied, whether it
+// went against the transition, otherwise whether the policy would have. A
+// play of unknown length counts as skipped.
+func playSkipped(policy feedback.Policy, fb orchestrator.Feedback, learned bool, listened, duration float64) bool {
+	u := fb.Update
+	if !learned {
+		progress, ok := feedback.Progress(listened, duration)
+		if !ok {
+			return true
+		}
+		u = policy.Played(progress)
+	}
+	return u.Penalty > 0 || u.Cooldown > 0 || u.Clear
+}
+
+func (h *historyRecorder) begin(songID, albumID int64, now time.Time) {
+	h.pending = &models.PlayEvent{
+		SongID:     songID,
+		PreviousID: h.current,
+		AlbumID:    albumID,
+		StartedAt:  now,
+	}
+	h.current = songID
+}
+
+// closePending writes the pending event with the wall-clock time since it
+// started as the listened time; its duration is unknown.
+func (h *historyRecorder) closePending(outcome models.PlayOutcome, now time.Time) {
+	if h.pending == nil {
+		return
+	}
+	event := h.pending
+	h.pending = nil
+
+	event.Listened = now.Sub(event.StartedAt).Seconds()
+	event.Outcome = outcome
+	h.write(event)
+}
+
+func (h *historyRecorder) write(event *models.PlayEvent) {
+	if err := h.catalog.AppendPlayEvent(event); err != nil {
+		logger.Error("app", "recording play event failed", err)
+	}
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"GO_player/internal/planner"
+	"errors"
+	"time"
+)
+
+// Plan plans the songs to play after the current one, following the runtime
+// graph. Unless opts has its own, the plan keeps to the App's constraints and
+// ratings and takes song lengths from the catalog. The plan is not played;
+// EnqueuePlan queues it.
+func (a *App) Plan(opts planner.Options) (*planner.Plan, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.orch == nil {
+		return nil, errors.New("app is shut down")
+	}
+	rg := a.orch.GetRuntimeGraph()
+	pb := a.orch.GetPlayBackChain()
+	if rg == nil || pb == nil {
+		return nil, errors.New("app is shut down")
+	}
+
+	if opts.Filter == nil {
+		opts.Filter = a.orch.Filter()
+	}
+	if opts.Ratings == nil {
+		opts.Ratings = a.orch.Ratings()
+	}
+	if opts.Length == nil {
+		songs, err := a.catalog.ListSongs()
+		if err != nil {
+			return nil, err
+		}
+		lengths := make(map[int64]time.Duration, len(songs))
+		for _, song := range songs {
+			if song.Duration > 0 {
+				lengths[song.ID] = time.Duration(song.Duration * float64(time.Second))
+			}
+		}
+		opts.Length = func(id int64) (time.Duration, bool) {
+			d, ok := lengths[id]
+			return d, ok
+		}
+	}
+	return planner.Build(rg, pb.Current, opts)
+}
+
+// EnqueuePlan adds the songs of a plan to the end of the play queue.
+func (a *App) EnqueuePlan(plan *planner.Plan) error {
+	if plan == nil || len(plan.SongIDs) == 0 {
+		return errors.New("empty plan")
+	}
+	return a.Enqueue(plan.SongIDs...)
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"GO_player/internal/models"
+	"GO_player/internal/playlist"
+	"errors"
+	"time"
+)
+
+func (a *App) Playlists() ([]*models.Playlist, error) {
+	return a.catalog.ListPlaylists()
+}
+
+// Playlist returns nil without an error when the playlist does not exist.
+func (a *App) Playlist(id int64) (*models.Playlist, error) {
+	return a.catalog.LoadPlaylist(id)
+}
+
+// SavePlaylist stores songIDs as a new playlist.
+func (a *App) SavePlaylist(name string, songIDs []int64) (*models.Playlist, error) {
+	if len(songIDs) == 0 {
+		return nil, errors.New("empty playlist")
+	}
+	now := time.Now().UTC()
+	p := &models.Playlist{Name: name, SongIDs: append([]int64(nil), songIDs...), CreatedAt: now, UpdatedAt: now}
+	if err := a.catalog.SavePlaylist(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (a *App) DeletePlaylist(id int64) error {
+	return a.catalog.DeletePlaylist(id)
+}
+
+// ImportPlaylist saves a playlist file as a playlist. When it seeds the graphs
+// the learning so far is saved first and the orchestrator reloaded after, as
+// for a sync.
+func (a *App) ImportPlaylist(file *playlist.File, opts playlist.ImportOptions) (*playlist.ImportResult, error) {
+	if !opts.Seed {
+		return playlist.Import(a.catalog, file, opts)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.orch == nil {
+		return nil, errors.New("app is shut down")
+	}
+	if err := a.persistLocked(); err != nil {
+		return nil, err
+	}
+	res, err := playlist.Import(a.catalog, file, opts)
+	if err != nil {
+		return nil, err
+	}
+	return res, a.reloadGraphLocked()
+}
+
+// EnqueuePlaylist adds the songs of a playlist to the end of the play queue.
+func (a *App) EnqueuePlaylist(id int64) error {
+	p, err := a.catalog.LoadPlaylist(id)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return errors.New("no such playlist")
+	}
+	return a.Enqueue(p.SongIDs...)
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"errors"
+)
+
+var ErrQueueIndex = errors.New("queue index out of range")
+
+// Enqueue adds songs to the end of the play queue. Queued songs are played
+// before the selector is consulted again.
+func (a *App) Enqueue(ids ...int64) error {
+	for _, id := range ids {
+		if id <= 0 {
+			return errors.New("invalid song id")
+		}
+	}
+	return a.updateQueue(func() bool {
+		return a.orch.Enqueue(ids...)
+	})
+}
+
+// InsertNext puts a song at the head of the play queue.
+func (a *App) InsertNext(id int64) error {
+	if id <= 0 {
+		return errors.New("invalid song id")
+	}
+	return a.updateQueue(func() bool {
+		return a.orch.InsertNext(id)
+	})
+}
+
+func (a *App) RemoveFromQueue(index int) error {
+	return a.updateQueue(func() bool {
+		return a.orch.RemoveFromQueue(index)
+	})
+}
+
+func (a *App) MoveInQueue(from, to int) error {
+	return a.updateQueue(func() bool {
+		return a.orch.MoveInQueue(from, to)
+	})
+}
+
+func (a *App) ClearQueue() error {
+	return a.updateQueue(func() bool {
+		return a.orch.ClearQueue()
+	})
+}
+
+func (a *App) Queue() []int64 {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.orch == nil {
+		return nil
+	}
+	return a.orch.Queue()
+}
+
+// updateQueue applies a queue change and saves the playback session with it.
+func (a *App) updateQueue(fn func() bool) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.orch == nil {
+		return errors.New("app is shut down")
+	}
+	if !fn() {
+		return ErrQueueIndex
+	}
+
+	pb := a.orch.GetPlayBackChain()
+	if pb == nil {
+		return errors.New("orchestrator is shut down")
+	}
+	return a.saveSessionLocked(pb)
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"GO_player/internal/catalog"
+	"GO_player/internal/logger"
+	"GO_player/internal/memory/basegraph"
+	"GO_player/internal/memory/library"
+	"GO_player/internal/models"
+	"GO_player/internal/orchestrator"
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	defaultLibraryAlbumWeight = 1.0
+	defaultLibraryRefresh     = 30 * time.Minute
+)
+
+// StartRadio leaves the current album and plays across the whole library. The
+// album graphs are combined into a prior; transitions learned in radio mode,
+// including the ones between albums, are kept in the library graph and never
+// written back into an album. SwitchAlbum returns to album mode.
+func (a *App) StartRadio() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.orch == nil {
+		return errors.New("app is shut down")
+	}
+	if a.radio != nil {
+		return nil
+	}
+
+	if err := a.persistLocked(); err != nil {
+		return err
+	}
+	lib := library.NewLibrary(a.albumWeight)
+	next, err := loadRadioOrchestrator(a.catalog, lib, a.graphConfig)
+	if err != nil {
+		return err
+	}
+
+	a.radio = lib
+	a.replaceOrchestratorLocked(next)
+	return nil
+}
+
+func (a *App) Radio() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.radio != nil
+}
+
+func loadRadioOrchestrator(cat catalog.Catalog, lib *library.Library, cfg graphConfig) (*orchestrator.Orchestrator, error) {
+	albums, err := loadAlbumGraphs(cat)
+	if err != nil {
+		return nil, err
+	}
+	lib.SetAlbumGraphs(albums)
+
+	learned, penalties, err := loadLibraryLearning(cat)
+	if err != nil {
+		return nil, err
+	}
+
+	pb, err := cat.LoadLibraryPlaybackSession()
+	if err != nil {
+		return nil, err
+	}
+
+	bg := lib.Blend(learned, penalties)
+	return startOrchestrator(cat, bg, pb, func(*models.Song) bool { return true }, cfg)
+}
+
+// loadLibraryLearning reads what radio mode learned on top of the album prior.
+func loadLibraryLearning(cat catalog.Catalog) (learned, penalties map[int64]map[int64]float64, err error) {
+	if learned, err = cat.LoadLibraryGraphEdges(); err != nil {
+		return nil, nil, err
+	}
+	if penalties, err = cat.LoadLibraryPenalties(); err != nil {
+		return nil, nil, err
+	}
+	return learned, penalties, nil
+}
+
+// saveLibraryLearning stores what bg learned on top of the album prior.
+func saveLibraryLearning(w catalog.Batch, lib *library.Library, bg *basegraph.BaseGraph) error {
+	learned, penalties := lib.Extract(bg)
+	if err := w.SaveLibraryGraphEdges(learned); err != nil {
+		return err
+	}
+	return w.SaveLibraryPenalties(penalties)
+}
+
+func loadAlbumGraphs(cat catalog.Catalog) (map[int64]map[int64]map[int64]float64, error) {
+	ids, err := cat.ListBaseGraphIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	albums := make(map[int64]map[int64]map[int64]float64, len(ids))
+	for _, id := range ids {
+		edges, err := cat.LoadBaseGraphEdges(id)
+		if err != nil {
+			return nil, err
+		}
+		albums[id] = edges
+	}
+	return albums, nil
+}
+
+// manageLibraryRefresh picks up album graphs that changed since radio mode
+// started, e.g. learned by another App on the same store, without losing what
+// was learned on top of them.
+func (a *App) manageLibraryRefresh(ctx context.Context, orch *orchestrator.Orchestrator, lib *library.Library) {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.libraryRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			albums, err := loadAlbumGraphs(a.catalog)
+			if err != nil {
+				logger.Error("app", "library refresh failed", err)
+				continue
+			}
+
+			orch.RebaseGraph(func(current *basegraph.BaseGraph) *basegraph.BaseGraph {
+				learned, penalties := lib.Extract(current)
+				lib.SetAlbumGraphs(albums)
+				return lib.Blend(learned, penalties)
+			})
+
+			bg := orch.GetBaseGraph()
+			if bg == nil {
+				return
+			}
+			err = a.catalog.Update(func(uow catalog.UnitOfWork) error {
+				return saveLibraryLearning(uow, lib, bg)
+			})
+			if err != nil {
+				logger.Error("app", "saving library graph failed", err)
+			}
+		}
+	}
+}
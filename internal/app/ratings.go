@@ -0,0 +1,105 @@
+package app
+
+import (
+	"GO_player/internal/catalog"
+	"GO_player/internal/memory/selector"
+	"GO_player/internal/models"
+	"errors"
+	"time"
+)
+
+func loadRatings(cat catalog.Catalog) (*selector.Ratings, error) {
+	stored, err := cat.ListRatings()
+	if err != nil {
+		return nil, err
+	}
+	r := selector.NewRatings(0)
+	for _, rating := range stored {
+		r.Ban(rating.SongID, rating.Banned)
+		r.Pin(rating.SongID, rating.Pinned)
+	}
+	return r, nil
+}
+
+// Ratings returns the songs the profile banned or pinned.
+func (a *App) Ratings() ([]*models.Rating, error) {
+	return a.catalog.ListRatings()
+}
+
+// BanSong keeps a song from ever being picked by the player, or lifts the
+// ban. Banning a song unpins it. The ban is stored with the profile.
+func (a *App) BanSong(id int64, banned bool) error {
+	return a.rateSong(id, func(r *models.Rating) {
+		r.Banned = banned
+		if banned {
+			r.Pinned = false
+		}
+	}, func() { a.orch.Ban(id, banned) })
+}
+
+// PinSong marks a song as always welcome, or unpins it. Pinning a song lifts
+// its ban.
+func (a *App) PinSong(id int64, pinned bool) error {
+	return a.rateSong(id, func(r *models.Rating) {
+		r.Pinned = pinned
+		if pinned {
+			r.Banned = false
+		}
+	}, func() { a.orch.Pin(id, pinned) })
+}
+
+// rateSong stores the changed rating of a song and then applies it to the
+// running orchestrator.
+func (a *App) rateSong(id int64, change func(r *models.Rating), apply func()) error {
+	if id <= 0 {
+		return errors.New("invalid song id")
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.orch == nil {
+		return errors.New("app is shut down")
+	}
+
+	rating, err := a.catalog.LoadRating(id)
+	if err != nil {
+		return err
+	}
+	if rating == nil {
+		rating = &models.Rating{SongID: id}
+	}
+	change(rating)
+	rating.UpdatedAt = time.Now().UTC()
+	if err := a.catalog.SaveRating(rating); err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// RateTransition gives the transition from fromID to toID a thumbs up or
+// down. Unlike a signal it changes the base graph at once, and the graph is
+// saved right away.
+func (a *App) RateTransition(fromID, toID int64, up bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.orch == nil {
+		return errors.New("app is shut down")
+	}
+	a.orch.Rate(fromID, toID, up)
+	return a.persistLocked()
+}
+
+// RateCurrent rates the transition that led to the song playing now.
+func (a *App) RateCurrent(up bool) error {
+	a.mu.RLock()
+	orch := a.orch
+	a.mu.RUnlock()
+	if orch == nil {
+		return errors.New("app is shut down")
+	}
+	fromID, toID := orch.CurrentTransition()
+	if toID == 0 {
+		return errors.New("nothing is playing")
+	}
+	return a.RateTransition(fromID, toID, up)
+}
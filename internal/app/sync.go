@@ -0,0 +1,191 @@
+package app
+
+import (
+	"GO_player/internal/catalog"
+	"GO_player/internal/memory/basegraph"
+	"GO_player/internal/memory/crdt"
+	"GO_player/internal/memsync"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+)
+
+// SyncWith exchanges learned memory with another device serving SyncHandler
+// at baseURL. Both sides end up with the same graphs whatever the order of
+// syncs, and learning done on each device since its last sync is kept.
+func (a *App) SyncWith(baseURL string) (*memsync.Result, error) {
+	return memsync.Sync(a.SyncReplica(), memsync.NewClient(baseURL, nil))
+}
+
+func (a *App) SyncHandler() http.Handler {
+	return memsync.NewHandler(a.SyncReplica())
+}
+
+func (a *App) SyncReplica() memsync.Replica {
+	return appReplica{a: a}
+}
+
+// appReplica serves the App's profile. Pull and Push first record the
+// learning stored since the last sync as this device's own changes.
+type appReplica struct {
+	a *App
+}
+
+func (r appReplica) Vector() (crdt.Vector, error) {
+	state, err := r.a.catalog.LoadSyncState()
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return crdt.Vector{}, nil
+	}
+	return state.Vector(), nil
+}
+
+func (r appReplica) Pull(since crdt.Vector) (*crdt.Delta, error) {
+	a := r.a
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.orch == nil {
+		return nil, errors.New("app is shut down")
+	}
+
+	if err := a.persistLocked(); err != nil {
+		return nil, err
+	}
+	ids, err := a.catalog.ListBaseGraphIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	var delta *crdt.Delta
+	err = a.catalog.Update(func(uow catalog.UnitOfWork) error {
+		state, err := captureSyncState(uow, ids, a.deviceID)
+		if err != nil {
+			return err
+		}
+		delta = state.Since(since)
+		return uow.SaveSyncState(state)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return delta, nil
+}
+
+func (r appReplica) Push(delta *crdt.Delta) error {
+	if delta == nil {
+		return errors.New("nil delta")
+	}
+
+	a := r.a
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.orch == nil {
+		return errors.New("app is shut down")
+	}
+
+	if err := a.persistLocked(); err != nil {
+		return err
+	}
+	ids, err := a.catalog.ListBaseGraphIDs()
+	if err != nil {
+		return err
+	}
+
+	err = a.catalog.Update(func(uow catalog.UnitOfWork) error {
+		state, err := captureSyncState(uow, ids, a.deviceID)
+		if err != nil {
+			return err
+		}
+		for _, graph := range state.Merge(delta) {
+			edges := state.Graph(graph)
+			if graph == crdt.LibraryGraph {
+				err = uow.SaveLibraryGraphEdges(edges)
+			} else if albumID, ok := crdt.ParseAlbumGraph(graph); ok {
+				err = uow.SaveBaseGraphEdges(albumID, edges)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return uow.SaveSyncState(state)
+	})
+	if err != nil {
+		return err
+	}
+	return a.reloadGraphLocked()
+}
+
+// captureSyncState loads the profile's sync state and records every stored
+// graph into it. On the first sync the graphs become the device's baseline.
+func captureSyncState(uow catalog.UnitOfWork, albumIDs []int64, device string) (*crdt.State, error) {
+	state, err := uow.LoadSyncState()
+	if err != nil {
+		return nil, err
+	}
+	first := state == nil
+	if first {
+		if device == "" {
+			device = newDeviceID()
+		}
+		state = crdt.NewState(device)
+	}
+	record := func(graph string, edges map[int64]map[int64]float64) {
+		if first {
+			state.Baseline(graph, edges)
+		} else {
+			state.Capture(graph, edges)
+		}
+	}
+
+	for _, albumID := range albumIDs {
+		edges, err := uow.LoadBaseGraphEdges(albumID)
+		if err != nil {
+			return nil, err
+		}
+		record(crdt.AlbumGraph(albumID), edges)
+	}
+	library, err := uow.LoadLibraryGraphEdges()
+	if err != nil {
+		return nil, err
+	}
+	record(crdt.LibraryGraph, library)
+	return state, nil
+}
+
+func newDeviceID() string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// reloadGraphLocked replaces the orchestrator's graph with the stored one of
+// the current album, or with the blended library graph in radio mode.
+func (a *App) reloadGraphLocked() error {
+	if a.radio != nil {
+		albums, err := loadAlbumGraphs(a.catalog)
+		if err != nil {
+			return err
+		}
+		learned, penalties, err := loadLibraryLearning(a.catalog)
+		if err != nil {
+			return err
+		}
+		a.radio.SetAlbumGraphs(albums)
+		a.orch.ReplaceBaseGraph(a.radio.Blend(learned, penalties))
+		return nil
+	}
+
+	edges, err := a.catalog.LoadBaseGraphEdges(a.albumID)
+	if err != nil {
+		return err
+	}
+	bg := basegraph.NewBaseGraph()
+	if err := bg.SetEdges(edges); err != nil {
+		return err
+	}
+	a.orch.ReplaceBaseGraph(bg)
+	return nil
+}
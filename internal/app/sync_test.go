@@ -0,0 +1,164 @@
+package app
+
+import (
+	"GO_player/internal/memory/feedback"
+	"GO_player/internal/storage"
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"testing"
+)
+
+const syncAlbum = 1
+
+// newSyncApp starts an App on its own in-memory store, served over HTTP so
+// that other Apps can sync with it.
+func newSyncApp(t *testing.T, device string) (*App, string) {
+	t.Helper()
+	a, err := NewAppWithStore(storage.NewMemoryDB(), Options{AlbumID: syncAlbum, DeviceID: device})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(a.SyncHandler())
+	t.Cleanup(func() {
+		srv.Close()
+		_ = a.Shutdown()
+	})
+	return a, srv.URL
+}
+
+func like(t *testing.T, a *App, fromID, toID int64) {
+	t.Helper()
+	if _, err := a.Signal(fromID, toID, feedback.SignalLike); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// storedEdges saves the App's learning and returns the album graph it stored.
+func storedEdges(t *testing.T, a *App) map[int64]map[int64]float64 {
+	t.Helper()
+	if err := a.Save(); err != nil {
+		t.Fatal(err)
+	}
+	edges, err := a.catalog.LoadBaseGraphEdges(syncAlbum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return edges
+}
+
+func syncWith(t *testing.T, a *App, url string) {
+	t.Helper()
+	if _, err := a.SyncWith(url); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertSameEdges(t *testing.T, name string, got, want map[int64]map[int64]float64) {
+	t.Helper()
+	count := func(edges map[int64]map[int64]float64) (n int) {
+		for _, neighbors := range edges {
+			n += len(neighbors)
+		}
+		return n
+	}
+	if count(got) != count(want) {
+		t.Fatalf("%s: %d edges, want %d: got %v, want %v", name, count(got), count(want), got, want)
+	}
+	for fromID, neighbors := range want {
+		for toID, weight := range neighbors {
+			w, ok := got[fromID][toID]
+			if !ok || math.Abs(w-weight) > 1e-9 {
+				t.Fatalf("%s: edge %d->%d is %v, want %v", name, fromID, toID, w, weight)
+			}
+		}
+	}
+}
+
+func TestSyncConvergesBothWays(t *testing.T) {
+	a, _ := newSyncApp(t, "a")
+	b, bURL := newSyncApp(t, "b")
+
+	like(t, a, 1, 2)
+	like(t, b, 2, 3)
+	wantA, wantB := storedEdges(t, a), storedEdges(t, b)
+
+	syncWith(t, a, bURL)
+
+	gotA, gotB := storedEdges(t, a), storedEdges(t, b)
+	assertSameEdges(t, "b after sync", gotB, gotA)
+	if gotA[1][2] != wantA[1][2] || gotA[2][3] != wantB[2][3] {
+		t.Fatalf("synced graph %v lost learning: a had %v, b had %v", gotA, wantA, wantB)
+	}
+}
+
+func TestSyncDoesNotCountTwice(t *testing.T) {
+	a, aURL := newSyncApp(t, "a")
+	b, bURL := newSyncApp(t, "b")
+
+	like(t, a, 1, 2)
+	syncWith(t, a, bURL)
+	base := storedEdges(t, a)[1][2]
+
+	like(t, a, 1, 2)
+	like(t, b, 1, 2)
+	learnedA := storedEdges(t, a)[1][2] - base
+	learnedB := storedEdges(t, b)[1][2] - base
+	if learnedA <= 0 || learnedB <= 0 {
+		t.Fatalf("likes learned %v and %v", learnedA, learnedB)
+	}
+
+	syncWith(t, a, bURL)
+	want := storedEdges(t, a)
+	if got := want[1][2]; math.Abs(got-(base+learnedA+learnedB)) > 1e-9 {
+		t.Fatalf("edge 1->2 is %v after sync, want %v + %v + %v", got, base, learnedA, learnedB)
+	}
+
+	// Nothing was learned since, so syncing again either way changes nothing.
+	syncWith(t, a, bURL)
+	syncWith(t, b, aURL)
+	syncWith(t, a, bURL)
+	assertSameEdges(t, "a after repeated syncs", storedEdges(t, a), want)
+	assertSameEdges(t, "b after repeated syncs", storedEdges(t, b), want)
+}
+
+func TestSyncOrderDoesNotMatter(t *testing.T) {
+	// Each run starts three devices with the same learning and syncs them
+	// pairwise in its own order until every device has seen every other.
+	orders := [][][2]int{
+		{{0, 1}, {0, 2}, {1, 2}, {0, 1}},
+		{{2, 1}, {1, 0}, {2, 0}, {2, 1}},
+		{{1, 2}, {2, 0}, {0, 1}, {1, 2}},
+	}
+
+	var want map[int64]map[int64]float64
+	for i, order := range orders {
+		var apps []*App
+		var urls []string
+		for _, device := range []string{"a", "b", "c"} {
+			a, url := newSyncApp(t, device)
+			apps, urls = append(apps, a), append(urls, url)
+		}
+		like(t, apps[0], 1, 2)
+		like(t, apps[1], 1, 2)
+		like(t, apps[1], 2, 3)
+		like(t, apps[2], 3, 1)
+		for _, app := range apps {
+			storedEdges(t, app)
+		}
+
+		for _, pair := range order {
+			syncWith(t, apps[pair[0]], urls[pair[1]])
+		}
+
+		if want == nil {
+			want = storedEdges(t, apps[0])
+			if want[1][2] == 0 || want[2][3] == 0 || want[3][1] == 0 {
+				t.Fatalf("synced graph %v lost learning", want)
+			}
+		}
+		for _, app := range apps {
+			assertSameEdges(t, fmt.Sprintf("order %d, device %s", i, app.deviceID), storedEdges(t, app), want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"GO_player/internal/orchestrator"
+	"errors"
+)
+
+// FeedbackJournal returns the recent feedback that can still be undone,
+// oldest first.
+func (a *App) FeedbackJournal() []orchestrator.Feedback {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.orch == nil {
+		return nil
+	}
+	return a.orch.Journal()
+}
+
+// UndoFeedback takes back the feedback with the given ID. When a rebuild had
+// already folded it into the base graph, the corrected graph is saved right
+// away.
+func (a *App) UndoFeedback(id uint64) (orchestrator.Feedback, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.orch == nil {
+		return orchestrator.Feedback{}, errors.New("app is shut down")
+	}
+	fb, err := a.orch.Undo(id)
+	if err != nil {
+		return fb, err
+	}
+	if fb.Folded {
+		return fb, a.persistLocked()
+	}
+	return fb, nil
+}
+
+// UndoLastFeedback takes back the most recent feedback, such as the skip of
+// a song that was meant to keep playing.
+func (a *App) UndoLastFeedback() (orchestrator.Feedback, error) {
+	a.mu.RLock()
+	orch := a.orch
+	a.mu.RUnlock()
+	if orch == nil {
+		return orchestrator.Feedback{}, errors.New("app is shut down")
+	}
+	fb, ok := orch.LastFeedback()
+	if !ok {
+		return orchestrator.Feedback{}, errors.New("no feedback to undo")
+	}
+	return a.UndoFeedback(fb.ID)
+}
@@ -0,0 +1,87 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrUnsupported = errors.New("unsupported audio format")
+
+// Format describes interleaved samples: SampleRate frames per second, each
+// frame holding one sample per channel.
+type Format struct {
+	SampleRate int
+	Channels   int
+}
+
+func (f Format) Duration(frames int64) time.Duration {
+	if f.SampleRate <= 0 {
+		return 0
+	}
+	return time.Duration(frames) * time.Second / time.Duration(f.SampleRate)
+}
+
+func (f Format) Frames(d time.Duration) int64 {
+	return int64(d) * int64(f.SampleRate) / int64(time.Second)
+}
+
+// Decoder reads a song as interleaved float32 samples in [-1, 1]. Positions
+// and lengths are counted in frames.
+type Decoder interface {
+	Format() Format
+	// Read fills p with whole frames and returns the number of samples
+	// written. It returns io.EOF once the song is over.
+	Read(p []float32) (int, error)
+	// Length returns the number of frames of the song, or -1 when unknown.
+	Length() int64
+	Position() int64
+	SetPosition(frame int64) error
+	Close() error
+}
+
+// Open returns a decoder for a WAV, FLAC, MP3 or Ogg Vorbis file. The format
+// is recognized by the file's signature, then by its extension.
+func Open(path string) (Decoder, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var magic [4]byte
+	n, err := io.ReadFull(f, magic[:])
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	var dec Decoder
+	head := magic[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte("RIFF")):
+		dec, err = newWAVDecoder(f)
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		dec, err = newFLACDecoder(f)
+	case bytes.HasPrefix(head, []byte("OggS")):
+		dec, err = newVorbisDecoder(f)
+	case bytes.HasPrefix(head, []byte("ID3")), len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0,
+		strings.EqualFold(filepath.Ext(path), ".mp3"):
+		dec, err = newMP3Decoder(f)
+	default:
+		err = ErrUnsupported
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return dec, nil
+}
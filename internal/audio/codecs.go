@@ -0,0 +1,222 @@
+package audio
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/hajimehoshi/go-mp3"
+	"github.com/jfreymuth/oggvorbis"
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+)
+
+type flacDecoder struct {
+	stream *flac.Stream
+	format Format
+	scale  float32
+	frame  *frame.Frame
+	off    int
+	pos    int64
+}
+
+func newFLACDecoder(f *os.File) (Decoder, error) {
+	stream, err := flac.NewSeek(f)
+	if err != nil {
+		return nil, err
+	}
+	info := stream.Info
+	return &flacDecoder{
+		stream: stream,
+		format: Format{SampleRate: int(info.SampleRate), Channels: int(info.NChannels)},
+		scale:  1 / float32(int64(1)<<(info.BitsPerSample-1)),
+	}, nil
+}
+
+func (d *flacDecoder) Format() Format {
+	return d.format
+}
+
+func (d *flacDecoder) Read(p []float32) (int, error) {
+	channels := d.format.Channels
+	n := 0
+	for n+channels <= len(p) {
+		if d.frame == nil || d.off >= d.frame.Subframes[0].NSamples {
+			fr, err := d.stream.ParseNext()
+			if errors.Is(err, io.EOF) {
+				d.frame = nil
+				if n == 0 {
+					return 0, io.EOF
+				}
+				break
+			}
+			if err != nil {
+				return n, err
+			}
+			d.frame, d.off = fr, 0
+		}
+
+		for ; d.off < d.frame.Subframes[0].NSamples && n+channels <= len(p); d.off++ {
+			for ch := 0; ch < channels; ch++ {
+				p[n] = float32(d.frame.Subframes[ch].Samples[d.off]) * d.scale
+				n++
+			}
+			d.pos++
+		}
+	}
+	return n, nil
+}
+
+func (d *flacDecoder) Length() int64 {
+	if d.stream.Info.NSamples == 0 {
+		return -1
+	}
+	return int64(d.stream.Info.NSamples)
+}
+
+func (d *flacDecoder) Position() int64 {
+	return d.pos
+}
+
+// SetPosition lands on the start of the frame holding the target and skips
+// the samples before it.
+func (d *flacDecoder) SetPosition(target int64) error {
+	target = max(0, target)
+	if n := d.Length(); n >= 0 && target >= n {
+		target = n - 1
+	}
+	start, err := d.stream.Seek(uint64(target))
+	if err != nil {
+		return err
+	}
+	fr, err := d.stream.ParseNext()
+	if err != nil {
+		return err
+	}
+	d.frame = fr
+	d.off = int(target - int64(start))
+	d.pos = target
+	return nil
+}
+
+func (d *flacDecoder) Close() error {
+	return d.stream.Close()
+}
+
+// mp3Decoder reads go-mp3's output, which is always 16-bit stereo.
+type mp3Decoder struct {
+	f   *os.File
+	dec *mp3.Decoder
+	buf []byte
+	pos int64
+}
+
+const mp3FrameSize = 4
+
+func newMP3Decoder(f *os.File) (Decoder, error) {
+	dec, err := mp3.NewDecoder(f)
+	if err != nil {
+		return nil, err
+	}
+	return &mp3Decoder{f: f, dec: dec}, nil
+}
+
+func (d *mp3Decoder) Format() Format {
+	return Format{SampleRate: d.dec.SampleRate(), Channels: 2}
+}
+
+func (d *mp3Decoder) Read(p []float32) (int, error) {
+	size := len(p) / 2 * mp3FrameSize
+	if cap(d.buf) < size {
+		d.buf = make([]byte, size)
+	}
+	buf := d.buf[:size]
+	n, err := io.ReadFull(d.dec, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	n -= n % mp3FrameSize
+	if n == 0 {
+		return 0, io.EOF
+	}
+
+	samples := n / 2
+	for i := 0; i < samples; i++ {
+		p[i] = float32(int16(uint16(buf[2*i])|uint16(buf[2*i+1])<<8)) / (1 << 15)
+	}
+	d.pos += int64(n / mp3FrameSize)
+	return samples, nil
+}
+
+func (d *mp3Decoder) Length() int64 {
+	if n := d.dec.Length(); n >= 0 {
+		return n / mp3FrameSize
+	}
+	return -1
+}
+
+func (d *mp3Decoder) Position() int64 {
+	return d.pos
+}
+
+func (d *mp3Decoder) SetPosition(frame int64) error {
+	frame = max(0, frame)
+	if n := d.Length(); n >= 0 {
+		frame = min(frame, n)
+	}
+	if _, err := d.dec.Seek(frame*mp3FrameSize, io.SeekStart); err != nil {
+		return err
+	}
+	d.pos = frame
+	return nil
+}
+
+func (d *mp3Decoder) Close() error {
+	return d.f.Close()
+}
+
+type vorbisDecoder struct {
+	f *os.File
+	r *oggvorbis.Reader
+}
+
+func newVorbisDecoder(f *os.File) (Decoder, error) {
+	r, err := oggvorbis.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	return &vorbisDecoder{f: f, r: r}, nil
+}
+
+func (d *vorbisDecoder) Format() Format {
+	return Format{SampleRate: d.r.SampleRate(), Channels: d.r.Channels()}
+}
+
+func (d *vorbisDecoder) Read(p []float32) (int, error) {
+	channels := d.r.Channels()
+	n, err := d.r.Read(p[:len(p)/channels*channels])
+	if n > 0 && errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return n, err
+}
+
+func (d *vorbisDecoder) Length() int64 {
+	return d.r.Length()
+}
+
+func (d *vorbisDecoder) Position() int64 {
+	return d.r.Position()
+}
+
+func (d *vorbisDecoder) SetPosition(frame int64) error {
+	frame = max(0, frame)
+	if n := d.r.Length(); n > 0 {
+		frame = min(frame, n)
+	}
+	return d.r.SetPosition(frame)
+}
+
+func (d *vorbisDecoder) Close() error {
+	return d.f.Close()
+}
@@ -0,0 +1,558 @@
+package audio
+
+import (
+	"GO_player/internal/logger"
+	"GO_player/internal/orchestrator"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+type State string
+
+const (
+	StateStopped State = "stopped"
+	StatePlaying State = "playing"
+	StatePaused  State = "paused"
+)
+
+const (
+	defaultBufferFrames = 4096
+	defaultPrefetch     = 10 * time.Second
+	// maxOpenFailures is how many songs in a row may fail to open before
+	// playback stops.
+	maxOpenFailures = 8
+)
+
+// Player picks the songs to play and learns from how much of them was heard,
+// returning a handle to what was learned. *app.App and
+// *orchestrator.Orchestrator both implement it.
+type Player interface {
+	PlayNext() (int64, bool)
+	ProcessFeedback(fromID, toID int64, listened, duration float64) (orchestrator.Feedback, bool)
+}
+
+// Preparer is implemented by players that can pick the next song before the
+// current one ends without committing to it. The engine then loads that song
+// early, which is what makes gapless joins and crossfades possible.
+type Preparer interface {
+	PrepareNext() (int64, bool)
+}
+
+// Resolver returns the file of a song.
+type Resolver func(songID int64) (string, error)
+
+// Track is a song that finished playing. Listened only counts what went to
+// the output, so seeking over a part does not count it as heard; the part of
+// a song that is faded out under the next one counts as heard.
+type Track struct {
+	SongID   int64
+	Listened time.Duration
+	Duration time.Duration
+	Skipped  bool
+	// Feedback is what the player learned from the track, to be undone
+	// if it was a mistake. Its ID is 0 when nothing was learned.
+	Feedback orchestrator.Feedback
+}
+
+type Status struct {
+	State    State
+	SongID   int64
+	Position time.Duration
+	Duration time.Duration
+}
+
+type Options struct {
+	// BufferFrames is how many frames are decoded and written at a time.
+	BufferFrames int
+	// Prefetch is how long before the end of a song, or of its crossfade,
+	// the next song is prepared and opened.
+	Prefetch time.Duration
+	// Crossfade is how long songs overlap; 0 joins them gaplessly.
+	Crossfade time.Duration
+	// CrossfadeFor overrides Crossfade for the songs it reports a length
+	// for, the crossfade being the one out of that song.
+	CrossfadeFor func(songID int64) (time.Duration, bool)
+	// GainFor returns the factor the samples of a song are multiplied by,
+	// e.g. to normalize its loudness. Songs it reports nothing for are
+	// played as they are.
+	GainFor func(songID int64) (float64, bool)
+	// OnTrackEnd is called from the playback goroutine once a song has ended
+	// or was skipped and its feedback was sent. It must not call Close.
+	OnTrackEnd func(Track)
+}
+
+// track is an open song. fade is the number of frames it overlaps the next
+// song by.
+type track struct {
+	id       int64
+	dec      Decoder
+	format   Format
+	length   int64
+	fade     int64
+	gain     float32
+	prepared bool
+}
+
+// fadeOut is the end of the previous song while it is mixed under the start
+// of the current one. When the formats differ it is played out on its own
+// first instead.
+type fadeOut struct {
+	dec   Decoder
+	gain  float32
+	left  int64
+	total int64
+	mix   bool
+}
+
+// Engine plays the songs a Player picks, one after another, and sends the
+// listened and total time of each back to it as feedback. Songs that fail to
+// open are passed over without feedback.
+//
+// The song after the current one is prepared ahead of time but only played,
+// and so only recorded by the Player, once the current song's feedback has
+// been sent: when it ends, or when its crossfade starts.
+type Engine struct {
+	player  Player
+	resolve Resolver
+	out     Output
+	opts    Options
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	wg       sync.WaitGroup
+	state    State
+	running  bool
+	closed   bool
+	skip     bool
+	seek     int64
+	seeking  bool
+	songID   int64
+	fromID   int64
+	lastID   int64
+	format   Format
+	length   int64
+	pos      int64
+	listened int64
+}
+
+func NewEngine(player Player, resolve Resolver, out Output, opts Options) *Engine {
+	if opts.BufferFrames <= 0 {
+		opts.BufferFrames = defaultBufferFrames
+	}
+	if opts.Prefetch <= 0 {
+		opts.Prefetch = defaultPrefetch
+	}
+	e := &Engine{
+		player:  player,
+		resolve: resolve,
+		out:     out,
+		opts:    opts,
+		state:   StateStopped,
+	}
+	e.cond = sync.NewCond(&e.mu)
+	return e
+}
+
+// Play starts playback, or resumes it when paused.
+func (e *Engine) Play() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return errors.New("engine is closed")
+	}
+
+	e.state = StatePlaying
+	if !e.running {
+		e.running = true
+		e.wg.Add(1)
+		go e.run()
+	}
+	e.cond.Broadcast()
+	return nil
+}
+
+func (e *Engine) Pause() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.state == StatePlaying {
+		e.state = StatePaused
+	}
+}
+
+// Skip ends the current song as it is and moves to the next one.
+func (e *Engine) Skip() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.songID != 0 {
+		e.skip = true
+		e.cond.Broadcast()
+	}
+}
+
+// Seek moves within the current song.
+func (e *Engine) Seek(pos time.Duration) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.songID == 0 {
+		return errors.New("nothing is playing")
+	}
+
+	frame := max(0, e.format.Frames(pos))
+	if e.length >= 0 {
+		frame = min(frame, e.length)
+	}
+	e.seek, e.seeking = frame, true
+	e.pos = frame
+	return nil
+}
+
+func (e *Engine) Status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	s := Status{State: e.state, SongID: e.songID, Position: e.format.Duration(e.pos)}
+	if e.length >= 0 {
+		s.Duration = e.format.Duration(e.length)
+	}
+	return s
+}
+
+// Wait blocks until playback stops, either because the Player has no more
+// songs or because the engine was closed.
+func (e *Engine) Wait() {
+	e.wg.Wait()
+}
+
+// Close stops playback and closes the output. The song being played gets no
+// feedback, so shutting down does not count as a skip.
+func (e *Engine) Close() error {
+	e.mu.Lock()
+	e.closed = true
+	e.cond.Broadcast()
+	e.mu.Unlock()
+
+	e.wg.Wait()
+	return e.out.Close()
+}
+
+func (e *Engine) run() {
+	defer e.wg.Done()
+
+	var cur, next *track
+	var tail *fadeOut
+	var buf, mixBuf []float32
+	var outFormat Format
+	defer func() {
+		for _, t := range []*track{cur, next} {
+			if t != nil {
+				t.dec.Close()
+			}
+		}
+		if tail != nil {
+			tail.dec.Close()
+		}
+		e.mu.Lock()
+		e.running = false
+		e.state = StateStopped
+		e.songID = 0
+		e.mu.Unlock()
+	}()
+
+	write := func(format Format, samples []float32) bool {
+		if format != outFormat {
+			if err := e.out.Open(format); err != nil {
+				logger.Error("audio", "opening output failed", err)
+				return false
+			}
+			outFormat = format
+		}
+		if err := e.out.Write(samples); err != nil {
+			logger.Error("audio", "writing output failed", err)
+			return false
+		}
+		return true
+	}
+
+	for {
+		if cur == nil && tail == nil {
+			cur, next = e.openNext(next), nil
+			if cur == nil {
+				return
+			}
+		}
+
+		e.mu.Lock()
+		for e.state == StatePaused && !e.closed && !e.skip {
+			e.cond.Wait()
+		}
+		if e.closed {
+			e.mu.Unlock()
+			return
+		}
+		if e.skip {
+			e.skip = false
+			e.mu.Unlock()
+			if tail != nil {
+				tail.dec.Close()
+				tail = nil
+			}
+			if cur != nil {
+				e.finish(cur, true, 0)
+				cur.dec.Close()
+				cur = nil
+			}
+			continue
+		}
+		if e.seeking && cur != nil {
+			e.seeking = false
+			if tail != nil {
+				tail.dec.Close()
+				tail = nil
+			}
+			if err := cur.dec.SetPosition(e.seek); err != nil {
+				logger.Error("audio", "seek failed", err)
+			}
+			e.pos = cur.dec.Position()
+		}
+		e.mu.Unlock()
+
+		// The previous song is played out on its own when it cannot be
+		// mixed or when nothing follows it.
+		if tail != nil && (cur == nil || !tail.mix) {
+			buf = grow(buf, e.opts.BufferFrames*tail.dec.Format().Channels)
+			n, err := tail.dec.Read(buf)
+			applyGain(buf[:n], tail.gain)
+			if n > 0 && !write(tail.dec.Format(), buf[:n]) {
+				return
+			}
+			if err != nil || n == 0 {
+				tail.dec.Close()
+				tail = nil
+			}
+			continue
+		}
+
+		remaining := int64(-1)
+		if cur.length >= 0 {
+			remaining = cur.length - cur.dec.Position()
+		}
+		if next == nil && !cur.prepared && remaining >= 0 && remaining <= e.prefetch(cur) {
+			cur.prepared = true
+			next = e.prepare()
+		}
+		channels := cur.format.Channels
+		frames := e.opts.BufferFrames
+		if tail == nil && next != nil && next.format == cur.format && remaining >= 0 {
+			fade := crossfade(cur, next)
+			if fade > 0 && remaining <= fade {
+				e.finish(cur, false, remaining)
+				tail = &fadeOut{dec: cur.dec, gain: cur.gain, left: remaining, total: remaining}
+				cur, next = e.openNext(next), nil
+				tail.mix = cur != nil && cur.format == tail.dec.Format()
+				continue
+			}
+			if fade > 0 {
+				// Stop right where the crossfade starts.
+				frames = int(min(int64(frames), remaining-fade))
+			}
+		}
+		buf = grow(buf, frames*channels)
+		n, err := cur.dec.Read(buf[:frames*channels])
+		applyGain(buf[:n], cur.gain)
+		if tail != nil && n > 0 {
+			mixBuf = grow(mixBuf, n)
+			m, terr := tail.dec.Read(mixBuf[:n])
+			applyGain(mixBuf[:m], tail.gain)
+			mixIn(buf[:n], mixBuf[:m], channels, tail.total-tail.left, tail.total)
+			tail.left -= int64(m / channels)
+			if terr != nil || tail.left <= 0 {
+				tail.dec.Close()
+				tail = nil
+			}
+		}
+		if n > 0 && !write(cur.format, buf[:n]) {
+			return
+		}
+
+		e.mu.Lock()
+		e.pos = cur.dec.Position()
+		e.listened += int64(n / channels)
+		e.mu.Unlock()
+
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				logger.Error("audio", "decoding failed", err)
+			}
+			e.finish(cur, false, 0)
+			cur.dec.Close()
+			cur = nil
+			if tail != nil {
+				tail.dec.Close()
+				tail = nil
+			}
+		}
+	}
+}
+
+// prefetch returns how many frames before its end the song following t is
+// prepared. Without a Preparer nothing is prepared.
+func (e *Engine) prefetch(t *track) int64 {
+	if _, ok := e.player.(Preparer); !ok {
+		return -1
+	}
+	return t.format.Frames(e.opts.Prefetch) + t.fade
+}
+
+func (e *Engine) prepare() *track {
+	songID, ok := e.player.(Preparer).PrepareNext()
+	if !ok {
+		return nil
+	}
+	t, err := e.open(songID)
+	if err != nil {
+		logger.Error("audio", "preparing song failed", err)
+		return nil
+	}
+	return t
+}
+
+// crossfade returns how many frames cur and next overlap: the crossfade of
+// cur, limited to half of either song.
+func crossfade(cur, next *track) int64 {
+	fade := cur.fade
+	if next.length >= 0 {
+		fade = min(fade, next.length/2)
+	}
+	return fade
+}
+
+// mixIn fades in the frames of dst over the frames of src, which fade out.
+// done is how many frames of the fade have been played before.
+func mixIn(dst, src []float32, channels int, done, total int64) {
+	for i := 0; i < len(dst); i += channels {
+		t := float32(done+int64(i/channels)) / float32(total)
+		t = min(t, 1)
+		for ch := 0; ch < channels; ch++ {
+			v := dst[i+ch] * t
+			if i+ch < len(src) {
+				v += src[i+ch] * (1 - t)
+			}
+			dst[i+ch] = v
+		}
+	}
+}
+
+func applyGain(samples []float32, gain float32) {
+	if gain == 1 {
+		return
+	}
+	for i := range samples {
+		samples[i] *= gain
+	}
+}
+
+func grow(buf []float32, n int) []float32 {
+	if cap(buf) < n {
+		return make([]float32, n)
+	}
+	return buf[:n]
+}
+
+// openNext commits to the next song and opens it, reusing the prepared one
+// when the Player picked the same song.
+func (e *Engine) openNext(prepared *track) *track {
+	defer func() {
+		if prepared != nil {
+			prepared.dec.Close()
+		}
+	}()
+
+	for failures := 0; failures < maxOpenFailures; {
+		songID, ok := e.player.PlayNext()
+		if !ok {
+			return nil
+		}
+
+		t := prepared
+		if t != nil && t.id == songID {
+			prepared = nil
+		} else {
+			var err error
+			if t, err = e.open(songID); err != nil {
+				logger.Error("audio", "opening song failed", err)
+				failures++
+				continue
+			}
+		}
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if e.closed {
+			t.dec.Close()
+			return nil
+		}
+		e.songID, e.fromID = songID, e.lastID
+		e.format = t.format
+		e.length = t.length
+		e.pos, e.listened = t.dec.Position(), 0
+		e.seeking = false
+		return t
+	}
+	return nil
+}
+
+func (e *Engine) open(songID int64) (*track, error) {
+	path, err := e.resolve(songID)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &track{id: songID, dec: dec, format: dec.Format(), length: dec.Length(), gain: 1}
+	if e.opts.GainFor != nil {
+		if g, ok := e.opts.GainFor(songID); ok {
+			t.gain = float32(g)
+		}
+	}
+	fade := e.opts.Crossfade
+	if e.opts.CrossfadeFor != nil {
+		if d, ok := e.opts.CrossfadeFor(songID); ok {
+			fade = d
+		}
+	}
+	t.fade = max(0, t.format.Frames(fade))
+	if t.length >= 0 {
+		t.fade = min(t.fade, t.length/2)
+	}
+	return t, nil
+}
+
+// finish sends the feedback of a song that ended, was skipped, or is about to
+// fade out with extra frames left to play. When the length of a skipped song
+// is unknown there is nothing to compare with, so it gets no feedback.
+func (e *Engine) finish(t *track, skipped bool, extra int64) {
+	e.mu.Lock()
+	track := Track{SongID: t.id, Listened: e.format.Duration(e.listened + extra), Skipped: skipped}
+	fromID := e.fromID
+	length := t.length
+	if length < 0 && !skipped {
+		length = t.dec.Position()
+	}
+	track.Duration = e.format.Duration(length)
+	e.lastID = t.id
+	e.songID = 0
+	e.pos, e.length = 0, 0
+	e.mu.Unlock()
+
+	if track.Duration > 0 {
+		track.Feedback, _ = e.player.ProcessFeedback(fromID, track.SongID, track.Listened.Seconds(), track.Duration.Seconds())
+	}
+	if e.opts.OnTrackEnd != nil {
+		e.opts.OnTrackEnd(track)
+	}
+}
@@ -0,0 +1,375 @@
+package audio
+
+import (
+	"GO_player/internal/orchestrator"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testRate = 8000
+
+var testFormat = Format{SampleRate: testRate, Channels: 2}
+
+// feedbackCall is one ProcessFeedback call, in frames of testFormat.
+type feedbackCall struct {
+	fromID, toID       int64
+	listened, duration int64
+}
+
+type testPlayer interface {
+	Player
+	calls() []feedbackCall
+}
+
+// fakePlayer plays its songs in order and records the feedback it gets.
+type fakePlayer struct {
+	mu       sync.Mutex
+	songs    []int64
+	feedback []feedbackCall
+}
+
+func (p *fakePlayer) PlayNext() (int64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.songs) == 0 {
+		return 0, false
+	}
+	id := p.songs[0]
+	p.songs = p.songs[1:]
+	return id, true
+}
+
+func (p *fakePlayer) ProcessFeedback(fromID, toID int64, listened, duration float64) (orchestrator.Feedback, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	frames := func(seconds float64) int64 {
+		return int64(math.Round(seconds * testRate))
+	}
+	p.feedback = append(p.feedback, feedbackCall{fromID, toID, frames(listened), frames(duration)})
+	return orchestrator.Feedback{}, false
+}
+
+func (p *fakePlayer) calls() []feedbackCall {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]feedbackCall(nil), p.feedback...)
+}
+
+// fakePreparer also lets the engine open the next song early.
+type fakePreparer struct {
+	fakePlayer
+}
+
+func (p *fakePreparer) PrepareNext() (int64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.songs) == 0 {
+		return 0, false
+	}
+	return p.songs[0], true
+}
+
+// hookOutput calls hook once, from the playback goroutine, after at frames
+// were written.
+type hookOutput struct {
+	Output
+	written int64
+	at      int64
+	hook    func()
+}
+
+func (o *hookOutput) Write(samples []float32) error {
+	if err := o.Output.Write(samples); err != nil {
+		return err
+	}
+	o.written += int64(len(samples) / testFormat.Channels)
+	if o.hook != nil && o.written >= o.at {
+		hook := o.hook
+		o.hook = nil
+		hook()
+	}
+	return nil
+}
+
+// writeSong writes a song of the given length whose samples all have value.
+func writeSong(t *testing.T, dir string, id, frames int64, value float32) string {
+	t.Helper()
+	path := filepath.Join(dir, fmt.Sprintf("%d.wav", id))
+	out, err := CreateWAV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := make([]float32, frames*int64(testFormat.Channels))
+	for i := range samples {
+		samples[i] = value
+	}
+	if err := out.Open(testFormat); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Write(samples); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readSamples returns the interleaved samples of a WAV file.
+func readSamples(t *testing.T, path string) []float32 {
+	t.Helper()
+	dec, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+
+	var res []float32
+	buf := make([]float32, 1024)
+	for {
+		n, err := dec.Read(buf)
+		res = append(res, buf[:n]...)
+		if errors.Is(err, io.EOF) {
+			return res
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+type engineTest struct {
+	lengths []int64
+	opts    Options
+	// at and action, when set, act on the engine once at frames were played.
+	at     int64
+	action func(e *Engine)
+}
+
+// songValue is the value of every sample of a song, telling songs apart in
+// the output.
+func songValue(id int64) float32 {
+	return 0.1 * float32(id)
+}
+
+// run plays songs 1, 2, ... of the given lengths into a WAV file and returns
+// what was written and the feedback the player got.
+func (tc engineTest) run(t *testing.T, player testPlayer) ([]float32, []feedbackCall, []Track) {
+	t.Helper()
+	dir := t.TempDir()
+	paths := make(map[int64]string)
+	for i, frames := range tc.lengths {
+		id := int64(i + 1)
+		paths[id] = writeSong(t, dir, id, frames, songValue(id))
+	}
+
+	outPath := filepath.Join(dir, "out.wav")
+	wav, err := CreateWAV(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &hookOutput{Output: wav}
+
+	var mu sync.Mutex
+	var tracks []Track
+	opts := tc.opts
+	opts.OnTrackEnd = func(track Track) {
+		mu.Lock()
+		defer mu.Unlock()
+		tracks = append(tracks, track)
+	}
+	resolve := func(songID int64) (string, error) {
+		return paths[songID], nil
+	}
+	e := NewEngine(player, resolve, out, opts)
+	if tc.action != nil {
+		out.at, out.hook = tc.at, func() { tc.action(e) }
+	}
+
+	if err := e.Play(); err != nil {
+		t.Fatal(err)
+	}
+	e.Wait()
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return readSamples(t, outPath), player.calls(), tracks
+}
+
+func newPreparer(n int) *fakePreparer {
+	p := &fakePreparer{}
+	for i := range n {
+		p.songs = append(p.songs, int64(i+1))
+	}
+	return p
+}
+
+func assertFeedback(t *testing.T, got, want []feedbackCall) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("feedback %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("feedback %d is %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func frames(samples []float32) int64 {
+	return int64(len(samples) / testFormat.Channels)
+}
+
+// assertValue checks that the output at frame holds the given value, up to
+// the 16-bit rounding of the WAV files.
+func assertValue(t *testing.T, out []float32, frame int64, want float32) {
+	t.Helper()
+	if frame >= frames(out) {
+		t.Fatalf("frame %d is past the output of %d frames", frame, frames(out))
+	}
+	for ch := range testFormat.Channels {
+		got := out[frame*int64(testFormat.Channels)+int64(ch)]
+		if math.Abs(float64(got-want)) > 1e-3 {
+			t.Fatalf("frame %d is %v on channel %d, want %v", frame, got, ch, want)
+		}
+	}
+}
+
+func TestEngineGapless(t *testing.T) {
+	// Without a Preparer the next song is only opened once the current one
+	// ended, which must not leave a gap either.
+	for _, player := range []testPlayer{&newPreparer(3).fakePlayer, newPreparer(3)} {
+		tc := engineTest{
+			lengths: []int64{1000, 1500, 777},
+			opts:    Options{BufferFrames: 256, Prefetch: 50 * time.Millisecond},
+		}
+		out, calls, tracks := tc.run(t, player)
+
+		if frames(out) != 1000+1500+777 {
+			t.Fatalf("%T: output has %d frames, want %d", player, frames(out), 1000+1500+777)
+		}
+		assertValue(t, out, 999, songValue(1))
+		assertValue(t, out, 1000, songValue(2))
+		assertValue(t, out, 2499, songValue(2))
+		assertValue(t, out, 2500, songValue(3))
+		assertFeedback(t, calls, []feedbackCall{
+			{0, 1, 1000, 1000},
+			{1, 2, 1500, 1500},
+			{2, 3, 777, 777},
+		})
+		for _, track := range tracks {
+			if track.Skipped || track.Listened != track.Duration {
+				t.Fatalf("%T: track %+v", player, track)
+			}
+		}
+	}
+}
+
+func TestEngineCrossfade(t *testing.T) {
+	// 100ms is 800 frames; the buffer does not divide the songs, so the last
+	// read before each crossfade is cut short.
+	tc := engineTest{
+		lengths: []int64{4000, 3000, 1000},
+		opts:    Options{BufferFrames: 300, Prefetch: 50 * time.Millisecond, Crossfade: 100 * time.Millisecond},
+	}
+	out, calls, _ := tc.run(t, newPreparer(3))
+
+	// The last crossfade is limited to half of the last song.
+	want := int64(4000 + 3000 + 1000 - 800 - 500)
+	if frames(out) != want {
+		t.Fatalf("output has %d frames, want %d", frames(out), want)
+	}
+	assertValue(t, out, 3199, songValue(1))
+	assertValue(t, out, 3600, (songValue(1)+songValue(2))/2)
+	assertValue(t, out, 4000, songValue(2))
+	assertValue(t, out, 5699, songValue(2))
+	assertValue(t, out, 6200, songValue(3))
+	assertValue(t, out, want-1, songValue(3))
+	// The part faded out under the next song counts as heard.
+	assertFeedback(t, calls, []feedbackCall{
+		{0, 1, 4000, 4000},
+		{1, 2, 3000, 3000},
+		{2, 3, 1000, 1000},
+	})
+}
+
+func TestEngineSkip(t *testing.T) {
+	tc := engineTest{
+		lengths: []int64{4000, 1000},
+		opts:    Options{BufferFrames: 250, Prefetch: 50 * time.Millisecond, Crossfade: 100 * time.Millisecond},
+		at:      1000,
+		action:  func(e *Engine) { e.Skip() },
+	}
+	out, calls, tracks := tc.run(t, newPreparer(2))
+
+	if frames(out) != 1000+1000 {
+		t.Fatalf("output has %d frames, want %d", frames(out), 2000)
+	}
+	assertValue(t, out, 999, songValue(1))
+	assertValue(t, out, 1000, songValue(2))
+	assertFeedback(t, calls, []feedbackCall{
+		{0, 1, 1000, 4000},
+		{1, 2, 1000, 1000},
+	})
+	if len(tracks) != 2 || !tracks[0].Skipped || tracks[1].Skipped {
+		t.Fatalf("tracks %+v", tracks)
+	}
+}
+
+func TestEngineSeek(t *testing.T) {
+	// Seeking over a part of a song does not count it as heard.
+	tc := engineTest{
+		lengths: []int64{4000, 1000},
+		opts:    Options{BufferFrames: 250, Prefetch: 50 * time.Millisecond},
+		at:      1000,
+		action: func(e *Engine) {
+			if err := e.Seek(375 * time.Millisecond); err != nil {
+				t.Error(err)
+			}
+		},
+	}
+	out, calls, _ := tc.run(t, newPreparer(2))
+
+	if frames(out) != 1000+1000+1000 {
+		t.Fatalf("output has %d frames, want %d", frames(out), 3000)
+	}
+	assertValue(t, out, 1999, songValue(1))
+	assertValue(t, out, 2000, songValue(2))
+	assertFeedback(t, calls, []feedbackCall{
+		{0, 1, 2000, 4000},
+		{1, 2, 1000, 1000},
+	})
+}
+
+func TestEngineSeekIntoCrossfade(t *testing.T) {
+	// Seeking to 400 frames before the end, within the 800 frames of the
+	// crossfade, fades out what is left.
+	tc := engineTest{
+		lengths: []int64{4000, 2000},
+		opts:    Options{BufferFrames: 250, Prefetch: 50 * time.Millisecond, Crossfade: 100 * time.Millisecond},
+		at:      1000,
+		action: func(e *Engine) {
+			if err := e.Seek(450 * time.Millisecond); err != nil {
+				t.Error(err)
+			}
+		},
+	}
+	out, calls, _ := tc.run(t, newPreparer(2))
+
+	if frames(out) != 1000+2000 {
+		t.Fatalf("output has %d frames, want %d", frames(out), 3000)
+	}
+	assertValue(t, out, 999, songValue(1))
+	assertValue(t, out, 1200, (songValue(1)+songValue(2))/2)
+	assertValue(t, out, 1400, songValue(2))
+	assertFeedback(t, calls, []feedbackCall{
+		{0, 1, 1400, 4000},
+		{1, 2, 2000, 2000},
+	})
+}
@@ -0,0 +1,37 @@
+package audio
+
+import (
+	"time"
+)
+
+// Output is where the engine sends decoded samples. Open is called before the
+// first Write and again whenever the format changes between songs. Write may
+// block to pace playback.
+type Output interface {
+	Open(format Format) error
+	Write(samples []float32) error
+	Close() error
+}
+
+// NullOutput discards what is played. With Realtime set it takes as long as
+// the samples would take to play, otherwise it returns at once.
+type NullOutput struct {
+	Realtime bool
+	format   Format
+}
+
+func (o *NullOutput) Open(format Format) error {
+	o.format = format
+	return nil
+}
+
+func (o *NullOutput) Write(samples []float32) error {
+	if o.Realtime && o.format.Channels > 0 {
+		time.Sleep(o.format.Duration(int64(len(samples) / o.format.Channels)))
+	}
+	return nil
+}
+
+func (o *NullOutput) Close() error {
+	return nil
+}
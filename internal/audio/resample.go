@@ -0,0 +1,67 @@
+package audio
+
+// resampler converts interleaved samples from one format to another. Channels
+// are mapped first, mono being spread to every channel and anything going to
+// mono being averaged, and the rate is then converted by linear interpolation.
+// It keeps the last frame of each call so that songs join without clicks.
+type resampler struct {
+	from, to Format
+	step     float64
+	pos      float64
+	prev     []float32
+	frames   []float32
+	out      []float32
+}
+
+func newResampler(from, to Format) *resampler {
+	return &resampler{
+		from: from,
+		to:   to,
+		step: float64(from.SampleRate) / float64(to.SampleRate),
+	}
+}
+
+// convert returns samples in the target format. The result is reused by the
+// next call.
+func (r *resampler) convert(samples []float32) []float32 {
+	ch := r.to.Channels
+	r.frames = append(r.frames[:0], r.prev...)
+	for i := 0; i+r.from.Channels <= len(samples); i += r.from.Channels {
+		r.frames = r.mapFrame(r.frames, samples[i:i+r.from.Channels])
+	}
+	n := len(r.frames) / ch
+	if n == 0 {
+		return r.out[:0]
+	}
+
+	r.out = r.out[:0]
+	for ; r.pos < float64(n-1); r.pos += r.step {
+		i := int(r.pos)
+		t := float32(r.pos - float64(i))
+		a, b := r.frames[i*ch:(i+1)*ch], r.frames[(i+1)*ch:(i+2)*ch]
+		for c := range ch {
+			r.out = append(r.out, a[c]*(1-t)+b[c]*t)
+		}
+	}
+	r.pos -= float64(n - 1)
+	r.prev = append(r.prev[:0], r.frames[(n-1)*ch:]...)
+	return r.out
+}
+
+func (r *resampler) mapFrame(dst, frame []float32) []float32 {
+	switch {
+	case len(frame) == r.to.Channels:
+		return append(dst, frame...)
+	case r.to.Channels == 1:
+		var sum float32
+		for _, s := range frame {
+			sum += s
+		}
+		return append(dst, sum/float32(len(frame)))
+	default:
+		for c := range r.to.Channels {
+			dst = append(dst, frame[c%len(frame)])
+		}
+		return dst
+	}
+}
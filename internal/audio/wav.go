@@ -0,0 +1,285 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+type wavDecoder struct {
+	f          *os.File
+	format     Format
+	encoding   uint16
+	bits       int
+	blockAlign int
+	dataOffset int64
+	frames     int64
+	pos        int64
+	buf        []byte
+}
+
+func newWAVDecoder(f *os.File) (Decoder, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(f, riff[:]); err != nil {
+		return nil, err
+	}
+	if string(riff[:4]) != "RIFF" || string(riff[8:]) != "WAVE" {
+		return nil, errors.New("not a WAVE file")
+	}
+
+	d := &wavDecoder{f: f}
+	hasFormat := false
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(f, chunk[:]); err != nil {
+			return nil, errors.New("no data chunk")
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+
+		switch string(chunk[:4]) {
+		case "fmt ":
+			if size < 16 {
+				return nil, errors.New("short fmt chunk")
+			}
+			body := make([]byte, size+size&1)
+			if _, err := io.ReadFull(f, body); err != nil {
+				return nil, err
+			}
+			d.encoding = binary.LittleEndian.Uint16(body)
+			d.format.Channels = int(binary.LittleEndian.Uint16(body[2:]))
+			d.format.SampleRate = int(binary.LittleEndian.Uint32(body[4:]))
+			d.blockAlign = int(binary.LittleEndian.Uint16(body[12:]))
+			d.bits = int(binary.LittleEndian.Uint16(body[14:]))
+			if d.encoding == wavFormatExtensible && size >= 26 {
+				d.encoding = binary.LittleEndian.Uint16(body[24:])
+			}
+			hasFormat = true
+		case "data":
+			if !hasFormat {
+				return nil, errors.New("data chunk before fmt chunk")
+			}
+			if err := d.validate(); err != nil {
+				return nil, err
+			}
+			offset, err := f.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			end, err := f.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, err
+			}
+			d.dataOffset = offset
+			d.frames = min(size, end-offset) / int64(d.blockAlign)
+			return d, d.SetPosition(0)
+		default:
+			if _, err := f.Seek(size+size&1, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (d *wavDecoder) validate() error {
+	if d.format.Channels <= 0 || d.format.SampleRate <= 0 {
+		return errors.New("bad WAVE format")
+	}
+	switch {
+	case d.encoding == wavFormatPCM && (d.bits == 8 || d.bits == 16 || d.bits == 24 || d.bits == 32):
+	case d.encoding == wavFormatFloat && (d.bits == 32 || d.bits == 64):
+	default:
+		return ErrUnsupported
+	}
+	if d.blockAlign != d.format.Channels*d.bits/8 {
+		return errors.New("bad WAVE block alignment")
+	}
+	return nil
+}
+
+func (d *wavDecoder) Format() Format {
+	return d.format
+}
+
+func (d *wavDecoder) Read(p []float32) (int, error) {
+	frames := min(int64(len(p)/d.format.Channels), d.frames-d.pos)
+	if frames <= 0 {
+		if d.pos >= d.frames {
+			return 0, io.EOF
+		}
+		return 0, nil
+	}
+
+	size := int(frames) * d.blockAlign
+	if cap(d.buf) < size {
+		d.buf = make([]byte, size)
+	}
+	buf := d.buf[:size]
+	n, err := io.ReadFull(d.f, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, err
+	}
+	frames = int64(n / d.blockAlign)
+	if frames == 0 {
+		d.pos = d.frames
+		return 0, io.EOF
+	}
+
+	width := d.bits / 8
+	samples := int(frames) * d.format.Channels
+	for i := 0; i < samples; i++ {
+		p[i] = d.sample(buf[i*width:])
+	}
+	d.pos += frames
+	return samples, nil
+}
+
+func (d *wavDecoder) sample(b []byte) float32 {
+	switch {
+	case d.encoding == wavFormatFloat && d.bits == 32:
+		return math.Float32frombits(binary.LittleEndian.Uint32(b))
+	case d.encoding == wavFormatFloat:
+		return float32(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+	case d.bits == 8:
+		return float32(int(b[0])-128) / 128
+	case d.bits == 16:
+		return float32(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+	case d.bits == 24:
+		v := int32(b[0]) | int32(b[1])<<8 | int32(int8(b[2]))<<16
+		return float32(v) / (1 << 23)
+	default:
+		return float32(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+	}
+}
+
+func (d *wavDecoder) Length() int64 {
+	return d.frames
+}
+
+func (d *wavDecoder) Position() int64 {
+	return d.pos
+}
+
+func (d *wavDecoder) SetPosition(frame int64) error {
+	frame = max(0, min(frame, d.frames))
+	if _, err := d.f.Seek(d.dataOffset+frame*int64(d.blockAlign), io.SeekStart); err != nil {
+		return err
+	}
+	d.pos = frame
+	return nil
+}
+
+func (d *wavDecoder) Close() error {
+	return d.f.Close()
+}
+
+// WAVOutput writes what is played to a 16-bit PCM WAVE file. All songs go
+// into the same file, in the format of the first one; songs in another format
+// are converted to it.
+type WAVOutput struct {
+	w      io.WriteSeeker
+	closer io.Closer
+	format Format
+	opened bool
+	conv   *resampler
+	size   int64
+	buf    []byte
+}
+
+func NewWAVOutput(w io.WriteSeeker) *WAVOutput {
+	return &WAVOutput{w: w}
+}
+
+// CreateWAV creates the file at path and writes to it. Close closes the file.
+func CreateWAV(path string) (*WAVOutput, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	out := NewWAVOutput(f)
+	out.closer = f
+	return out, nil
+}
+
+func (o *WAVOutput) Open(format Format) error {
+	if format.SampleRate <= 0 || format.Channels <= 0 {
+		return errors.New("wav output needs a sample rate and channels")
+	}
+	if o.opened {
+		o.conv = nil
+		if format != o.format {
+			o.conv = newResampler(format, o.format)
+		}
+		return nil
+	}
+	o.format = format
+	o.opened = true
+	return o.writeHeader()
+}
+
+func (o *WAVOutput) Write(samples []float32) error {
+	if !o.opened {
+		return errors.New("wav output is not open")
+	}
+	if o.conv != nil {
+		samples = o.conv.convert(samples)
+	}
+	if cap(o.buf) < len(samples)*2 {
+		o.buf = make([]byte, len(samples)*2)
+	}
+	buf := o.buf[:len(samples)*2]
+	for i, s := range samples {
+		s = max(-1, min(1, s))
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(int16(s*math.MaxInt16)))
+	}
+	n, err := o.w.Write(buf)
+	o.size += int64(n)
+	return err
+}
+
+// Close fills in the sizes left open in the header.
+func (o *WAVOutput) Close() error {
+	var err error
+	if o.opened {
+		err = o.writeHeader()
+	}
+	if o.closer != nil {
+		if cerr := o.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (o *WAVOutput) writeHeader() error {
+	if _, err := o.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var hdr [44]byte
+	channels := o.format.Channels
+	copy(hdr[0:], "RIFF")
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(36+o.size))
+	copy(hdr[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(hdr[16:], 16)
+	binary.LittleEndian.PutUint16(hdr[20:], wavFormatPCM)
+	binary.LittleEndian.PutUint16(hdr[22:], uint16(channels))
+	binary.LittleEndian.PutUint32(hdr[24:], uint32(o.format.SampleRate))
+	binary.LittleEndian.PutUint32(hdr[28:], uint32(o.format.SampleRate*channels*2))
+	binary.LittleEndian.PutUint16(hdr[32:], uint16(channels*2))
+	binary.LittleEndian.PutUint16(hdr[34:], 16)
+	copy(hdr[36:], "data")
+	binary.LittleEndian.PutUint32(hdr[40:], uint32(o.size))
+	if _, err := o.w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := o.w.Seek(0, io.SeekEnd)
+	return err
+}
@@ -0,0 +1,157 @@
+package bundle
+
+import (
+	"GO_player/internal/catalog"
+	"GO_player/internal/models"
+	"GO_player/internal/playback"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+const Version = 1
+
+// Song is a catalog song together with the hash of its file, when the file
+// could be read at export time, so that it can be found again on a machine
+// where the music lives under another path.
+type Song struct {
+	models.Song
+	Hash string `json:"hash,omitempty"`
+}
+
+type Graph struct {
+	AlbumID int64                       `json:"album_id"`
+	Edges   map[int64]map[int64]float64 `json:"edges"`
+}
+
+type Session struct {
+	AlbumID int64                   `json:"album_id"`
+	Chain   *playback.PlaybackChain `json:"chain"`
+}
+
+// Bundle is everything a profile has learned, in a form that does not depend
+// on the storage backend.
+type Bundle struct {
+	Version        int                         `json:"version"`
+	CreatedAt      time.Time                   `json:"created_at"`
+	Profile        string                      `json:"profile"`
+	Songs          []Song                      `json:"songs"`
+	Albums         []*models.Album             `json:"albums"`
+	Graphs         []Graph                     `json:"graphs"`
+	Library        map[int64]map[int64]float64 `json:"library"`
+	Sessions       []Session                   `json:"sessions"`
+	LibrarySession *playback.PlaybackChain     `json:"library_session"`
+	History        []*models.PlayEvent         `json:"history"`
+	Playlists      []*models.Playlist          `json:"playlists,omitempty"`
+	Ratings        []*models.Rating            `json:"ratings,omitempty"`
+}
+
+// Export collects the songs, albums, graphs, playback sessions, history,
+// playlists and ratings of the catalog's profile.
+func Export(cat catalog.Catalog) (*Bundle, error) {
+	b := &Bundle{Version: Version, CreatedAt: time.Now().UTC(), Profile: cat.Profile()}
+
+	songs, err := cat.ListSongs()
+	if err != nil {
+		return nil, err
+	}
+	for _, song := range songs {
+		hash, _ := hashFile(song.Path)
+		b.Songs = append(b.Songs, Song{Song: *song, Hash: hash})
+	}
+
+	if b.Albums, err = cat.ListAlbums(); err != nil {
+		return nil, err
+	}
+
+	graphIDs, err := cat.ListBaseGraphIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, albumID := range graphIDs {
+		edges, err := cat.LoadBaseGraphEdges(albumID)
+		if err != nil {
+			return nil, err
+		}
+		b.Graphs = append(b.Graphs, Graph{AlbumID: albumID, Edges: edges})
+	}
+
+	if b.Library, err = cat.LoadLibraryGraphEdges(); err != nil {
+		return nil, err
+	}
+
+	for _, albumID := range sessionAlbumIDs(b.Albums, graphIDs) {
+		chain, err := cat.LoadAlbumPlaybackSession(albumID)
+		if err != nil {
+			return nil, err
+		}
+		if !emptyChain(chain) {
+			b.Sessions = append(b.Sessions, Session{AlbumID: albumID, Chain: chain})
+		}
+	}
+
+	chain, err := cat.LoadLibraryPlaybackSession()
+	if err != nil {
+		return nil, err
+	}
+	if !emptyChain(chain) {
+		b.LibrarySession = chain
+	}
+
+	if b.History, err = cat.ListPlayEvents(time.Time{}, time.Time{}); err != nil {
+		return nil, err
+	}
+	if b.Playlists, err = cat.ListPlaylists(); err != nil {
+		return nil, err
+	}
+	if b.Ratings, err = cat.ListRatings(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// sessionAlbumIDs lists the albums that may have a playback session: every
+// known album and every album with a graph.
+func sessionAlbumIDs(albums []*models.Album, graphIDs []int64) []int64 {
+	seen := make(map[int64]bool)
+	var ids []int64
+	for _, album := range albums {
+		if !seen[album.ID] {
+			seen[album.ID] = true
+			ids = append(ids, album.ID)
+		}
+	}
+	for _, id := range graphIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func emptyChain(chain *playback.PlaybackChain) bool {
+	return chain == nil || (chain.Current == 0 && len(chain.BackStack) == 0 &&
+		len(chain.ForwardStack) == 0 && len(chain.Queue) == 0)
+}
+
+func hashFile(path string) (string, error) {
+	if path == "" {
+		return "", os.ErrNotExist
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
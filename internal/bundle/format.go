@@ -0,0 +1,182 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatTar  Format = "tar"
+)
+
+// manifest is the first file of a tar bundle. The other parts are stored as
+// one JSON file each, with a file per album graph under graphs/.
+type manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Profile   string    `json:"profile"`
+}
+
+const (
+	manifestFile       = "manifest.json"
+	songsFile          = "songs.json"
+	albumsFile         = "albums.json"
+	libraryFile        = "library.json"
+	sessionsFile       = "sessions.json"
+	librarySessionFile = "library_session.json"
+	historyFile        = "history.json"
+	playlistsFile      = "playlists.json"
+	ratingsFile        = "ratings.json"
+	graphsDir          = "graphs/"
+)
+
+func Write(w io.Writer, b *Bundle, format Format) error {
+	switch format {
+	case FormatJSON, "":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(b)
+	case FormatTar:
+		return writeTar(w, b)
+	default:
+		return fmt.Errorf("unknown bundle format %q", format)
+	}
+}
+
+func writeTar(w io.Writer, b *Bundle) error {
+	tw := tar.NewWriter(w)
+	parts := []struct {
+		name string
+		v    any
+	}{
+		{manifestFile, manifest{Version: b.Version, CreatedAt: b.CreatedAt, Profile: b.Profile}},
+		{songsFile, b.Songs},
+		{albumsFile, b.Albums},
+		{libraryFile, b.Library},
+		{sessionsFile, b.Sessions},
+		{librarySessionFile, b.LibrarySession},
+		{historyFile, b.History},
+		{playlistsFile, b.Playlists},
+		{ratingsFile, b.Ratings},
+	}
+	for _, g := range b.Graphs {
+		parts = append(parts, struct {
+			name string
+			v    any
+		}{graphsDir + strconv.FormatInt(g.AlbumID, 10) + ".json", g.Edges})
+	}
+
+	for _, part := range parts {
+		data, err := json.Marshal(part.v)
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{Name: part.name, Mode: 0o644, Size: int64(len(data)), ModTime: b.CreatedAt}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// Read loads a bundle in either format; a JSON bundle is recognized by its
+// opening brace.
+func Read(r io.Reader) (*Bundle, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	var b *Bundle
+	if strings.TrimSpace(string(head)) == "" || head[0] == '{' {
+		b = &Bundle{}
+		if err := json.NewDecoder(br).Decode(b); err != nil {
+			return nil, err
+		}
+	} else if b, err = readTar(br); err != nil {
+		return nil, err
+	}
+
+	if b.Version != Version {
+		return nil, fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+	return b, nil
+}
+
+func readTar(r io.Reader) (*Bundle, error) {
+	b := &Bundle{}
+	hasManifest := false
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		dec := json.NewDecoder(tr)
+		name := path.Clean(hdr.Name)
+		switch {
+		case name == manifestFile:
+			var m manifest
+			if err := dec.Decode(&m); err != nil {
+				return nil, err
+			}
+			b.Version, b.CreatedAt, b.Profile = m.Version, m.CreatedAt, m.Profile
+			hasManifest = true
+		case name == songsFile:
+			err = dec.Decode(&b.Songs)
+		case name == albumsFile:
+			err = dec.Decode(&b.Albums)
+		case name == libraryFile:
+			err = dec.Decode(&b.Library)
+		case name == sessionsFile:
+			err = dec.Decode(&b.Sessions)
+		case name == librarySessionFile:
+			err = dec.Decode(&b.LibrarySession)
+		case name == historyFile:
+			err = dec.Decode(&b.History)
+		case name == playlistsFile:
+			err = dec.Decode(&b.Playlists)
+		case name == ratingsFile:
+			err = dec.Decode(&b.Ratings)
+		case strings.HasPrefix(name, graphsDir) && strings.HasSuffix(name, ".json"):
+			id, perr := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, graphsDir), ".json"), 10, 64)
+			if perr != nil {
+				return nil, fmt.Errorf("bad graph file name %q", hdr.Name)
+			}
+			g := Graph{AlbumID: id}
+			err = dec.Decode(&g.Edges)
+			b.Graphs = append(b.Graphs, g)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+	}
+
+	if !hasManifest {
+		return nil, errors.New("not a bundle: " + manifestFile + " is missing")
+	}
+	return b, nil
+}
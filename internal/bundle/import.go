@@ -0,0 +1,464 @@
+package bundle
+
+import (
+	"GO_player/internal/catalog"
+	"GO_player/internal/models"
+	"GO_player/internal/playback"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+type Mode string
+
+const (
+	// ModeReplace overwrites the graphs and sessions present in the bundle.
+	ModeReplace Mode = "replace"
+	// ModeMerge sums the bundle's edge weights into the existing graphs and
+	// only fills in sessions that do not exist yet.
+	ModeMerge Mode = "merge"
+)
+
+type Options struct {
+	Mode Mode
+	// DryRun computes the report without writing anything.
+	DryRun bool
+}
+
+type GraphDiff struct {
+	AlbumID      int64   `json:"album_id"`
+	Library      bool    `json:"library,omitempty"`
+	Added        int     `json:"added"`
+	Changed      int     `json:"changed"`
+	Removed      int     `json:"removed"`
+	WeightBefore float64 `json:"weight_before"`
+	WeightAfter  float64 `json:"weight_after"`
+}
+
+type Report struct {
+	Mode          Mode        `json:"mode"`
+	DryRun        bool        `json:"dry_run"`
+	SongsByPath   int         `json:"songs_by_path"`
+	SongsByHash   int         `json:"songs_by_hash"`
+	SongsByID     int         `json:"songs_by_id"`
+	SongsCreated  int         `json:"songs_created"`
+	AlbumsCreated int         `json:"albums_created"`
+	Graphs        []GraphDiff `json:"graphs"`
+	Sessions      int         `json:"sessions"`
+	HistoryEvents int         `json:"history_events"`
+	Playlists     int         `json:"playlists"`
+	Ratings       int         `json:"ratings"`
+}
+
+// Import writes a bundle into the catalog's profile. Bundle songs are matched
+// to existing ones by path, then by content hash, and songs without a file by
+// an ID with the same title and artist; the others are added, under a new ID
+// if theirs is taken. Every ID in the graphs, sessions, history, playlists
+// and ratings is translated accordingly. The writes go through a batch, so no
+// App may be running on the profile at the same time.
+func Import(cat catalog.Catalog, b *Bundle, opts Options) (*Report, error) {
+	if opts.Mode != ModeReplace && opts.Mode != ModeMerge {
+		return nil, fmt.Errorf("unknown import mode %q", opts.Mode)
+	}
+	report := &Report{Mode: opts.Mode, DryRun: opts.DryRun, Graphs: []GraphDiff{}}
+
+	songs, err := cat.ListSongs()
+	if err != nil {
+		return nil, err
+	}
+	albums, err := cat.ListAlbums()
+	if err != nil {
+		return nil, err
+	}
+
+	albumIDs, newAlbums := mapAlbums(b.Albums, albums)
+	report.AlbumsCreated = len(newAlbums)
+	songIDs, newSongs := mapSongs(b.Songs, songs, albumIDs, report)
+
+	mapSong := func(id int64) int64 {
+		if mapped, ok := songIDs[id]; ok {
+			return mapped
+		}
+		return id
+	}
+	mapAlbum := func(id int64) int64 {
+		if mapped, ok := albumIDs[id]; ok {
+			return mapped
+		}
+		return id
+	}
+
+	graphs := make(map[int64]map[int64]map[int64]float64, len(b.Graphs))
+	for _, g := range b.Graphs {
+		albumID := mapAlbum(g.AlbumID)
+		edges := remapEdges(g.Edges, mapSong)
+		current, err := cat.LoadBaseGraphEdges(albumID)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Mode == ModeMerge {
+			edges = catalog.MergeEdges(current, edges)
+		}
+		graphs[albumID] = edges
+		report.Graphs = append(report.Graphs, diffEdges(albumID, current, edges))
+	}
+
+	var library map[int64]map[int64]float64
+	if len(b.Library) > 0 {
+		library = remapEdges(b.Library, mapSong)
+		current, err := cat.LoadLibraryGraphEdges()
+		if err != nil {
+			return nil, err
+		}
+		if opts.Mode == ModeMerge {
+			library = catalog.MergeEdges(current, library)
+		}
+		diff := diffEdges(0, current, library)
+		diff.Library = true
+		report.Graphs = append(report.Graphs, diff)
+	}
+	sort.Slice(report.Graphs, func(i, j int) bool {
+		if report.Graphs[i].Library != report.Graphs[j].Library {
+			return !report.Graphs[i].Library
+		}
+		return report.Graphs[i].AlbumID < report.Graphs[j].AlbumID
+	})
+
+	sessions := make(map[int64]*playback.PlaybackChain)
+	for _, s := range b.Sessions {
+		albumID := mapAlbum(s.AlbumID)
+		if opts.Mode == ModeMerge {
+			current, err := cat.LoadAlbumPlaybackSession(albumID)
+			if err != nil {
+				return nil, err
+			}
+			if !emptyChain(current) {
+				continue
+			}
+		}
+		sessions[albumID] = remapChain(s.Chain, mapSong)
+	}
+	var librarySession *playback.PlaybackChain
+	if b.LibrarySession != nil {
+		librarySession = remapChain(b.LibrarySession, mapSong)
+		if opts.Mode == ModeMerge {
+			current, err := cat.LoadLibraryPlaybackSession()
+			if err != nil {
+				return nil, err
+			}
+			if !emptyChain(current) {
+				librarySession = nil
+			}
+		}
+	}
+	report.Sessions = len(sessions)
+	if librarySession != nil {
+		report.Sessions++
+	}
+	report.HistoryEvents = len(b.History)
+
+	existing, err := cat.ListPlaylists()
+	if err != nil {
+		return nil, err
+	}
+	playlists := mapPlaylists(b.Playlists, existing, opts.Mode, mapSong)
+	report.Playlists = len(playlists)
+
+	var ratings []*models.Rating
+	for _, r := range b.Ratings {
+		rating := *r
+		rating.SongID = mapSong(r.SongID)
+		if opts.Mode == ModeMerge {
+			current, err := cat.LoadRating(rating.SongID)
+			if err != nil {
+				return nil, err
+			}
+			if current != nil {
+				continue
+			}
+		}
+		ratings = append(ratings, &rating)
+	}
+	report.Ratings = len(ratings)
+
+	if opts.DryRun {
+		return report, nil
+	}
+
+	err = cat.Import(func(batch catalog.Batch) error {
+		for _, album := range newAlbums {
+			if err := batch.SaveAlbum(album.ID, album); err != nil {
+				return err
+			}
+		}
+		for _, song := range newSongs {
+			if err := batch.SaveSong(song.ID, song); err != nil {
+				return err
+			}
+		}
+		for albumID, edges := range graphs {
+			if err := batch.SaveBaseGraphEdges(albumID, edges); err != nil {
+				return err
+			}
+		}
+		if library != nil {
+			if err := batch.SaveLibraryGraphEdges(library); err != nil {
+				return err
+			}
+		}
+		for albumID, chain := range sessions {
+			if err := batch.SaveAlbumPlaybackSession(albumID, chain); err != nil {
+				return err
+			}
+		}
+		if librarySession != nil {
+			if err := batch.SaveLibraryPlaybackSession(librarySession); err != nil {
+				return err
+			}
+		}
+		for _, event := range b.History {
+			e := *event
+			e.SongID = mapSong(e.SongID)
+			if e.PreviousID != 0 {
+				e.PreviousID = mapSong(e.PreviousID)
+			}
+			if e.AlbumID != 0 {
+				e.AlbumID = mapAlbum(e.AlbumID)
+			}
+			if err := batch.AppendPlayEvent(&e); err != nil {
+				return err
+			}
+		}
+		for _, p := range playlists {
+			if err := batch.SavePlaylist(p); err != nil {
+				return err
+			}
+		}
+		for _, r := range ratings {
+			if err := batch.SaveRating(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// mapAlbums matches bundle albums to existing ones with the same ID and
+// title, then by title alone. Unmatched albums keep their ID when it is free.
+func mapAlbums(bundled, existing []*models.Album) (map[int64]int64, []*models.Album) {
+	byID := make(map[int64]*models.Album, len(existing))
+	byTitle := make(map[string]*models.Album, len(existing))
+	var maxID int64
+	for _, album := range existing {
+		byID[album.ID] = album
+		if _, ok := byTitle[album.Title]; !ok && album.Title != "" {
+			byTitle[album.Title] = album
+		}
+		maxID = max(maxID, album.ID)
+	}
+	for _, album := range bundled {
+		maxID = max(maxID, album.ID)
+	}
+
+	ids := make(map[int64]int64, len(bundled))
+	var created []*models.Album
+	for _, album := range bundled {
+		if t, ok := byID[album.ID]; ok && t.Title == album.Title {
+			ids[album.ID] = t.ID
+			continue
+		}
+		if t, ok := byTitle[album.Title]; ok && album.Title != "" {
+			ids[album.ID] = t.ID
+			continue
+		}
+
+		id := album.ID
+		if _, taken := byID[id]; taken {
+			maxID++
+			id = maxID
+		}
+		a := *album
+		a.ID = id
+		a.BaseGraph = nil
+		byID[id] = &a
+		ids[album.ID] = id
+		created = append(created, &a)
+	}
+	return ids, created
+}
+
+func mapSongs(bundled []Song, existing []*models.Song, albumIDs map[int64]int64, report *Report) (map[int64]int64, []*models.Song) {
+	byPath := make(map[string]*models.Song, len(existing))
+	byID := make(map[int64]*models.Song, len(existing))
+	var maxID int64
+	for _, song := range existing {
+		if song.Path != "" {
+			byPath[filepath.Clean(song.Path)] = song
+		}
+		byID[song.ID] = song
+		maxID = max(maxID, song.ID)
+	}
+	for _, song := range bundled {
+		maxID = max(maxID, song.ID)
+	}
+
+	// Hashing reads every file, so it is only done once a song is not found
+	// by its path.
+	var byHash map[string]*models.Song
+	hashes := func() map[string]*models.Song {
+		if byHash == nil {
+			byHash = make(map[string]*models.Song)
+			for _, song := range existing {
+				if hash, err := hashFile(song.Path); err == nil {
+					byHash[hash] = song
+				}
+			}
+		}
+		return byHash
+	}
+
+	ids := make(map[int64]int64, len(bundled))
+	var created []*models.Song
+	for _, s := range bundled {
+		if t, ok := byPath[filepath.Clean(s.Path)]; ok && s.Path != "" {
+			ids[s.ID] = t.ID
+			report.SongsByPath++
+			continue
+		}
+		if s.Hash != "" {
+			if t, ok := hashes()[s.Hash]; ok {
+				ids[s.ID] = t.ID
+				report.SongsByHash++
+				continue
+			}
+		}
+		if t, ok := byID[s.ID]; ok && s.Path == "" && t.Path == "" && t.Title == s.Title && t.Artist == s.Artist {
+			ids[s.ID] = t.ID
+			report.SongsByID++
+			continue
+		}
+
+		id := s.ID
+		if _, taken := byID[id]; taken || id <= 0 {
+			maxID++
+			id = maxID
+		}
+		song := s.Song
+		byID[id] = &song
+		song.ID = id
+		if mapped, ok := albumIDs[song.AlbumID]; ok {
+			song.AlbumID = mapped
+		}
+		ids[s.ID] = id
+		created = append(created, &song)
+		report.SongsCreated++
+	}
+	return ids, created
+}
+
+// mapPlaylists returns the bundle playlists to write with their songs
+// translated. Replacing keeps their IDs; merging skips playlists that already
+// exist under the same ID and name, and moves the others to a new ID if
+// theirs is taken.
+func mapPlaylists(bundled, existing []*models.Playlist, mode Mode, mapSong func(int64) int64) []*models.Playlist {
+	byID := make(map[int64]*models.Playlist, len(existing))
+	var maxID int64
+	for _, p := range existing {
+		byID[p.ID] = p
+		maxID = max(maxID, p.ID)
+	}
+	for _, p := range bundled {
+		maxID = max(maxID, p.ID)
+	}
+
+	var res []*models.Playlist
+	for _, p := range bundled {
+		mapped := *p
+		mapped.SongIDs = make([]int64, len(p.SongIDs))
+		for i, id := range p.SongIDs {
+			mapped.SongIDs[i] = mapSong(id)
+		}
+		if mode == ModeMerge {
+			if t, ok := byID[p.ID]; ok {
+				if t.Name == p.Name {
+					continue
+				}
+				maxID++
+				mapped.ID = maxID
+			}
+		}
+		if mapped.ID <= 0 {
+			maxID++
+			mapped.ID = maxID
+		}
+		byID[mapped.ID] = &mapped
+		res = append(res, &mapped)
+	}
+	return res
+}
+
+func remapEdges(edges map[int64]map[int64]float64, mapSong func(int64) int64) map[int64]map[int64]float64 {
+	res := make(map[int64]map[int64]float64, len(edges))
+	for fromID, neighbors := range edges {
+		from := fromID
+		if from != 0 {
+			from = mapSong(fromID)
+		}
+		if res[from] == nil {
+			res[from] = make(map[int64]float64, len(neighbors))
+		}
+		for toID, weight := range neighbors {
+			res[from][mapSong(toID)] += weight
+		}
+	}
+	return res
+}
+
+func remapChain(chain *playback.PlaybackChain, mapSong func(int64) int64) *playback.PlaybackChain {
+	ids := func(src []int64) []int64 {
+		dst := make([]int64, len(src))
+		for i, id := range src {
+			dst[i] = mapSong(id)
+		}
+		return dst
+	}
+	res := &playback.PlaybackChain{
+		BackStack:      ids(chain.BackStack),
+		ForwardStack:   ids(chain.ForwardStack),
+		Queue:          ids(chain.Queue),
+		LearningFrozen: chain.LearningFrozen,
+	}
+	if chain.Current != 0 {
+		res.Current = mapSong(chain.Current)
+	}
+	return res
+}
+
+func diffEdges(albumID int64, before, after map[int64]map[int64]float64) GraphDiff {
+	diff := GraphDiff{AlbumID: albumID}
+	for fromID, neighbors := range after {
+		for toID, weight := range neighbors {
+			diff.WeightAfter += weight
+			old, ok := before[fromID][toID]
+			switch {
+			case !ok:
+				diff.Added++
+			case old != weight:
+				diff.Changed++
+			}
+		}
+	}
+	for fromID, neighbors := range before {
+		for toID, weight := range neighbors {
+			diff.WeightBefore += weight
+			if _, ok := after[fromID][toID]; !ok {
+				diff.Removed++
+			}
+		}
+	}
+	return diff
+}
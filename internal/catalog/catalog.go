@@ -2,6 +2,7 @@ package catalog
 
 import (
 	"GO_player/internal/memory/basegraph"
+	"GO_player/internal/memory/crdt"
 	"GO_player/internal/models"
 	"GO_player/internal/playback"
 	"GO_player/internal/storage"
@@ -9,194 +10,613 @@ import (
 	"encoding/gob"
 	"encoding/json"
 	"sync"
+	"time"
 )
 
 type Catalog interface {
 	LoadBaseGraphEdges(albumID int64) (map[int64]map[int64]float64, error)
-	LoadPlaybackSession() (*playback.PlaybackChain, error)
+	LoadAlbumPlaybackSession(albumID int64) (*playback.PlaybackChain, error)
+	LoadLibraryGraphEdges() (map[int64]map[int64]float64, error)
+	LoadLibraryPenalties() (map[int64]map[int64]float64, error)
+	LoadLibraryPlaybackSession() (*playback.PlaybackChain, error)
 	LoadSong(songID int64) (*models.Song, error)
 	LoadAlbum(albumID int64) (*models.Album, error)
 	SaveBaseGraph(albumID int64, graph *basegraph.BaseGraph) error
-	SavePlaybackSession(chain *playback.PlaybackChain) error
+	SaveAlbumPlaybackSession(albumID int64, chain *playback.PlaybackChain) error
+	SaveLibraryGraphEdges(edges map[int64]map[int64]float64) error
+	SaveLibraryPenalties(penalties map[int64]map[int64]float64) error
+	SaveLibraryPlaybackSession(chain *playback.PlaybackChain) error
 	SaveSong(songID int64, song *models.Song) error
 	SaveAlbum(albumID int64, album *models.Album) error
 	ListAlbums() ([]*models.Album, error)
 	ListSongs() ([]*models.Song, error)
+	ListBaseGraphIDs() ([]int64, error)
+	SaveProfile(profile *models.Profile) error
+	LoadProfile(name string) (*models.Profile, error)
+	ListProfiles() ([]*models.Profile, error)
+	AppendPlayEvent(event *models.PlayEvent) error
+	ListPlayEvents(from, to time.Time) ([]*models.PlayEvent, error)
+	ListSongPlayEvents(songID int64, from, to time.Time) ([]*models.PlayEvent, error)
+	ListRecentPlayEvents(n int, since time.Time) ([]*models.PlayEvent, error)
+	CountPlayEvents() (map[int64]int, error)
+	LoadSyncState() (*crdt.State, error)
+	SaveSyncState(state *crdt.State) error
+	SavePlaylist(playlist *models.Playlist) error
+	LoadPlaylist(id int64) (*models.Playlist, error)
+	ListPlaylists() ([]*models.Playlist, error)
+	DeletePlaylist(id int64) error
+	SaveRating(rating *models.Rating) error
+	LoadRating(songID int64) (*models.Rating, error)
+	ListRatings() ([]*models.Rating, error)
+	Profile() string
+	Update(fn func(uow UnitOfWork) error) error
+	Import(fn func(b Batch) error) error
+}
+
+// Batch collects writes that are committed together.
+type Batch interface {
+	SaveBaseGraph(albumID int64, graph *basegraph.BaseGraph) error
+	SaveBaseGraphEdges(albumID int64, edges map[int64]map[int64]float64) error
+	SaveAlbumPlaybackSession(albumID int64, chain *playback.PlaybackChain) error
+	SaveLibraryGraphEdges(edges map[int64]map[int64]float64) error
+	SaveLibraryPenalties(penalties map[int64]map[int64]float64) error
+	SaveLibraryPlaybackSession(chain *playback.PlaybackChain) error
+	SaveSong(songID int64, song *models.Song) error
+	SaveAlbum(albumID int64, album *models.Album) error
+	AppendPlayEvent(event *models.PlayEvent) error
+	SaveSyncState(state *crdt.State) error
+	SavePlaylist(playlist *models.Playlist) error
+	SaveRating(rating *models.Rating) error
+}
+
+// UnitOfWork is a Batch that can also read what it is about to change. All
+// reads and writes of one unit of work commit or roll back together, and the
+// unit may be replayed when it conflicts with a concurrent update. The
+// storage transaction is open while it runs, so it must read and write only
+// through the unit of work and never call back into the Catalog.
+type UnitOfWork interface {
+	Batch
+	LoadBaseGraphEdges(albumID int64) (map[int64]map[int64]float64, error)
+	LoadAlbumPlaybackSession(albumID int64) (*playback.PlaybackChain, error)
+	LoadLibraryGraphEdges() (map[int64]map[int64]float64, error)
+	LoadLibraryPenalties() (map[int64]map[int64]float64, error)
+	LoadLibraryPlaybackSession() (*playback.PlaybackChain, error)
+	LoadSong(songID int64) (*models.Song, error)
+	LoadAlbum(albumID int64) (*models.Album, error)
+	LoadSyncState() (*crdt.State, error)
+	LoadPlaylist(id int64) (*models.Playlist, error)
 }
 
 type catalogImpl struct {
-	mu sync.Mutex
-	db *storage.DB
+	mu      sync.Mutex
+	db      storage.Store
+	profile string
 }
 
-func NewCatalog(db *storage.DB) Catalog {
+func NewCatalog(db storage.Store) Catalog {
 	return &catalogImpl{db: db}
 }
 
+// NewProfileCatalog returns a catalog whose graphs and playback session belong
+// to the named profile. db must be the shared root store.
+func NewProfileCatalog(db storage.Store, profile string) (Catalog, error) {
+	if profile == "" {
+		return NewCatalog(db), nil
+	}
+	view, err := db.Profile(profile)
+	if err != nil {
+		return nil, err
+	}
+	return &catalogImpl{db: view, profile: profile}, nil
+}
+
+func (c *catalogImpl) Profile() string {
+	return c.profile
+}
+
 func (c *catalogImpl) LoadBaseGraphEdges(albumID int64) (map[int64]map[int64]float64, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	return loadBaseGraphEdges(c.db, albumID)
+}
+
+// LoadAlbumPlaybackSession returns the playback session of an album. An album
+// that has none yet gets the single session kept before sessions were per
+// album, if that one was playing it.
+func (c *catalogImpl) LoadAlbumPlaybackSession(albumID int64) (*playback.PlaybackChain, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var pb *playback.PlaybackChain
+	err := c.db.View(func(tx storage.Tx) error {
+		var err error
+		pb, err = loadAlbumPlaybackSession(tx, albumID)
+		return err
+	})
+	return pb, err
+}
+
+func (c *catalogImpl) LoadLibraryGraphEdges() (map[int64]map[int64]float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return loadLibraryGraphEdges(c.db)
+}
+
+// LoadLibraryPenalties returns how far radio mode pushed edges below their
+// album prior, see library.Library.Extract.
+func (c *catalogImpl) LoadLibraryPenalties() (map[int64]map[int64]float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return loadLibraryPenalties(c.db)
+}
+
+func (c *catalogImpl) LoadLibraryPlaybackSession() (*playback.PlaybackChain, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return loadLibraryPlaybackSession(c.db)
+}
+
+func (c *catalogImpl) LoadSong(songID int64) (*models.Song, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return loadSong(c.db, songID)
+}
+
+func (c *catalogImpl) LoadAlbum(albumID int64) (*models.Album, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return loadAlbum(c.db, albumID)
+}
+
+func (c *catalogImpl) SaveBaseGraph(albumID int64, graph *basegraph.BaseGraph) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return saveBaseGraphEdges(c.db, albumID, graph.GetEdges())
+}
+
+// SaveAlbumPlaybackSession saves the playback session of an album, and drops
+// the single session kept before sessions were per album once it has moved
+// there.
+func (c *catalogImpl) SaveAlbumPlaybackSession(albumID int64, chain *playback.PlaybackChain) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.db.Update(func(tx storage.Tx) error {
+		return migratePlaybackSession(tx, albumID, chain)
+	})
+}
+
+func (c *catalogImpl) SaveLibraryGraphEdges(edges map[int64]map[int64]float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return saveLibraryGraphEdges(c.db, edges)
+}
 
-	val, err := c.db.GetBaseGraph(albumID)
+func (c *catalogImpl) SaveLibraryPenalties(penalties map[int64]map[int64]float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return saveLibraryPenalties(c.db, penalties)
+}
+
+func (c *catalogImpl) SaveLibraryPlaybackSession(chain *playback.PlaybackChain) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return saveLibraryPlaybackSession(c.db, chain)
+}
+
+func (c *catalogImpl) SaveSong(songID int64, song *models.Song) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return saveSong(c.db, songID, song)
+}
+
+func (c *catalogImpl) SaveAlbum(albumID int64, album *models.Album) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return saveAlbum(c.db, albumID, album)
+}
+
+func (c *catalogImpl) ListAlbums() ([]*models.Album, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	val, err := c.db.ListAlbums()
 	if err != nil {
 		return nil, err
 	}
 	if len(val) == 0 {
-		return map[int64]map[int64]float64{}, nil
+		return []*models.Album{}, nil
 	}
 
-	var edges map[int64]map[int64]float64
-	decoder := gob.NewDecoder(bytes.NewReader(val))
-	if err := decoder.Decode(&edges); err != nil {
-		return map[int64]map[int64]float64{}, nil
+	var albums []*models.Album
+	for _, v := range val {
+		album := models.NewAlbum()
+		if err := json.Unmarshal(v, album); err != nil {
+			continue
+		}
+		albums = append(albums, album)
 	}
-	return edges, nil
+	return albums, nil
 }
 
-func (c *catalogImpl) LoadPlaybackSession() (*playback.PlaybackChain, error) {
+func (c *catalogImpl) ListSongs() ([]*models.Song, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	val, err := c.db.GetPlaybackSession()
+	val, err := c.db.ListSongs()
 	if err != nil {
 		return nil, err
 	}
 	if len(val) == 0 {
-		return &playback.PlaybackChain{}, nil
+		return []*models.Song{}, nil
 	}
 
-	var pb playback.PlaybackChain
-	if err := json.Unmarshal(val, &pb); err != nil {
-		return &playback.PlaybackChain{}, nil
+	var songs []*models.Song
+	for _, v := range val {
+		song := &models.Song{}
+		if err := json.Unmarshal(v, song); err != nil {
+			continue
+		}
+		songs = append(songs, song)
 	}
-	return &pb, nil
+	return songs, nil
 }
 
-func (c *catalogImpl) LoadSong(songID int64) (*models.Song, error) {
+func (c *catalogImpl) ListBaseGraphIDs() ([]int64, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	return c.db.ListBaseGraphIDs()
+}
 
-	val, err := c.db.GetSong(songID)
+func (c *catalogImpl) SaveProfile(profile *models.Profile) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	return c.db.SetProfile(profile.Name, data)
+}
+
+func (c *catalogImpl) LoadProfile(name string) (*models.Profile, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	val, err := c.db.GetProfile(name)
 	if err != nil {
 		return nil, err
 	}
 	if len(val) == 0 {
-		return &models.Song{}, nil
+		return nil, nil
 	}
 
-	var song models.Song
-	if err := json.Unmarshal(val, &song); err != nil {
-		return &models.Song{}, nil
+	var profile models.Profile
+	if err := json.Unmarshal(val, &profile); err != nil {
+		return nil, err
 	}
-	return &song, nil
+	return &profile, nil
 }
 
-func (c *catalogImpl) LoadAlbum(albumID int64) (*models.Album, error) {
+func (c *catalogImpl) ListProfiles() ([]*models.Profile, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	val, err := c.db.GetAlbum(albumID)
+	val, err := c.db.ListProfiles()
 	if err != nil {
 		return nil, err
 	}
-	if len(val) == 0 {
-		return models.NewAlbum(), nil
-	}
 
-	album := models.NewAlbum()
-	if err := json.Unmarshal(val, album); err != nil {
-		return models.NewAlbum(), nil
+	profiles := []*models.Profile{}
+	for _, v := range val {
+		profile := &models.Profile{}
+		if err := json.Unmarshal(v, profile); err != nil {
+			continue
+		}
+		profiles = append(profiles, profile)
 	}
-	return album, nil
+	return profiles, nil
 }
 
-func (c *catalogImpl) SaveBaseGraph(albumID int64, graph *basegraph.BaseGraph) error {
+// Update does not hold c.mu while fn runs: the storage transaction already
+// keeps units of work apart, and fn must not call back into the catalog.
+func (c *catalogImpl) Update(fn func(uow UnitOfWork) error) error {
+	return c.db.Update(func(tx storage.Tx) error {
+		return fn(&unitOfWork{batch: batch{w: tx}, tx: tx})
+	})
+}
+
+// Import writes through a storage write batch. It is meant for bulk loads
+// where throughput matters more than all-or-nothing visibility. Like a unit
+// of work, fn must not call back into the catalog.
+func (c *catalogImpl) Import(fn func(b Batch) error) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	return c.db.WriteBatch(func(w storage.Batch) error {
+		return fn(batch{w: w})
+	})
+}
 
-	var buf bytes.Buffer
-	encoder := gob.NewEncoder(&buf)
-	if err := encoder.Encode(graph.GetEdges()); err != nil {
-		return err
+type batch struct {
+	w storage.Batch
+}
+
+func (b batch) SaveBaseGraph(albumID int64, graph *basegraph.BaseGraph) error {
+	return saveBaseGraphEdges(b.w, albumID, graph.GetEdges())
+}
+
+func (b batch) SaveBaseGraphEdges(albumID int64, edges map[int64]map[int64]float64) error {
+	return saveBaseGraphEdges(b.w, albumID, edges)
+}
+
+func (b batch) SaveAlbumPlaybackSession(albumID int64, chain *playback.PlaybackChain) error {
+	return saveAlbumPlaybackSession(b.w, albumID, chain)
+}
+
+func (b batch) SaveLibraryGraphEdges(edges map[int64]map[int64]float64) error {
+	return saveLibraryGraphEdges(b.w, edges)
+}
+
+func (b batch) SaveLibraryPenalties(penalties map[int64]map[int64]float64) error {
+	return saveLibraryPenalties(b.w, penalties)
+}
+
+func (b batch) SaveLibraryPlaybackSession(chain *playback.PlaybackChain) error {
+	return saveLibraryPlaybackSession(b.w, chain)
+}
+
+func (b batch) SaveSong(songID int64, song *models.Song) error {
+	return saveSong(b.w, songID, song)
+}
+
+func (b batch) SaveAlbum(albumID int64, album *models.Album) error {
+	return saveAlbum(b.w, albumID, album)
+}
+
+func (b batch) AppendPlayEvent(event *models.PlayEvent) error {
+	return appendPlayEvent(b.w, event)
+}
+
+type unitOfWork struct {
+	batch
+	tx storage.Tx
+}
+
+func (u *unitOfWork) LoadBaseGraphEdges(albumID int64) (map[int64]map[int64]float64, error) {
+	return loadBaseGraphEdges(u.tx, albumID)
+}
+
+func (u *unitOfWork) LoadAlbumPlaybackSession(albumID int64) (*playback.PlaybackChain, error) {
+	return loadAlbumPlaybackSession(u.tx, albumID)
+}
+
+func (u *unitOfWork) SaveAlbumPlaybackSession(albumID int64, chain *playback.PlaybackChain) error {
+	return migratePlaybackSession(u.tx, albumID, chain)
+}
+
+func (u *unitOfWork) LoadLibraryGraphEdges() (map[int64]map[int64]float64, error) {
+	return loadLibraryGraphEdges(u.tx)
+}
+
+func (u *unitOfWork) LoadLibraryPenalties() (map[int64]map[int64]float64, error) {
+	return loadLibraryPenalties(u.tx)
+}
+
+func (u *unitOfWork) LoadLibraryPlaybackSession() (*playback.PlaybackChain, error) {
+	return loadLibraryPlaybackSession(u.tx)
+}
+
+func (u *unitOfWork) LoadSong(songID int64) (*models.Song, error) {
+	return loadSong(u.tx, songID)
+}
+
+func (u *unitOfWork) LoadAlbum(albumID int64) (*models.Album, error) {
+	return loadAlbum(u.tx, albumID)
+}
+
+func loadBaseGraphEdges(tx storage.Tx, albumID int64) (map[int64]map[int64]float64, error) {
+	val, err := tx.GetBaseGraph(albumID)
+	if err != nil {
+		return nil, err
 	}
-	return c.db.SetBaseGraph(albumID, buf.Bytes())
+	return decodeEdges(val), nil
 }
 
-func (c *catalogImpl) SavePlaybackSession(chain *playback.PlaybackChain) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+func loadLibraryGraphEdges(tx storage.Tx) (map[int64]map[int64]float64, error) {
+	val, err := tx.GetLibraryGraph()
+	if err != nil {
+		return nil, err
+	}
+	return decodeEdges(val), nil
+}
 
-	data, err := json.Marshal(chain)
+func saveLibraryGraphEdges(w storage.Batch, edges map[int64]map[int64]float64) error {
+	data, err := encodeEdges(edges)
 	if err != nil {
 		return err
 	}
-	return c.db.SetPlaybackSession(data)
+	return w.SetLibraryGraph(data)
 }
 
-func (c *catalogImpl) SaveSong(songID int64, song *models.Song) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+func loadLibraryPenalties(tx storage.Tx) (map[int64]map[int64]float64, error) {
+	val, err := tx.GetLibraryPenalties()
+	if err != nil {
+		return nil, err
+	}
+	return decodeEdges(val), nil
+}
 
-	data, err := json.Marshal(song)
+func saveLibraryPenalties(w storage.Batch, penalties map[int64]map[int64]float64) error {
+	data, err := encodeEdges(penalties)
 	if err != nil {
 		return err
 	}
-	return c.db.SetSong(songID, data)
+	return w.SetLibraryPenalties(data)
 }
 
-func (c *catalogImpl) SaveAlbum(albumID int64, album *models.Album) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+func decodeEdges(val []byte) map[int64]map[int64]float64 {
+	if len(val) == 0 {
+		return map[int64]map[int64]float64{}
+	}
 
-	data, err := json.Marshal(album)
+	var edges map[int64]map[int64]float64
+	decoder := gob.NewDecoder(bytes.NewReader(val))
+	if err := decoder.Decode(&edges); err != nil {
+		return map[int64]map[int64]float64{}
+	}
+	return edges
+}
+
+func encodeEdges(edges map[int64]map[int64]float64) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := gob.NewEncoder(&buf)
+	if err := encoder.Encode(edges); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func saveBaseGraphEdges(w storage.Batch, albumID int64, edges map[int64]map[int64]float64) error {
+	data, err := encodeEdges(edges)
 	if err != nil {
 		return err
 	}
-	return c.db.SetAlbum(albumID, data)
+	return w.SetBaseGraph(albumID, data)
 }
 
-func (c *catalogImpl) ListAlbums() ([]*models.Album, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	val, err := c.db.ListAlbums()
+func loadAlbumPlaybackSession(tx storage.Tx, albumID int64) (*playback.PlaybackChain, error) {
+	val, err := tx.GetAlbumSession(albumID)
 	if err != nil {
 		return nil, err
 	}
 	if len(val) == 0 {
-		return []*models.Album{}, nil
+		legacy, err := loadLegacyPlaybackSession(tx, albumID)
+		if err != nil || legacy != nil {
+			return legacy, err
+		}
 	}
+	return decodePlaybackSession(val), nil
+}
 
-	var albums []*models.Album
-	for _, v := range val {
-		album := models.NewAlbum()
-		if err := json.Unmarshal(v, album); err != nil {
+// loadLegacyPlaybackSession returns the single playback session kept before
+// sessions were per album if it was playing albumID, and nil otherwise.
+func loadLegacyPlaybackSession(tx storage.Tx, albumID int64) (*playback.PlaybackChain, error) {
+	val, err := tx.GetPlaybackSession()
+	if err != nil || len(val) == 0 {
+		return nil, err
+	}
+	pb := decodePlaybackSession(val)
+	ids := append([]int64{pb.Current}, pb.BackStack...)
+	ids = append(append(ids, pb.ForwardStack...), pb.Queue...)
+	for _, id := range ids {
+		if id == 0 {
 			continue
 		}
-		albums = append(albums, album)
+		song, err := loadSong(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if song.AlbumID != albumID {
+			return nil, nil
+		}
+		return pb, nil
 	}
-	return albums, nil
+	return nil, nil
 }
 
-func (c *catalogImpl) ListSongs() ([]*models.Song, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// migratePlaybackSession saves the session of an album and deletes the legacy
+// session it may have been loaded from.
+func migratePlaybackSession(tx storage.Tx, albumID int64, chain *playback.PlaybackChain) error {
+	legacy, err := loadLegacyPlaybackSession(tx, albumID)
+	if err != nil {
+		return err
+	}
+	if legacy != nil {
+		if err := tx.DeletePlaybackSession(); err != nil {
+			return err
+		}
+	}
+	return saveAlbumPlaybackSession(tx, albumID, chain)
+}
 
-	val, err := c.db.ListSongs()
+func loadLibraryPlaybackSession(tx storage.Tx) (*playback.PlaybackChain, error) {
+	val, err := tx.GetLibrarySession()
 	if err != nil {
 		return nil, err
 	}
+	return decodePlaybackSession(val), nil
+}
+
+func decodePlaybackSession(val []byte) *playback.PlaybackChain {
 	if len(val) == 0 {
-		return []*models.Song{}, nil
+		return &playback.PlaybackChain{}
 	}
 
-	var songs []*models.Song
-	for _, v := range val {
-		song := &models.Song{}
-		if err := json.Unmarshal(v, song); err != nil {
-			continue
-		}
-		songs = append(songs, song)
+	var pb playback.PlaybackChain
+	if err := json.Unmarshal(val, &pb); err != nil {
+		return &playback.PlaybackChain{}
 	}
-	return songs, nil
+	return &pb
+}
+
+func saveAlbumPlaybackSession(w storage.Batch, albumID int64, chain *playback.PlaybackChain) error {
+	data, err := json.Marshal(chain)
+	if err != nil {
+		return err
+	}
+	return w.SetAlbumSession(albumID, data)
+}
+
+func saveLibraryPlaybackSession(w storage.Batch, chain *playback.PlaybackChain) error {
+	data, err := json.Marshal(chain)
+	if err != nil {
+		return err
+	}
+	return w.SetLibrarySession(data)
+}
+
+func loadSong(tx storage.Tx, songID int64) (*models.Song, error) {
+	val, err := tx.GetSong(songID)
+	if err != nil {
+		return nil, err
+	}
+	if len(val) == 0 {
+		return &models.Song{}, nil
+	}
+
+	var song models.Song
+	if err := json.Unmarshal(val, &song); err != nil {
+		return &models.Song{}, nil
+	}
+	return &song, nil
+}
+
+func saveSong(w storage.Batch, songID int64, song *models.Song) error {
+	data, err := json.Marshal(song)
+	if err != nil {
+		return err
+	}
+	return w.SetSong(songID, data)
+}
+
+func loadAlbum(tx storage.Tx, albumID int64) (*models.Album, error) {
+	val, err := tx.GetAlbum(albumID)
+	if err != nil {
+		return nil, err
+	}
+	if len(val) == 0 {
+		return models.NewAlbum(), nil
+	}
+
+	album := models.NewAlbum()
+	if err := json.Unmarshal(val, album); err != nil {
+		return models.NewAlbum(), nil
+	}
+	return album, nil
+}
+
+func saveAlbum(w storage.Batch, albumID int64, album *models.Album) error {
+	data, err := json.Marshal(album)
+	if err != nil {
+		return err
+	}
+	return w.SetAlbum(albumID, data)
 }
@@ -0,0 +1,98 @@
+package catalog
+
+import (
+	"GO_player/internal/models"
+	"GO_player/internal/storage"
+	"encoding/json"
+	"math"
+	"time"
+)
+
+func (c *catalogImpl) AppendPlayEvent(event *models.PlayEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return appendPlayEvent(c.db, event)
+}
+
+// ListPlayEvents returns the events started in [from, to) in order. A zero
+// from or to leaves that end of the range open.
+func (c *catalogImpl) ListPlayEvents(from, to time.Time) ([]*models.PlayEvent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	start, end := historyRange(from, to)
+	val, err := c.db.ListPlayEvents(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return decodePlayEvents(val), nil
+}
+
+func (c *catalogImpl) ListSongPlayEvents(songID int64, from, to time.Time) ([]*models.PlayEvent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	start, end := historyRange(from, to)
+	val, err := c.db.ListSongPlayEvents(songID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return decodePlayEvents(val), nil
+}
+
+// ListRecentPlayEvents returns, in order, the last n events together with
+// every earlier one started at or after since, without reading the rest of
+// the history.
+func (c *catalogImpl) ListRecentPlayEvents(n int, since time.Time) ([]*models.PlayEvent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	from := int64(math.MaxInt64)
+	if !since.IsZero() {
+		from = since.UnixNano()
+	}
+	val, err := c.db.ListRecentPlayEvents(n, from)
+	if err != nil {
+		return nil, err
+	}
+	return decodePlayEvents(val), nil
+}
+
+// CountPlayEvents returns how many times each song was played.
+func (c *catalogImpl) CountPlayEvents() (map[int64]int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.db.CountPlayEvents()
+}
+
+func appendPlayEvent(w storage.Batch, event *models.PlayEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return w.AppendPlayEvent(event.StartedAt.UnixNano(), event.SongID, data)
+}
+
+func historyRange(from, to time.Time) (int64, int64) {
+	var start int64
+	end := int64(math.MaxInt64)
+	if !from.IsZero() {
+		start = from.UnixNano()
+	}
+	if !to.IsZero() {
+		end = to.UnixNano()
+	}
+	return start, end
+}
+
+func decodePlayEvents(val [][]byte) []*models.PlayEvent {
+	events := []*models.PlayEvent{}
+	for _, v := range val {
+		event := &models.PlayEvent{}
+		if err := json.Unmarshal(v, event); err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
@@ -0,0 +1,111 @@
+package catalog
+
+import (
+	"GO_player/internal/models"
+	"GO_player/internal/storage"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+)
+
+// SavePlaylist stores a playlist. A playlist with ID 0 is new: it is given
+// the next free ID, and its creation time when it has none.
+func (c *catalogImpl) SavePlaylist(playlist *models.Playlist) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if playlist.ID != 0 {
+		return savePlaylist(c.db, playlist)
+	}
+	if playlist.CreatedAt.IsZero() {
+		playlist.CreatedAt = time.Now().UTC()
+	}
+	return c.db.Update(func(tx storage.Tx) error {
+		playlists, err := listPlaylists(tx)
+		if err != nil {
+			return err
+		}
+		var last int64
+		for _, p := range playlists {
+			last = max(last, p.ID)
+		}
+		playlist.ID = last + 1
+		return savePlaylist(tx, playlist)
+	})
+}
+
+// LoadPlaylist returns nil without an error when the playlist does not exist.
+func (c *catalogImpl) LoadPlaylist(id int64) (*models.Playlist, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return loadPlaylist(c.db, id)
+}
+
+// ListPlaylists returns the playlists ordered by ID.
+func (c *catalogImpl) ListPlaylists() ([]*models.Playlist, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return listPlaylists(c.db)
+}
+
+func (c *catalogImpl) DeletePlaylist(id int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.db.DeletePlaylist(id)
+}
+
+func (b batch) SavePlaylist(playlist *models.Playlist) error {
+	return savePlaylist(b.w, playlist)
+}
+
+func (u *unitOfWork) LoadPlaylist(id int64) (*models.Playlist, error) {
+	return loadPlaylist(u.tx, id)
+}
+
+func loadPlaylist(tx storage.Tx, id int64) (*models.Playlist, error) {
+	val, err := tx.GetPlaylist(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(val) == 0 {
+		return nil, nil
+	}
+
+	playlist := &models.Playlist{}
+	if err := json.Unmarshal(val, playlist); err != nil {
+		return nil, err
+	}
+	return playlist, nil
+}
+
+func listPlaylists(tx storage.Tx) ([]*models.Playlist, error) {
+	val, err := tx.ListPlaylists()
+	if err != nil {
+		return nil, err
+	}
+
+	playlists := []*models.Playlist{}
+	for _, v := range val {
+		playlist := &models.Playlist{}
+		if err := json.Unmarshal(v, playlist); err != nil {
+			continue
+		}
+		playlists = append(playlists, playlist)
+	}
+	sort.Slice(playlists, func(i, j int) bool {
+		return playlists[i].ID < playlists[j].ID
+	})
+	return playlists, nil
+}
+
+func savePlaylist(w storage.Batch, playlist *models.Playlist) error {
+	if playlist.ID == 0 {
+		return errors.New("playlist without an ID")
+	}
+	data, err := json.Marshal(playlist)
+	if err != nil {
+		return err
+	}
+	return w.SetPlaylist(playlist.ID, data)
+}
@@ -0,0 +1,56 @@
+package catalog
+
+// CopyGraph copies the album graph of src into dst. With merge set the edge
+// weights of both graphs are summed, otherwise dst is replaced.
+func CopyGraph(src, dst Catalog, albumID int64, merge bool) error {
+	edges, err := src.LoadBaseGraphEdges(albumID)
+	if err != nil {
+		return err
+	}
+
+	return dst.Update(func(uow UnitOfWork) error {
+		if !merge {
+			return uow.SaveBaseGraphEdges(albumID, edges)
+		}
+
+		current, err := uow.LoadBaseGraphEdges(albumID)
+		if err != nil {
+			return err
+		}
+		return uow.SaveBaseGraphEdges(albumID, MergeEdges(current, edges))
+	})
+}
+
+// CopyAllGraphs copies every album graph of src into dst, see CopyGraph.
+func CopyAllGraphs(src, dst Catalog, merge bool) error {
+	ids, err := src.ListBaseGraphIDs()
+	if err != nil {
+		return err
+	}
+	for _, albumID := range ids {
+		if err := CopyGraph(src, dst, albumID, merge); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergeEdges returns a new edge map holding the summed weights of dst and src.
+func MergeEdges(dst, src map[int64]map[int64]float64) map[int64]map[int64]float64 {
+	merged := make(map[int64]map[int64]float64, len(dst))
+	for fromID, neighbors := range dst {
+		merged[fromID] = make(map[int64]float64, len(neighbors))
+		for toID, weight := range neighbors {
+			merged[fromID][toID] = weight
+		}
+	}
+	for fromID, neighbors := range src {
+		if merged[fromID] == nil {
+			merged[fromID] = make(map[int64]float64, len(neighbors))
+		}
+		for toID, weight := range neighbors {
+			merged[fromID][toID] += weight
+		}
+	}
+	return merged
+}
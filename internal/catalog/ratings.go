@@ -0,0 +1,75 @@
+package catalog
+
+import (
+	"GO_player/internal/models"
+	"GO_player/internal/storage"
+	"encoding/json"
+	"sort"
+)
+
+// SaveRating stores a rating; one that neither bans nor pins its song is
+// deleted instead.
+func (c *catalogImpl) SaveRating(rating *models.Rating) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !rating.Banned && !rating.Pinned {
+		return c.db.DeleteRating(rating.SongID)
+	}
+	return saveRating(c.db, rating)
+}
+
+// LoadRating returns nil without an error when the song is not rated.
+func (c *catalogImpl) LoadRating(songID int64) (*models.Rating, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	val, err := c.db.GetRating(songID)
+	if err != nil {
+		return nil, err
+	}
+	if len(val) == 0 {
+		return nil, nil
+	}
+
+	rating := &models.Rating{}
+	if err := json.Unmarshal(val, rating); err != nil {
+		return nil, err
+	}
+	return rating, nil
+}
+
+// ListRatings returns the ratings ordered by song.
+func (c *catalogImpl) ListRatings() ([]*models.Rating, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	val, err := c.db.ListRatings()
+	if err != nil {
+		return nil, err
+	}
+
+	ratings := []*models.Rating{}
+	for _, v := range val {
+		rating := &models.Rating{}
+		if err := json.Unmarshal(v, rating); err != nil {
+			continue
+		}
+		ratings = append(ratings, rating)
+	}
+	sort.Slice(ratings, func(i, j int) bool {
+		return ratings[i].SongID < ratings[j].SongID
+	})
+	return ratings, nil
+}
+
+func (b batch) SaveRating(rating *models.Rating) error {
+	return saveRating(b.w, rating)
+}
+
+func saveRating(w storage.Batch, rating *models.Rating) error {
+	data, err := json.Marshal(rating)
+	if err != nil {
+		return err
+	}
+	return w.SetRating(rating.SongID, data)
+}
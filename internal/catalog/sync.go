@@ -0,0 +1,53 @@
+package catalog
+
+import (
+	"GO_player/internal/memory/crdt"
+	"GO_player/internal/storage"
+	"encoding/json"
+)
+
+// LoadSyncState returns nil without an error when the profile was never
+// synced.
+func (c *catalogImpl) LoadSyncState() (*crdt.State, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return loadSyncState(c.db)
+}
+
+func (c *catalogImpl) SaveSyncState(state *crdt.State) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return saveSyncState(c.db, state)
+}
+
+func (b batch) SaveSyncState(state *crdt.State) error {
+	return saveSyncState(b.w, state)
+}
+
+func (u *unitOfWork) LoadSyncState() (*crdt.State, error) {
+	return loadSyncState(u.tx)
+}
+
+func loadSyncState(tx storage.Tx) (*crdt.State, error) {
+	val, err := tx.GetSyncState()
+	if err != nil {
+		return nil, err
+	}
+	if len(val) == 0 {
+		return nil, nil
+	}
+
+	state := &crdt.State{}
+	if err := json.Unmarshal(val, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func saveSyncState(w storage.Batch, state *crdt.State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return w.SetSyncState(data)
+}
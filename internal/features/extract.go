@@ -0,0 +1,288 @@
+package features
+
+import (
+	"GO_player/internal/audio"
+	"GO_player/internal/models"
+	"math"
+	"math/cmplx"
+)
+
+const (
+	minTempo = 60.0
+	maxTempo = 200.0
+
+	// Chroma is taken from the range where the fundamentals of most
+	// instruments lie.
+	minChromaFreq = 55.0
+	maxChromaFreq = 5000.0
+)
+
+// Krumhansl-Kessler key profiles, starting at the tonic.
+var (
+	majorProfile = [12]float64{6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88}
+	minorProfile = [12]float64{6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17}
+)
+
+// stft cuts a mono signal into overlapping Hann windows and hands the
+// magnitude spectrum of each to a callback.
+type stft struct {
+	size    int
+	hop     int
+	window  []float64
+	buf     []float64
+	spec    []complex128
+	mag     []float64
+	onFrame func(mag []float64)
+}
+
+// newSTFT uses windows of about the given length in seconds, rounded up to a
+// power of two samples, overlapping by half.
+func newSTFT(rate int, length float64, onFrame func(mag []float64)) *stft {
+	size := 1
+	for float64(size) < float64(rate)*length {
+		size <<= 1
+	}
+	s := &stft{
+		size:    size,
+		hop:     size / 2,
+		window:  make([]float64, size),
+		spec:    make([]complex128, size),
+		mag:     make([]float64, size/2+1),
+		onFrame: onFrame,
+	}
+	for i := range s.window {
+		s.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size))
+	}
+	return s
+}
+
+func (s *stft) write(mono []float64) {
+	s.buf = append(s.buf, mono...)
+	for len(s.buf) >= s.size {
+		for i, v := range s.buf[:s.size] {
+			s.spec[i] = complex(v*s.window[i], 0)
+		}
+		fft(s.spec)
+		for k := range s.mag {
+			s.mag[k] = cmplx.Abs(s.spec[k])
+		}
+		s.onFrame(s.mag)
+		s.buf = s.buf[:copy(s.buf, s.buf[s.hop:])]
+	}
+}
+
+// analyzer accumulates what the features are made of. Onsets need a fine time
+// resolution and chroma a fine frequency resolution, so they come from two
+// transforms of different sizes.
+type analyzer struct {
+	rate  float64
+	short *stft
+	long  *stft
+	prev  []float64
+	pitch []int
+
+	onsets      []float64
+	chroma      [12]float64
+	centroidSum float64
+	magSum      float64
+}
+
+func newAnalyzer(rate int) *analyzer {
+	a := &analyzer{rate: float64(rate)}
+	a.short = newSTFT(rate, 0.023, a.onset)
+	a.long = newSTFT(rate, 0.186, a.spectrum)
+	a.prev = make([]float64, a.short.size/2+1)
+	a.pitch = make([]int, a.long.size/2+1)
+	for k := range a.pitch {
+		f := a.freq(a.long, k)
+		a.pitch[k] = -1
+		if f >= minChromaFreq && f <= maxChromaFreq {
+			// Pitch class relative to C, A4 being 440 Hz.
+			a.pitch[k] = ((int(math.Round(12*math.Log2(f/440)))+9)%12 + 12) % 12
+		}
+	}
+	return a
+}
+
+func (a *analyzer) freq(s *stft, bin int) float64 {
+	return float64(bin) * a.rate / float64(s.size)
+}
+
+func (a *analyzer) write(mono []float64) {
+	a.short.write(mono)
+	a.long.write(mono)
+}
+
+// onset measures how much the log magnitude rose since the previous frame,
+// which peaks where notes and beats start.
+func (a *analyzer) onset(mag []float64) {
+	var flux float64
+	for k, m := range mag {
+		if d := math.Log1p(100*m) - math.Log1p(100*a.prev[k]); d > 0 {
+			flux += d
+		}
+	}
+	a.onsets = append(a.onsets, flux)
+	copy(a.prev, mag)
+}
+
+func (a *analyzer) spectrum(mag []float64) {
+	for k, m := range mag {
+		a.centroidSum += a.freq(a.long, k) * m
+		a.magSum += m
+		if pc := a.pitch[k]; pc >= 0 {
+			a.chroma[pc] += m * m
+		}
+	}
+}
+
+func (a *analyzer) centroid() float64 {
+	if a.magSum == 0 {
+		return 0
+	}
+	return a.centroidSum / a.magSum
+}
+
+// tempo finds the beat period as the strongest autocorrelation of the onset
+// envelope between minTempo and maxTempo, favouring periods around 120 BPM
+// so that a song is not counted at half or double its tempo. It returns 0 when
+// there is no periodicity to speak of.
+func (a *analyzer) tempo() float64 {
+	env := a.onsets
+	if len(env) < 4 {
+		return 0
+	}
+	var mean float64
+	for _, v := range env {
+		mean += v
+	}
+	mean /= float64(len(env))
+	centered := make([]float64, len(env))
+	var energy float64
+	for i, v := range env {
+		centered[i] = v - mean
+		energy += centered[i] * centered[i]
+	}
+	if energy == 0 {
+		return 0
+	}
+
+	envRate := a.rate / float64(a.short.hop)
+	minLag := max(1, int(math.Floor(envRate*60/maxTempo)))
+	maxLag := min(len(env)-2, int(math.Ceil(envRate*60/minTempo)))
+	if minLag >= maxLag {
+		return 0
+	}
+	acf := make([]float64, maxLag+2)
+	for lag := minLag - 1; lag <= maxLag+1; lag++ {
+		if lag <= 0 {
+			continue
+		}
+		var sum float64
+		for i := lag; i < len(centered); i++ {
+			sum += centered[i] * centered[i-lag]
+		}
+		acf[lag] = sum / energy
+	}
+
+	best, bestScore := 0, 0.0
+	for lag := minLag; lag <= maxLag; lag++ {
+		bpm := 60 * envRate / float64(lag)
+		prior := math.Exp(-0.5 * math.Pow(math.Log2(bpm/120), 2))
+		if score := acf[lag] * prior; score > bestScore {
+			best, bestScore = lag, score
+		}
+	}
+	if best == 0 {
+		return 0
+	}
+
+	// Refine the lag between envelope samples with a parabola through the
+	// peak and its neighbours.
+	lag := float64(best)
+	y0, y1, y2 := acf[best-1], acf[best], acf[best+1]
+	if d := y0 - 2*y1 + y2; d < 0 {
+		lag += 0.5 * (y0 - y2) / d
+	}
+	return 60 * envRate / lag
+}
+
+// key correlates the chroma with the major and minor profiles in every
+// transposition.
+func (a *analyzer) key() (int, bool) {
+	best, minor, bestR := 0, false, math.Inf(-1)
+	for tonic := 0; tonic < 12; tonic++ {
+		var rotated [12]float64
+		for i := range rotated {
+			rotated[i] = a.chroma[(tonic+i)%12]
+		}
+		if r := correlation(rotated, majorProfile); r > bestR {
+			best, minor, bestR = tonic, false, r
+		}
+		if r := correlation(rotated, minorProfile); r > bestR {
+			best, minor, bestR = tonic, true, r
+		}
+	}
+	return best, minor
+}
+
+func correlation(x, y [12]float64) float64 {
+	var mx, my float64
+	for i := range x {
+		mx += x[i]
+		my += y[i]
+	}
+	mx /= 12
+	my /= 12
+	var sxy, sxx, syy float64
+	for i := range x {
+		sxy += (x[i] - mx) * (y[i] - my)
+		sxx += (x[i] - mx) * (x[i] - mx)
+		syy += (y[i] - my) * (y[i] - my)
+	}
+	if sxx == 0 || syy == 0 {
+		return 0
+	}
+	return sxy / math.Sqrt(sxx*syy)
+}
+
+// Analyzer computes the features of a song from its decoded samples, so that
+// they can be taken from the same decode as its loudness.
+type Analyzer struct {
+	channels int
+	an       *analyzer
+	mono     []float64
+}
+
+func NewAnalyzer(format audio.Format) *Analyzer {
+	return &Analyzer{channels: format.Channels, an: newAnalyzer(format.SampleRate)}
+}
+
+// Write takes interleaved samples in the analyzer's format.
+func (a *Analyzer) Write(samples []float32) {
+	a.mono = a.mono[:0]
+	for i := 0; i+a.channels <= len(samples); i += a.channels {
+		var sum float64
+		for _, s := range samples[i : i+a.channels] {
+			sum += float64(s)
+		}
+		a.mono = append(a.mono, sum/float64(a.channels))
+	}
+	a.an.write(a.mono)
+}
+
+// Features returns what the samples written so far sound like. The loudness,
+// and the file size and time the features go with, are those of the song's
+// loudness measurement.
+func (a *Analyzer) Features(l *models.Loudness) *models.Features {
+	key, minor := a.an.key()
+	return &models.Features{
+		Tempo:    a.an.tempo(),
+		Loudness: l.Integrated,
+		Centroid: a.an.centroid(),
+		Key:      key,
+		Minor:    minor,
+		Size:     l.Size,
+		ModTime:  l.ModTime,
+	}
+}
@@ -0,0 +1,102 @@
+package features
+
+import (
+	"GO_player/internal/models"
+	"math"
+	"os"
+	"sort"
+)
+
+// Similarity compares two songs from 0, nothing alike, to 1. Tempos are
+// compared up to an octave, so a song at half or double the tempo of another
+// counts as close, and keys by their distance on the circle of fifths with
+// relative major and minor keys being the same.
+func Similarity(a, b *models.Features) float64 {
+	var dist float64
+	var dims int
+	add := func(d float64) {
+		dist += d * d
+		dims++
+	}
+
+	if a.Tempo > 0 && b.Tempo > 0 {
+		x := math.Log2(a.Tempo / b.Tempo)
+		add((x - math.Round(x)) / 0.1)
+	}
+	add((a.Loudness - b.Loudness) / 6)
+	if a.Centroid > 0 && b.Centroid > 0 {
+		add(math.Log2(a.Centroid/b.Centroid) / 0.5)
+	}
+	d := fifths(a) - fifths(b)
+	if d < 0 {
+		d = -d
+	}
+	add(float64(min(d, 12-d)) / 2)
+
+	return math.Exp(-dist / float64(2*dims))
+}
+
+// fifths returns the position of a song's key on the circle of fifths, minor
+// keys taking the place of their relative major.
+func fifths(f *models.Features) int {
+	key := f.Key
+	if f.Minor {
+		key += 3
+	}
+	return key * 7 % 12
+}
+
+// ColdStart returns pseudo-edges between each song of cold and the neighbors
+// songs that sound the most like it, in both directions, weighted by weight
+// times their similarity. Songs without features are left out.
+func ColdStart(songs []*models.Song, cold map[int64]bool, neighbors int, weight float64) map[int64]map[int64]float64 {
+	edges := make(map[int64]map[int64]float64)
+	if neighbors <= 0 || weight <= 0 {
+		return edges
+	}
+
+	add := func(fromID, toID int64, w float64) {
+		if edges[fromID] == nil {
+			edges[fromID] = make(map[int64]float64)
+		}
+		edges[fromID][toID] = max(edges[fromID][toID], w)
+	}
+
+	type match struct {
+		id  int64
+		sim float64
+	}
+	for _, target := range songs {
+		if !cold[target.ID] || target.Features == nil {
+			continue
+		}
+		matches := make([]match, 0, len(songs))
+		for _, song := range songs {
+			if song.ID == target.ID || song.Features == nil {
+				continue
+			}
+			matches = append(matches, match{id: song.ID, sim: Similarity(song.Features, target.Features)})
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			if matches[i].sim != matches[j].sim {
+				return matches[i].sim > matches[j].sim
+			}
+			return matches[i].id < matches[j].id
+		})
+
+		for _, m := range matches[:min(neighbors, len(matches))] {
+			if m.sim <= 0 {
+				break
+			}
+			add(m.id, target.ID, weight*m.sim)
+			add(target.ID, m.id, weight*m.sim)
+		}
+	}
+	return edges
+}
+
+// Current reports whether a song's features still match its file.
+func Current(song *models.Song, info os.FileInfo) bool {
+	f := song.Features
+	return f != nil && f.Size == info.Size() && f.ModTime.Equal(info.ModTime().UTC())
+}
@@ -0,0 +1,242 @@
+package importer
+
+import (
+	"GO_player/internal/catalog"
+	"GO_player/internal/memory/basegraph"
+	"GO_player/internal/memory/feedback"
+	"GO_player/internal/models"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatLastFMCSV    Format = "lastfm-csv"
+	FormatLastFMJSON   Format = "lastfm-json"
+	FormatListenBrainz Format = "listenbrainz"
+	FormatSpotify      Format = "spotify"
+)
+
+const (
+	defaultMinScore   = 0.85
+	defaultSessionGap = 30 * time.Minute
+	// unknownDuration is assumed for songs whose length is known neither to
+	// the catalog nor to the export.
+	unknownDuration = 180.0
+	maxUnmatched    = 20
+)
+
+// Play is one listen read from an export. Played and Duration are in seconds;
+// Finished marks a song that was heard to the end, which is what a scrobble
+// means when the export has no play time.
+type Play struct {
+	Artist   string
+	Title    string
+	Album    string
+	Start    time.Time
+	Played   float64
+	Duration float64
+	Finished bool
+}
+
+func Parse(format Format, r io.Reader) ([]Play, error) {
+	switch format {
+	case FormatLastFMCSV:
+		return parseLastFMCSV(r)
+	case FormatLastFMJSON:
+		return parseLastFMJSON(r)
+	case FormatListenBrainz:
+		return parseListenBrainz(r)
+	case FormatSpotify:
+		return parseSpotify(r)
+	default:
+		return nil, fmt.Errorf("unknown history format %q", format)
+	}
+}
+
+type Options struct {
+	// MinScore is the fuzzy match score, between 0 and 1, a song needs to be
+	// taken as the played track.
+	MinScore float64
+	// SessionGap is the pause after which the next play starts a new session
+	// instead of continuing the previous song.
+	SessionGap time.Duration
+	// Policy turns each play into feedback, the default policy when nil.
+	Policy feedback.Policy
+	DryRun bool
+}
+
+type Result struct {
+	Plays       int      `json:"plays"`
+	Matched     int      `json:"matched"`
+	Transitions int      `json:"transitions"`
+	Reinforced  int      `json:"reinforced"`
+	Penalized   int      `json:"penalized"`
+	CrossAlbum  int      `json:"cross_album"`
+	Albums      []int64  `json:"albums"`
+	Unmatched   []string `json:"unmatched"`
+}
+
+type transition struct {
+	fromID int64
+	toID   int64
+	update feedback.Update
+}
+
+// Import matches the plays to the catalog's songs and replays each pair of
+// consecutive plays as feedback on the graph of the album both songs belong
+// to, using the same feedback policy as live playback. Transitions between albums
+// go to the library graph used by radio mode, and songs without an album
+// belong to album 0. No App may be running on the catalog's profile at the
+// same time, or it would overwrite the result.
+func Import(cat catalog.Catalog, plays []Play, opts Options) (*Result, error) {
+	if opts.MinScore <= 0 {
+		opts.MinScore = defaultMinScore
+	}
+	if opts.SessionGap <= 0 {
+		opts.SessionGap = defaultSessionGap
+	}
+	if opts.Policy == nil {
+		opts.Policy = feedback.DefaultPolicy()
+	}
+
+	songs, err := cat.ListSongs()
+	if err != nil {
+		return nil, err
+	}
+	m := newMatcher(songs, opts.MinScore)
+
+	sorted := make([]Play, len(plays))
+	copy(sorted, plays)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+
+	res := &Result{Plays: len(sorted), Albums: []int64{}, Unmatched: []string{}}
+	albums := make(map[int64][]transition)
+	var library []transition
+	unmatched := make(map[string]bool)
+
+	var prev *models.Song
+	var prevEnd time.Time
+	for _, p := range sorted {
+		song, ok := m.match(p)
+		if !ok {
+			name := p.Artist + " - " + p.Title
+			if !unmatched[name] && len(res.Unmatched) < maxUnmatched {
+				res.Unmatched = append(res.Unmatched, name)
+			}
+			unmatched[name] = true
+			prev = nil
+			continue
+		}
+		res.Matched++
+
+		if prev != nil && prev.ID != song.ID && p.Start.Sub(prevEnd) <= opts.SessionGap {
+			t := transition{fromID: prev.ID, toID: song.ID, update: opts.Policy.Played(progress(p, song))}
+			if prev.AlbumID == song.AlbumID {
+				albums[song.AlbumID] = append(albums[song.AlbumID], t)
+			} else {
+				library = append(library, t)
+				res.CrossAlbum++
+			}
+			res.Transitions++
+			if t.update.Reward > 0 {
+				res.Reinforced++
+			}
+			if t.update.Penalty > 0 || t.update.Clear {
+				res.Penalized++
+			}
+		}
+
+		prev = song
+		prevEnd = p.Start.Add(time.Duration(playedTime(p, song) * float64(time.Second)))
+	}
+
+	for albumID := range albums {
+		res.Albums = append(res.Albums, albumID)
+	}
+	sort.Slice(res.Albums, func(i, j int) bool { return res.Albums[i] < res.Albums[j] })
+
+	if opts.DryRun || res.Transitions == 0 {
+		return res, nil
+	}
+
+	err = cat.Update(func(uow catalog.UnitOfWork) error {
+		for albumID, transitions := range albums {
+			edges, err := uow.LoadBaseGraphEdges(albumID)
+			if err != nil {
+				return err
+			}
+			bg, err := replay(edges, transitions)
+			if err != nil {
+				return err
+			}
+			if err := uow.SaveBaseGraph(albumID, bg); err != nil {
+				return err
+			}
+		}
+
+		if len(library) == 0 {
+			return nil
+		}
+		edges, err := uow.LoadLibraryGraphEdges()
+		if err != nil {
+			return err
+		}
+		bg, err := replay(edges, library)
+		if err != nil {
+			return err
+		}
+		return uow.SaveLibraryGraphEdges(bg.GetEdges())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// replay applies the transitions to a fresh graph so that a retried unit of
+// work starts again from the stored edges.
+func replay(edges map[int64]map[int64]float64, transitions []transition) (*basegraph.BaseGraph, error) {
+	bg := basegraph.NewBaseGraph()
+	if err := bg.SetEdges(edges); err != nil {
+		return nil, err
+	}
+	for _, t := range transitions {
+		if t.update.Clear {
+			bg.Remove(t.fromID, t.toID)
+		}
+		bg.Reinforce(t.fromID, t.toID, t.update.Reward)
+		bg.Penalty(t.fromID, t.toID, t.update.Penalty)
+	}
+	return bg, nil
+}
+
+func duration(p Play, song *models.Song) float64 {
+	if song.Duration > 0 {
+		return song.Duration
+	}
+	if p.Duration > 0 {
+		return p.Duration
+	}
+	return unknownDuration
+}
+
+func progress(p Play, song *models.Song) float64 {
+	if p.Finished {
+		return 1
+	}
+	progress, _ := feedback.Progress(p.Played, duration(p, song))
+	return progress
+}
+
+func playedTime(p Play, song *models.Song) float64 {
+	if p.Finished {
+		return duration(p, song)
+	}
+	return p.Played
+}
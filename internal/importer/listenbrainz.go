@@ -0,0 +1,91 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+	"unicode"
+)
+
+type listenBrainzListen struct {
+	ListenedAt    int64 `json:"listened_at"`
+	TrackMetadata struct {
+		ArtistName     string `json:"artist_name"`
+		TrackName      string `json:"track_name"`
+		ReleaseName    string `json:"release_name"`
+		AdditionalInfo struct {
+			DurationMS int64 `json:"duration_ms"`
+			Duration   int64 `json:"duration"`
+		} `json:"additional_info"`
+	} `json:"track_metadata"`
+}
+
+// parseListenBrainz reads the JSON array of the older exports as well as the
+// JSON lines files of the newer ones.
+func parseListenBrainz(r io.Reader) ([]Play, error) {
+	br := bufio.NewReader(r)
+	var listens []listenBrainzListen
+
+	c, err := firstNonSpace(br)
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(br)
+	if c == '[' {
+		if err := dec.Decode(&listens); err != nil {
+			return nil, err
+		}
+	} else {
+		for {
+			var l listenBrainzListen
+			err := dec.Decode(&l)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			listens = append(listens, l)
+		}
+	}
+
+	plays := make([]Play, 0, len(listens))
+	for _, l := range listens {
+		if l.ListenedAt == 0 {
+			continue
+		}
+		md := l.TrackMetadata
+		duration := float64(md.AdditionalInfo.DurationMS) / 1000
+		if duration == 0 {
+			duration = float64(md.AdditionalInfo.Duration)
+		}
+		plays = append(plays, Play{
+			Artist:   md.ArtistName,
+			Title:    md.TrackName,
+			Album:    md.ReleaseName,
+			Start:    time.Unix(l.ListenedAt, 0),
+			Duration: duration,
+			Finished: true,
+		})
+	}
+	return plays, nil
+}
+
+// firstNonSpace returns the first non-space byte without consuming it.
+func firstNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if !unicode.IsSpace(rune(c)) && c != 0xEF && c != 0xBB && c != 0xBF {
+			return c, br.UnreadByte()
+		}
+	}
+}
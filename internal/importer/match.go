@@ -0,0 +1,193 @@
+package importer
+
+import (
+	"GO_player/internal/models"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// durationTolerance is how far, in seconds, a song's length may be from the
+// played track's before the match is penalized.
+const durationTolerance = 10.0
+
+type normalizedSong struct {
+	song   *models.Song
+	artist string
+	title  string
+}
+
+type matcher struct {
+	songs    []normalizedSong
+	exact    map[string][]*models.Song
+	cache    map[string]*models.Song
+	minScore float64
+}
+
+func newMatcher(songs []*models.Song, minScore float64) *matcher {
+	m := &matcher{
+		exact:    make(map[string][]*models.Song),
+		cache:    make(map[string]*models.Song),
+		minScore: minScore,
+	}
+	for _, song := range songs {
+		n := normalizedSong{song: song, artist: normalize(song.Artist), title: normalize(song.Title)}
+		m.songs = append(m.songs, n)
+		key := n.artist + "\x00" + n.title
+		m.exact[key] = append(m.exact[key], song)
+	}
+	return m
+}
+
+func (m *matcher) match(p Play) (*models.Song, bool) {
+	artist, title := normalize(p.Artist), normalize(p.Title)
+	if title == "" {
+		return nil, false
+	}
+
+	// The match depends on the play's duration, so that is part of the
+	// cache key.
+	key := artist + "\x00" + title
+	cacheKey := key + "\x00" + strconv.FormatFloat(max(p.Duration, 0), 'g', -1, 64)
+	if song, ok := m.cache[cacheKey]; ok {
+		return song, song != nil
+	}
+
+	var best *models.Song
+	for _, song := range m.exact[key] {
+		if durationMatches(p, song) {
+			best = song
+			break
+		}
+	}
+	if best == nil {
+		best = m.fuzzy(p, artist, title)
+	}
+
+	m.cache[cacheKey] = best
+	return best, best != nil
+}
+
+// fuzzy scores every song by the edit distance of title and artist. Songs
+// without an artist are matched on the title alone.
+func (m *matcher) fuzzy(p Play, artist, title string) *models.Song {
+	var best *models.Song
+	bestScore := m.minScore
+	for _, n := range m.songs {
+		score := similarity(title, n.title)
+		if score < m.minScore-0.3 {
+			continue
+		}
+		if artist != "" && n.artist != "" {
+			score = 0.7*score + 0.3*similarity(artist, n.artist)
+		}
+		if !durationMatches(p, n.song) {
+			score -= 0.2
+		}
+		if score >= bestScore {
+			best = n.song
+			bestScore = score
+		}
+	}
+	return best
+}
+
+func durationMatches(p Play, song *models.Song) bool {
+	if p.Duration <= 0 || song.Duration <= 0 {
+		return true
+	}
+	return math.Abs(p.Duration-song.Duration) <= durationTolerance
+}
+
+// normalize lowercases s and drops what exports add to the same track:
+// bracketed notes, "feat." credits, " - Remastered" suffixes and punctuation.
+func normalize(s string) string {
+	s = strings.ToLower(s)
+	s = stripBracketed(s)
+	for _, sep := range []string{" feat. ", " feat ", " ft. ", " featuring "} {
+		if i := strings.Index(s, sep); i >= 0 {
+			s = s[:i]
+		}
+	}
+	if i := strings.Index(s, " - "); i >= 0 {
+		suffix := s[i:]
+		if strings.Contains(suffix, "remaster") || strings.Contains(suffix, "version") ||
+			strings.Contains(suffix, "edit") || strings.Contains(suffix, "live") || strings.Contains(suffix, "mono") {
+			s = s[:i]
+		}
+	}
+
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+			continue
+		}
+		if r == '\'' || r == '’' {
+			continue
+		}
+		space = true
+	}
+	return b.String()
+}
+
+func stripBracketed(s string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range s {
+		switch r {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			if depth > 0 {
+				depth--
+			}
+		default:
+			if depth == 0 {
+				b.WriteRune(r)
+			}
+		}
+	}
+	if b.Len() == 0 {
+		return s
+	}
+	return b.String()
+}
+
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
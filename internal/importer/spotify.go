@@ -0,0 +1,69 @@
+package importer
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// spotifyStream covers both the extended streaming history and the shorter
+// account data export (endTime, artistName, trackName, msPlayed).
+type spotifyStream struct {
+	TS         string  `json:"ts"`
+	MSPlayed   float64 `json:"ms_played"`
+	Track      *string `json:"master_metadata_track_name"`
+	Artist     *string `json:"master_metadata_album_artist_name"`
+	Album      *string `json:"master_metadata_album_album_name"`
+	ReasonEnd  string  `json:"reason_end"`
+	EndTime    string  `json:"endTime"`
+	ArtistName string  `json:"artistName"`
+	TrackName  string  `json:"trackName"`
+	PlayedMS   float64 `json:"msPlayed"`
+}
+
+// parseSpotify reads a streaming history file. Spotify stamps a stream with
+// the time it ended, so the start is derived from the time played. Podcast
+// episodes have no track name and are left out.
+func parseSpotify(r io.Reader) ([]Play, error) {
+	var streams []spotifyStream
+	if err := json.NewDecoder(r).Decode(&streams); err != nil {
+		return nil, err
+	}
+
+	plays := make([]Play, 0, len(streams))
+	for _, s := range streams {
+		p := Play{}
+		end := s.TS
+		if s.Track != nil {
+			p.Title = *s.Track
+			if s.Artist != nil {
+				p.Artist = *s.Artist
+			}
+			if s.Album != nil {
+				p.Album = *s.Album
+			}
+			p.Played = s.MSPlayed / 1000
+		} else {
+			p.Title = s.TrackName
+			p.Artist = s.ArtistName
+			p.Played = s.PlayedMS / 1000
+			end = s.EndTime
+		}
+		if p.Title == "" || end == "" {
+			continue
+		}
+
+		endTime, err := parseTime(end)
+		if err != nil {
+			continue
+		}
+		p.Start = endTime.Add(-time.Duration(p.Played * float64(time.Second)))
+
+		// A track played to its end tells its length.
+		if s.ReasonEnd == "trackdone" {
+			p.Duration = p.Played
+		}
+		plays = append(plays, p)
+	}
+	return plays, nil
+}
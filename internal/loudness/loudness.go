@@ -0,0 +1,115 @@
+package loudness
+
+import (
+	"GO_player/internal/catalog"
+	"GO_player/internal/models"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// DefaultTarget is the loudness songs are brought to, the ReplayGain 2
+// reference level.
+const DefaultTarget = -18.0
+
+type Mode string
+
+const (
+	ModeOff   Mode = "off"
+	ModeTrack Mode = "track"
+	// ModeAlbum keeps the loudness differences within an album and falls
+	// back to the track gain for songs whose album was not measured.
+	ModeAlbum Mode = "album"
+)
+
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case ModeOff, ModeTrack, ModeAlbum:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown gain mode %q", s)
+}
+
+// Gain returns the factor that brings a measurement to target LUFS, lowered
+// when needed so that the peak does not clip.
+func Gain(l *models.Loudness, target float64) float64 {
+	gain := math.Pow(10, (target-l.Integrated)/20)
+	if l.Peak > 0 {
+		gain = min(gain, 1/l.Peak)
+	}
+	return gain
+}
+
+// Combine measures an album from its songs: the energy average of their
+// loudness weighted by duration, and the largest peak. It is close to, but
+// not the same as, gating the album as one stream.
+func Combine(songs []*models.Loudness) *models.Loudness {
+	var energy, duration, peak float64
+	for _, l := range songs {
+		d := max(l.Duration, 1e-3)
+		energy += d * math.Pow(10, l.Integrated/10)
+		duration += d
+		peak = max(peak, l.Peak)
+	}
+	if duration == 0 {
+		return nil
+	}
+	return &models.Loudness{
+		Integrated: max(absoluteGate, 10*math.Log10(energy/duration)),
+		Peak:       peak,
+		Duration:   duration,
+	}
+}
+
+// Measurement returns what the meter measured of the file described by info.
+func (m *Meter) Measurement(info os.FileInfo) *models.Loudness {
+	return &models.Loudness{
+		Integrated: m.Integrated(),
+		Peak:       m.Peak(),
+		Duration:   m.Duration(),
+		Size:       info.Size(),
+		ModTime:    info.ModTime().UTC(),
+	}
+}
+
+// Current reports whether a song's measurement still matches its file.
+func Current(song *models.Song, info os.FileInfo) bool {
+	l := song.Loudness
+	return l != nil && l.Size == info.Size() && l.ModTime.Equal(info.ModTime().UTC())
+}
+
+// UpdateAlbums measures again the albums with a changed song, and those that
+// were never measured, from the songs' measurements. It returns how many
+// albums it saved.
+func UpdateAlbums(cat catalog.Catalog, songs []*models.Song, changed map[int64]bool, force bool) (int, error) {
+	byAlbum := make(map[int64][]*models.Loudness)
+	for _, song := range songs {
+		if song.AlbumID != 0 && song.Loudness != nil {
+			byAlbum[song.AlbumID] = append(byAlbum[song.AlbumID], song.Loudness)
+		}
+	}
+	ids := make([]int64, 0, len(byAlbum))
+	for id := range byAlbum {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	updated := 0
+	for _, id := range ids {
+		album, err := cat.LoadAlbum(id)
+		if err != nil {
+			return updated, err
+		}
+		if album.Loudness != nil && !changed[id] && !force {
+			continue
+		}
+		album.ID = id
+		album.Loudness = Combine(byAlbum[id])
+		if err := cat.SaveAlbum(id, album); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
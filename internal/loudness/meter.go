@@ -0,0 +1,170 @@
+package loudness
+
+import (
+	"GO_player/internal/audio"
+	"math"
+)
+
+const (
+	// absoluteGate drops silence; relativeGate drops the quiet parts of a
+	// song relative to its average (EBU R128).
+	absoluteGate = -70.0
+	relativeGate = -10.0
+
+	blockSteps = 4 // 400 ms blocks made of 100 ms steps, overlapping by 75%
+)
+
+// biquad is a second order IIR filter in direct form I.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// kWeighting returns the two stages of the ITU-R BS.1770 K filter for a
+// sample rate: a high shelf modelling the head, then a high-pass.
+func kWeighting(rate float64) (biquad, biquad) {
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / rate)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / rate)
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1, b1: -2, b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return shelf, highPass
+}
+
+// channelWeight follows BS.1770 for 5.1 in WAVE order: the LFE channel is
+// left out and the surrounds count a bit more. Other layouts weigh every
+// channel the same.
+func channelWeight(channels, ch int) float64 {
+	if channels != 6 {
+		return 1
+	}
+	return []float64{1, 1, 1, 0, 1.41, 1.41}[ch]
+}
+
+// Meter measures the integrated loudness and the sample peak of interleaved
+// samples written to it.
+type Meter struct {
+	format  audio.Format
+	filters [][2]biquad
+	weights []float64
+
+	stepFrames int
+	stepFill   int
+	stepSum    float64
+	steps      []float64
+	blocks     []float64
+
+	frames int64
+	peak   float64
+}
+
+func NewMeter(format audio.Format) *Meter {
+	m := &Meter{
+		format:     format,
+		filters:    make([][2]biquad, format.Channels),
+		weights:    make([]float64, format.Channels),
+		stepFrames: max(1, format.SampleRate/10),
+	}
+	for ch := range m.filters {
+		shelf, highPass := kWeighting(float64(format.SampleRate))
+		m.filters[ch] = [2]biquad{shelf, highPass}
+		m.weights[ch] = channelWeight(format.Channels, ch)
+	}
+	return m
+}
+
+func (m *Meter) Write(samples []float32) {
+	channels := m.format.Channels
+	for i := 0; i+channels <= len(samples); i += channels {
+		for ch := 0; ch < channels; ch++ {
+			x := float64(samples[i+ch])
+			m.peak = max(m.peak, math.Abs(x))
+			f := &m.filters[ch]
+			y := f[1].process(f[0].process(x))
+			m.stepSum += m.weights[ch] * y * y
+		}
+		m.frames++
+
+		m.stepFill++
+		if m.stepFill < m.stepFrames {
+			continue
+		}
+		m.steps = append(m.steps, m.stepSum/float64(m.stepFrames))
+		m.stepSum, m.stepFill = 0, 0
+		if n := len(m.steps); n >= blockSteps {
+			var power float64
+			for _, p := range m.steps[n-blockSteps:] {
+				power += p
+			}
+			m.blocks = append(m.blocks, power/blockSteps)
+			m.steps = m.steps[n-blockSteps+1:]
+		}
+	}
+}
+
+// Integrated returns the gated loudness in LUFS. Songs that are silent, or
+// shorter than one block, come out at the absolute gate.
+func (m *Meter) Integrated() float64 {
+	var sum float64
+	var n int
+	for _, p := range m.blocks {
+		if lufs(p) > absoluteGate {
+			sum += p
+			n++
+		}
+	}
+	if n == 0 {
+		return absoluteGate
+	}
+
+	gate := lufs(sum/float64(n)) + relativeGate
+	sum, n = 0, 0
+	for _, p := range m.blocks {
+		if l := lufs(p); l > absoluteGate && l > gate {
+			sum += p
+			n++
+		}
+	}
+	if n == 0 {
+		return absoluteGate
+	}
+	return lufs(sum / float64(n))
+}
+
+func (m *Meter) Peak() float64 {
+	return m.peak
+}
+
+func (m *Meter) Duration() float64 {
+	return float64(m.frames) / float64(m.format.SampleRate)
+}
+
+func lufs(power float64) float64 {
+	if power <= 0 {
+		return math.Inf(-1)
+	}
+	return -0.691 + 10*math.Log10(power)
+}
@@ -31,31 +31,83 @@ func (graph *BaseGraph) Reinforce(fromID, toID int64, value float64) {
 	graph.edges[fromID][toID] += value
 }
 
-func (graph *BaseGraph) Penalty(fromID, toID int64, value float64) {
+// Penalty takes value off the edge from fromID to toID and reports whether
+// it did; an edge lighter than value is left alone.
+func (graph *BaseGraph) Penalty(fromID, toID int64, value float64) bool {
 	graph.mu.Lock()
 	defer graph.mu.Unlock()
 
 	if value <= 0 {
-		return
+		return false
 	}
 
 	if graph.edges[fromID] == nil {
-		return
+		return false
 	}
-	if graph.edges[fromID][toID] >= value {
+	applied := graph.edges[fromID][toID] >= value
+	if applied {
 		graph.edges[fromID][toID] -= value
 	} else {
 		//TODO: handle error
 	}
 
 	if graph.edges[0] == nil {
-		return
+		return applied
 	}
 	if graph.edges[0][toID] >= value {
 		graph.edges[0][toID] -= value
 	} else {
 		//TODO: handle error
 	}
+	return applied
+}
+
+// Remove drops the edge from fromID to toID and takes its weight off the
+// edge from 0, which sums what leads into toID. It returns the weight the
+// edge had.
+func (graph *BaseGraph) Remove(fromID, toID int64) float64 {
+	graph.mu.Lock()
+	defer graph.mu.Unlock()
+
+	weight, ok := graph.edges[fromID][toID]
+	if !ok {
+		return 0
+	}
+	delete(graph.edges[fromID], toID)
+	if fromID == 0 || graph.edges[0] == nil {
+		return weight
+	}
+	if rest := graph.edges[0][toID] - weight; rest > 0 {
+		graph.edges[0][toID] = rest
+	} else {
+		delete(graph.edges[0], toID)
+	}
+	return weight
+}
+
+// Adjust adds delta, which may be negative, to the edge from fromID to toID
+// and to the edge from 0 the way Reinforce does. Edges that drop to 0 are
+// removed. Unlike Penalty it never ignores a change, so it can take back
+// earlier updates exactly.
+func (graph *BaseGraph) Adjust(fromID, toID int64, delta float64) {
+	graph.mu.Lock()
+	defer graph.mu.Unlock()
+
+	adjust := func(id int64) {
+		if graph.edges[id] == nil {
+			if delta <= 0 {
+				return
+			}
+			graph.edges[id] = make(map[int64]float64)
+		}
+		if weight := graph.edges[id][toID] + delta; weight > 0 {
+			graph.edges[id][toID] = weight
+		} else {
+			delete(graph.edges[id], toID)
+		}
+	}
+	adjust(0)
+	adjust(fromID)
 }
 
 func (graph *BaseGraph) GetEdgesForID(id int64) map[int64]float64 {
@@ -0,0 +1,274 @@
+package crdt
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+const LibraryGraph = "library"
+
+const epsilon = 1e-9
+
+func AlbumGraph(albumID int64) string {
+	return fmt.Sprintf("album/%d", albumID)
+}
+
+// ParseAlbumGraph returns the album of a graph name made by AlbumGraph.
+func ParseAlbumGraph(graph string) (int64, bool) {
+	var id int64
+	if _, err := fmt.Sscanf(graph, "album/%d", &id); err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// Vector holds, per device, the last sequence number seen from it.
+type Vector map[string]uint64
+
+func (v Vector) copy() Vector {
+	res := make(Vector, len(v))
+	for device, seq := range v {
+		res[device] = seq
+	}
+	return res
+}
+
+// Counter is one device's learning on one edge. Base is the weight the device
+// had before its first sync; it never changes afterwards. Both totals only
+// grow, and only the owning device increments them, so merging takes the
+// maximum of every field.
+type Counter struct {
+	Base      float64 `json:"b,omitempty"`
+	Reinforce float64 `json:"r"`
+	Penalty   float64 `json:"p"`
+	Seq       uint64  `json:"seq"`
+}
+
+type Entry struct {
+	Graph  string `json:"graph"`
+	From   int64  `json:"from"`
+	To     int64  `json:"to"`
+	Device string `json:"device"`
+	Counter
+}
+
+// Delta carries the entries a peer has not seen yet and the vector of the
+// state they were taken from.
+type Delta struct {
+	Vector  Vector  `json:"vector"`
+	Entries []Entry `json:"entries"`
+}
+
+type edgeKey struct {
+	graph    string
+	from, to int64
+}
+
+// State is the replicated form of every graph of a profile. The weight of an
+// edge is the largest base of any device plus the sum of all devices'
+// reinforcements minus all their penalties, never below zero, so merging
+// states in any order gives the same graphs. Taking the largest base keeps
+// devices that started from the same graph from counting it twice.
+type State struct {
+	device string
+	vector Vector
+	edges  map[edgeKey]map[string]Counter
+}
+
+func NewState(device string) *State {
+	return &State{
+		device: device,
+		vector: make(Vector),
+		edges:  make(map[edgeKey]map[string]Counter),
+	}
+}
+
+func (s *State) Device() string {
+	return s.device
+}
+
+func (s *State) Vector() Vector {
+	return s.vector.copy()
+}
+
+func (s *State) raw(k edgeKey) float64 {
+	var base, weight float64
+	for _, c := range s.edges[k] {
+		base = max(base, c.Base)
+		weight += c.Reinforce - c.Penalty
+	}
+	return base + weight
+}
+
+// Baseline records a graph as this device's base. It is meant for a state
+// that has just been created, before its first Capture or Merge.
+func (s *State) Baseline(graph string, edges map[int64]map[int64]float64) {
+	seq := s.vector[s.device] + 1
+	for fromID, neighbors := range edges {
+		for toID, weight := range neighbors {
+			if weight <= epsilon {
+				continue
+			}
+			k := edgeKey{graph: graph, from: fromID, to: toID}
+			if s.edges[k] == nil {
+				s.edges[k] = make(map[string]Counter)
+			}
+			s.edges[k][s.device] = Counter{Base: weight, Seq: seq}
+			s.vector[s.device] = seq
+		}
+	}
+}
+
+// Graph materializes the edges of a graph.
+func (s *State) Graph(graph string) map[int64]map[int64]float64 {
+	edges := make(map[int64]map[int64]float64)
+	for k := range s.edges {
+		if k.graph != graph {
+			continue
+		}
+		weight := s.raw(k)
+		if weight <= epsilon {
+			continue
+		}
+		if edges[k.from] == nil {
+			edges[k.from] = make(map[int64]float64)
+		}
+		edges[k.from][k.to] = weight
+	}
+	return edges
+}
+
+// Capture records the difference between a graph as stored locally and its
+// materialized state as this device's reinforcements and penalties. It
+// reports whether anything changed.
+func (s *State) Capture(graph string, edges map[int64]map[int64]float64) bool {
+	seq := s.vector[s.device] + 1
+	changed := false
+
+	record := func(k edgeKey, delta float64) {
+		if delta > -epsilon && delta < epsilon {
+			return
+		}
+		if s.edges[k] == nil {
+			s.edges[k] = make(map[string]Counter)
+		}
+		c := s.edges[k][s.device]
+		if delta > 0 {
+			c.Reinforce += delta
+		} else {
+			c.Penalty -= delta
+		}
+		c.Seq = seq
+		s.edges[k][s.device] = c
+		changed = true
+	}
+
+	for fromID, neighbors := range edges {
+		for toID, weight := range neighbors {
+			k := edgeKey{graph: graph, from: fromID, to: toID}
+			raw := s.raw(k)
+			if weight > epsilon {
+				record(k, weight-raw)
+			} else if raw > 0 {
+				record(k, -raw)
+			}
+		}
+	}
+	for k := range s.edges {
+		if _, ok := edges[k.from][k.to]; k.graph != graph || ok {
+			continue
+		}
+		if raw := s.raw(k); raw > 0 {
+			record(k, -raw)
+		}
+	}
+
+	if changed {
+		s.vector[s.device] = seq
+	}
+	return changed
+}
+
+// Since returns the entries changed after the given vector.
+func (s *State) Since(v Vector) *Delta {
+	d := &Delta{Vector: s.vector.copy(), Entries: []Entry{}}
+	for k, devices := range s.edges {
+		for device, c := range devices {
+			if c.Seq > v[device] {
+				d.Entries = append(d.Entries, Entry{Graph: k.graph, From: k.from, To: k.to, Device: device, Counter: c})
+			}
+		}
+	}
+	sortEntries(d.Entries)
+	return d
+}
+
+// Merge applies a peer's delta and returns the graphs whose edges changed.
+func (s *State) Merge(d *Delta) []string {
+	touched := make(map[string]bool)
+	for _, e := range d.Entries {
+		k := edgeKey{graph: e.Graph, from: e.From, to: e.To}
+		if s.edges[k] == nil {
+			s.edges[k] = make(map[string]Counter)
+		}
+		cur, ok := s.edges[k][e.Device]
+		next := Counter{
+			Base:      max(cur.Base, e.Base),
+			Reinforce: max(cur.Reinforce, e.Reinforce),
+			Penalty:   max(cur.Penalty, e.Penalty),
+			Seq:       max(cur.Seq, e.Seq),
+		}
+		if !ok || next != cur {
+			s.edges[k][e.Device] = next
+			touched[e.Graph] = true
+		}
+	}
+	for device, seq := range d.Vector {
+		s.vector[device] = max(s.vector[device], seq)
+	}
+
+	graphs := make([]string, 0, len(touched))
+	for graph := range touched {
+		graphs = append(graphs, graph)
+	}
+	sort.Strings(graphs)
+	return graphs
+}
+
+type stateJSON struct {
+	Device  string  `json:"device"`
+	Vector  Vector  `json:"vector"`
+	Entries []Entry `json:"entries"`
+}
+
+func (s *State) MarshalJSON() ([]byte, error) {
+	d := s.Since(nil)
+	return json.Marshal(stateJSON{Device: s.device, Vector: s.vector, Entries: d.Entries})
+}
+
+func (s *State) UnmarshalJSON(data []byte) error {
+	var raw stateJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = *NewState(raw.Device)
+	s.Merge(&Delta{Vector: raw.Vector, Entries: raw.Entries})
+	return nil
+}
+
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Graph != b.Graph {
+			return a.Graph < b.Graph
+		}
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Device < b.Device
+	})
+}
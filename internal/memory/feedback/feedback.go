@@ -0,0 +1,188 @@
+package feedback
+
+import (
+	"fmt"
+	"math"
+)
+
+// Signal is explicit feedback on a transition, as opposed to what is read
+// from how long a song was listened to.
+type Signal string
+
+const (
+	SignalLike    Signal = "like"
+	SignalDislike Signal = "dislike"
+	// SignalNever asks for a transition never to be picked again.
+	SignalNever Signal = "never"
+)
+
+func ParseSignal(s string) (Signal, error) {
+	switch sig := Signal(s); sig {
+	case SignalLike, SignalDislike, SignalNever:
+		return sig, nil
+	}
+	return "", fmt.Errorf("unknown feedback signal %q", s)
+}
+
+// Update is what one piece of feedback does to a transition: Reward
+// reinforces it, Penalty weakens it and Cooldown holds it back for a while,
+// see RuntimeGraph. Cooldowns lie between 0 and 1. Clear removes the
+// transition from the graph, as a penalty larger than its weight would be
+// ignored.
+type Update struct {
+	Reward   float64
+	Penalty  float64
+	Cooldown float64
+	Clear    bool
+}
+
+func (u Update) Empty() bool {
+	return u.Reward == 0 && u.Penalty == 0 && u.Cooldown == 0 && !u.Clear
+}
+
+// Policy decides how the graph learns from feedback.
+type Policy interface {
+	// Played is the update for a transition whose song played for progress,
+	// from 0 to 1, of its length.
+	Played(progress float64) Update
+	Signal(s Signal) Update
+}
+
+// Progress returns the share of a song that was listened to, clamped to 0
+// and 1, and false when the song has no length to compare with.
+func Progress(listened, duration float64) (float64, bool) {
+	if !(duration > 0) || math.IsInf(duration, 0) || math.IsNaN(listened) {
+		return 0, false
+	}
+	return min(max(listened/duration, 0), 1), true
+}
+
+// Signals are the updates of the explicit signals.
+type Signals struct {
+	Like    Update
+	Dislike Update
+	Never   Update
+}
+
+func DefaultSignals() Signals {
+	return Signals{
+		Like:    Update{Reward: 3},
+		Dislike: Update{Penalty: 3, Cooldown: 0.5},
+		Never:   Update{Clear: true},
+	}
+}
+
+func (s Signals) update(sig Signal) Update {
+	switch sig {
+	case SignalLike:
+		return s.Like
+	case SignalDislike:
+		return s.Dislike
+	case SignalNever:
+		return s.Never
+	}
+	return Update{}
+}
+
+// Thresholds sorts plays into three kinds by how far they got: played on,
+// skipped early, and skipped right away.
+type Thresholds struct {
+	// A play of at least PlayedAt counts as played on and is rewarded by
+	// Reward.
+	PlayedAt float64
+	Reward   float64
+	// A play of less than SkippedAt counts as skipped right away.
+	SkippedAt    float64
+	SkipPenalty  float64
+	SkipCooldown float64
+	// Plays in between count as skipped early.
+	EarlyPenalty  float64
+	EarlyCooldown float64
+	Signals       Signals
+}
+
+// DefaultPolicy returns the thresholds the player has always learned with.
+func DefaultPolicy() *Thresholds {
+	return &Thresholds{
+		PlayedAt:      0.33,
+		Reward:        1,
+		SkippedAt:     0.1,
+		SkipPenalty:   2,
+		SkipCooldown:  0.2,
+		EarlyPenalty:  1,
+		EarlyCooldown: 0.1,
+		Signals:       DefaultSignals(),
+	}
+}
+
+func (t *Thresholds) Played(progress float64) Update {
+	switch {
+	case progress >= t.PlayedAt:
+		return Update{Reward: t.Reward}
+	case progress < t.SkippedAt:
+		return Update{Penalty: t.SkipPenalty, Cooldown: t.SkipCooldown}
+	default:
+		return Update{Penalty: t.EarlyPenalty, Cooldown: t.EarlyCooldown}
+	}
+}
+
+func (t *Thresholds) Signal(s Signal) Update {
+	return t.Signals.update(s)
+}
+
+// Curve turns progress into feedback continuously instead of in steps. A play
+// that stops at Neutral is neither rewarded nor penalized; the reward grows
+// towards MaxReward for a full play and the penalty and cooldown towards
+// MaxPenalty and MaxCooldown for a song skipped at once. Exponent shapes both
+// halves of the curve: above 1 only plays near the ends count for much.
+type Curve struct {
+	Neutral     float64
+	MaxReward   float64
+	MaxPenalty  float64
+	MaxCooldown float64
+	Exponent    float64
+	Signals     Signals
+}
+
+func CurvePolicy() *Curve {
+	return &Curve{
+		Neutral:     0.33,
+		MaxReward:   1.5,
+		MaxPenalty:  2,
+		MaxCooldown: 0.2,
+		Exponent:    1,
+		Signals:     DefaultSignals(),
+	}
+}
+
+func (c *Curve) Played(progress float64) Update {
+	exp := c.Exponent
+	if exp <= 0 {
+		exp = 1
+	}
+	neutral := min(max(c.Neutral, 0), 1)
+	switch {
+	case progress > neutral:
+		return Update{Reward: c.MaxReward * math.Pow((progress-neutral)/(1-neutral), exp)}
+	case progress < neutral:
+		x := math.Pow((neutral-progress)/neutral, exp)
+		return Update{Penalty: c.MaxPenalty * x, Cooldown: c.MaxCooldown * x}
+	default:
+		return Update{}
+	}
+}
+
+func (c *Curve) Signal(s Signal) Update {
+	return c.Signals.update(s)
+}
+
+// ParsePolicy returns the default policy of a kind: "thresholds" or "curve".
+func ParsePolicy(name string) (Policy, error) {
+	switch name {
+	case "thresholds", "":
+		return DefaultPolicy(), nil
+	case "curve":
+		return CurvePolicy(), nil
+	}
+	return nil, fmt.Errorf("unknown feedback policy %q", name)
+}
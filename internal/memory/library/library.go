@@ -0,0 +1,126 @@
+package library
+
+import (
+	"GO_player/internal/memory/basegraph"
+	"sync"
+)
+
+const minLearnedWeight = 1e-9
+
+// Library is the radio-mode view of the memory: the per-album graphs act as a
+// prior and the transitions learned while playing across the whole catalog
+// are kept on top of them.
+type Library struct {
+	mu          sync.RWMutex
+	albumWeight float64
+	prior       map[int64]map[int64]float64
+}
+
+func NewLibrary(albumWeight float64) *Library {
+	if albumWeight <= 0 {
+		albumWeight = 1.0
+	}
+	return &Library{
+		albumWeight: albumWeight,
+		prior:       make(map[int64]map[int64]float64),
+	}
+}
+
+// SetAlbumGraphs replaces the prior with the sum of the given album graphs,
+// keyed by album ID, scaled by the album weight.
+func (l *Library) SetAlbumGraphs(albums map[int64]map[int64]map[int64]float64) {
+	prior := make(map[int64]map[int64]float64)
+	for _, edges := range albums {
+		for fromID, neighbors := range edges {
+			if prior[fromID] == nil {
+				prior[fromID] = make(map[int64]float64, len(neighbors))
+			}
+			for toID, weight := range neighbors {
+				prior[fromID][toID] += weight * l.albumWeight
+			}
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prior = prior
+}
+
+// Blend returns the base graph used in radio mode: the prior plus the learned
+// library edges, minus the penalties that took edges below their prior. An
+// edge that ends up at 0 or below is left out.
+func (l *Library) Blend(learned, penalties map[int64]map[int64]float64) *basegraph.BaseGraph {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	edges := make(map[int64]map[int64]float64, len(l.prior))
+	for fromID, neighbors := range l.prior {
+		edges[fromID] = make(map[int64]float64, len(neighbors))
+		for toID, weight := range neighbors {
+			edges[fromID][toID] = weight
+		}
+	}
+	for fromID, neighbors := range learned {
+		if edges[fromID] == nil {
+			edges[fromID] = make(map[int64]float64, len(neighbors))
+		}
+		for toID, weight := range neighbors {
+			edges[fromID][toID] += weight
+		}
+	}
+	for fromID, neighbors := range penalties {
+		for toID, penalty := range neighbors {
+			if _, ok := edges[fromID][toID]; !ok {
+				continue
+			}
+			if weight := edges[fromID][toID] - penalty; weight > minLearnedWeight {
+				edges[fromID][toID] = weight
+			} else {
+				delete(edges[fromID], toID)
+			}
+		}
+	}
+
+	bg := basegraph.NewBaseGraph()
+	_ = bg.SetEdges(edges)
+	return bg
+}
+
+// Extract is the inverse of Blend: it returns what bg learned beyond the
+// prior, and how far it pushed edges below it, an edge of the prior missing
+// from bg counting as pushed down to 0. Both are kept apart so that the
+// learned edges remain a graph of positive weights.
+func (l *Library) Extract(bg *basegraph.BaseGraph) (learned, penalties map[int64]map[int64]float64) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	learned = make(map[int64]map[int64]float64)
+	penalties = make(map[int64]map[int64]float64)
+	add := func(m map[int64]map[int64]float64, fromID, toID int64, v float64) {
+		if m[fromID] == nil {
+			m[fromID] = make(map[int64]float64)
+		}
+		m[fromID][toID] = v
+	}
+
+	edges := bg.GetEdges()
+	for fromID, neighbors := range edges {
+		for toID, weight := range neighbors {
+			delta := weight - l.prior[fromID][toID]
+			switch {
+			case delta > minLearnedWeight:
+				add(learned, fromID, toID, delta)
+			case delta < -minLearnedWeight:
+				add(penalties, fromID, toID, -delta)
+			}
+		}
+	}
+	for fromID, neighbors := range l.prior {
+		for toID, weight := range neighbors {
+			if _, ok := edges[fromID][toID]; !ok && weight > minLearnedWeight {
+				add(penalties, fromID, toID, weight)
+			}
+		}
+	}
+	return learned, penalties
+}
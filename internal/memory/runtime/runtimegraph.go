@@ -18,6 +18,9 @@ type RuntimeGraph struct {
 	tau          float64
 	penalties    map[int64]map[int64]float64
 	bonuses      map[int64]map[int64]float64
+	cleared      map[int64]map[int64]bool
+	prior        map[int64]map[int64]float64
+	incoming     map[int64]int
 	buildVersion int64
 	buildReason  string
 	timestamp    time.Time
@@ -31,6 +34,9 @@ func NewRuntimeGraph() *RuntimeGraph {
 		cooldowns: make(map[int64]map[int64]cooldownEntry),
 		penalties: make(map[int64]map[int64]float64),
 		bonuses:   make(map[int64]map[int64]float64),
+		cleared:   make(map[int64]map[int64]bool),
+		prior:     make(map[int64]map[int64]float64),
+		incoming:  make(map[int64]int),
 		tau:       180,
 	}
 }
@@ -81,6 +87,30 @@ func (graph *RuntimeGraph) GetBonuses() map[int64]map[int64]float64 {
 	return copyOuter
 }
 
+func (graph *RuntimeGraph) GetCleared() map[int64]map[int64]bool {
+	graph.mu.RLock()
+	defer graph.mu.RUnlock()
+
+	copyOuter := make(map[int64]map[int64]bool, len(graph.cleared))
+	for fromID, inner := range graph.cleared {
+		copyOuter[fromID] = copyMap(inner)
+	}
+	return copyOuter
+}
+
+// Clear takes the transition from fromID to toID out of the graph. When the
+// graph is folded into the base graph the edge is removed there too.
+func (graph *RuntimeGraph) Clear(fromID, toID int64) {
+	graph.mu.Lock()
+	defer graph.mu.Unlock()
+
+	if graph.cleared[fromID] == nil {
+		graph.cleared[fromID] = make(map[int64]bool)
+	}
+	graph.cleared[fromID][toID] = true
+	graph.diffts++
+}
+
 func (graph *RuntimeGraph) Reinforce(fromID, toID int64, value float64) {
 	graph.mu.Lock()
 	defer graph.mu.Unlock()
@@ -126,6 +156,91 @@ func (graph *RuntimeGraph) Penalty(fromID, toID int64, value float64) {
 	graph.diffts++
 }
 
+// Unreinforce takes back a bonus given by Reinforce.
+func (graph *RuntimeGraph) Unreinforce(fromID, toID int64, value float64) {
+	graph.mu.Lock()
+	defer graph.mu.Unlock()
+	subtract(graph.bonuses, 0, toID, value)
+	subtract(graph.bonuses, fromID, toID, value)
+}
+
+// Unpenalty takes back a penalty given by Penalty.
+func (graph *RuntimeGraph) Unpenalty(fromID, toID int64, value float64) {
+	graph.mu.Lock()
+	defer graph.mu.Unlock()
+	subtract(graph.penalties, fromID, toID, value)
+}
+
+// Unclear puts a transition taken out by Clear back into the graph.
+func (graph *RuntimeGraph) Unclear(fromID, toID int64) {
+	graph.mu.Lock()
+	defer graph.mu.Unlock()
+	delete(graph.cleared[fromID], toID)
+	if len(graph.cleared[fromID]) == 0 {
+		delete(graph.cleared, fromID)
+	}
+}
+
+// Cooldown returns the cooldown on the transition from fromID to toID as it
+// was set, before it decays, and when it was set.
+func (graph *RuntimeGraph) Cooldown(fromID, toID int64) (float64, time.Time, bool) {
+	graph.mu.RLock()
+	defer graph.mu.RUnlock()
+	cd, ok := graph.cooldowns[fromID][toID]
+	return cd.Value, cd.Ts, ok
+}
+
+// RestoreCooldown puts back a cooldown returned by Cooldown; a value of 0
+// removes the cooldown.
+func (graph *RuntimeGraph) RestoreCooldown(fromID, toID int64, value float64, ts time.Time) {
+	graph.mu.Lock()
+	defer graph.mu.Unlock()
+
+	if value <= 0 {
+		delete(graph.cooldowns[fromID], toID)
+		if len(graph.cooldowns[fromID]) == 0 {
+			delete(graph.cooldowns, fromID)
+		}
+		return
+	}
+	if graph.cooldowns[fromID] == nil {
+		graph.cooldowns[fromID] = make(map[int64]cooldownEntry)
+	}
+	graph.cooldowns[fromID][toID] = cooldownEntry{Value: value, Ts: ts}
+}
+
+// SetPrior sets pseudo-edges that connect songs the base graph does not lead
+// to or away from yet. An edge of the prior is only used while its target has
+// no incoming edge or its source no outgoing edge in the base graph, and it
+// only reaches the base graph once the transition is actually played.
+func (graph *RuntimeGraph) SetPrior(prior map[int64]map[int64]float64) {
+	graph.mu.Lock()
+	defer graph.mu.Unlock()
+
+	graph.prior = make(map[int64]map[int64]float64, len(prior))
+	for fromID, neighbors := range prior {
+		graph.prior[fromID] = copyMap(neighbors)
+	}
+}
+
+func (graph *RuntimeGraph) GetPrior() map[int64]map[int64]float64 {
+	graph.mu.RLock()
+	defer graph.mu.RUnlock()
+
+	copyOuter := make(map[int64]map[int64]float64, len(graph.prior))
+	for fromID, inner := range graph.prior {
+		copyOuter[fromID] = copyMap(inner)
+	}
+	return copyOuter
+}
+
+// Incoming returns how many edges of the base graph lead to id.
+func (graph *RuntimeGraph) Incoming(id int64) int {
+	graph.mu.RLock()
+	defer graph.mu.RUnlock()
+	return graph.incoming[id]
+}
+
 func (graph *RuntimeGraph) BuildFromBase(base *basegraph.BaseGraph) {
 	graph.mu.Lock()
 	defer graph.mu.Unlock()
@@ -147,6 +262,7 @@ func (graph *RuntimeGraph) CopyBase(base *basegraph.BaseGraph, buildVersion int6
 
 func (graph *RuntimeGraph) copyBase(base *basegraph.BaseGraph, buildVersion int64, buildReason string) {
 	graph.edges = make(map[int64]map[int64]float64)
+	graph.incoming = make(map[int64]int)
 
 	ids := base.GetAllIDs()
 	for _, fid := range ids {
@@ -161,6 +277,7 @@ func (graph *RuntimeGraph) copyBase(base *basegraph.BaseGraph, buildVersion int6
 
 		for sid, weight := range baseStat {
 			graph.edges[fid][sid] = weight
+			graph.incoming[sid]++
 		}
 	}
 
@@ -178,15 +295,42 @@ func copyMap[K comparable, V any](src map[K]V) map[K]V {
 	return dst
 }
 
+// subtract takes value off m[fromID][toID], dropping entries it empties.
+func subtract(m map[int64]map[int64]float64, fromID, toID int64, value float64) {
+	rest := m[fromID][toID] - value
+	if rest > 1e-9 {
+		m[fromID][toID] = rest
+		return
+	}
+	delete(m[fromID], toID)
+	if len(m[fromID]) == 0 {
+		delete(m, fromID)
+	}
+}
+
+// withPrior returns the edges leaving fromID together with the prior edges
+// that still matter: all of them when fromID leads nowhere, otherwise those
+// into songs that have no incoming edge.
+func (graph *RuntimeGraph) withPrior(fromID int64) map[int64]float64 {
+	edges := copyMap(graph.edges[fromID])
+	deadEnd := len(edges) == 0
+	for toID, weight := range graph.prior[fromID] {
+		if _, ok := edges[toID]; !ok && (deadEnd || graph.incoming[toID] == 0) {
+			edges[toID] = weight
+		}
+	}
+	return edges
+}
+
 func (graph *RuntimeGraph) calculateFines(fromID int64) map[int64]float64 {
-	if graph.edges[fromID] == nil {
+	if graph.edges[fromID] == nil && graph.prior[fromID] == nil {
 		return map[int64]float64{}
 	}
-	if graph.cooldowns[fromID] == nil && graph.penalties[fromID] == nil {
-		return copyMap(graph.edges[fromID])
+	if graph.cooldowns[fromID] == nil && graph.penalties[fromID] == nil && graph.cleared[fromID] == nil {
+		return graph.withPrior(fromID)
 	}
 
-	fined := copyMap(graph.edges[fromID])
+	fined := graph.withPrior(fromID)
 
 	if graph.bonuses[fromID] != nil {
 		for toID := range fined {
@@ -217,6 +361,10 @@ func (graph *RuntimeGraph) calculateFines(fromID int64) map[int64]float64 {
 		}
 	}
 
+	for toID := range graph.cleared[fromID] {
+		delete(fined, toID)
+	}
+
 	return fined
 }
 
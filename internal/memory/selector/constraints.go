@@ -0,0 +1,214 @@
+package selector
+
+import (
+	"sync"
+	"time"
+)
+
+// Constraints keep the selection from repeating itself. A zero field turns
+// its rule off.
+type Constraints struct {
+	// RepeatPlays and RepeatWindow keep a song from playing again within its
+	// last plays, or within a time.
+	RepeatPlays  int
+	RepeatWindow time.Duration
+	// ArtistGap and AlbumGap are how many other songs have to play between
+	// two songs of the same artist or album.
+	ArtistGap int
+	AlbumGap  int
+	// GenreShare is the largest share one genre may take of the last
+	// GenreWindow plays, GenreWindow defaulting to 10.
+	GenreShare  float64
+	GenreWindow int
+}
+
+const defaultGenreWindow = 10
+
+func (c Constraints) Enabled() bool {
+	return c.RepeatPlays > 0 || c.RepeatWindow > 0 || c.ArtistGap > 0 || c.AlbumGap > 0 || c.GenreShare > 0
+}
+
+// SongInfo is what the constraints need to know about a song. Empty artists
+// and genres, and album 0, never count as the same.
+type SongInfo struct {
+	Artist  string
+	AlbumID int64
+	Genre   string
+}
+
+type recentPlay struct {
+	id int64
+	at time.Time
+}
+
+// Filter enforces Constraints on the candidates of a pick, given the songs
+// played before it.
+type Filter struct {
+	mu     sync.Mutex
+	c      Constraints
+	songs  map[int64]SongInfo
+	recent []recentPlay
+	keep   int
+}
+
+// RecentPlays is how many of the last plays the constraints look at, on top
+// of the ones within RepeatWindow.
+func (c Constraints) RecentPlays() int {
+	window := c.GenreWindow
+	if c.GenreShare > 0 && window <= 0 {
+		window = defaultGenreWindow
+	}
+	return max(c.RepeatPlays, c.ArtistGap, c.AlbumGap, window)
+}
+
+func NewFilter(c Constraints) *Filter {
+	keep := c.RecentPlays()
+	if c.GenreShare > 0 && c.GenreWindow <= 0 {
+		c.GenreWindow = defaultGenreWindow
+	}
+	return &Filter{
+		c:     c,
+		songs: make(map[int64]SongInfo),
+		keep:  keep,
+	}
+}
+
+func (f *Filter) SetSongs(songs map[int64]SongInfo) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.songs = songs
+}
+
+// Clone returns a filter with the same constraints, songs and recent plays
+// that goes on separately.
+func (f *Filter) Clone() *Filter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &Filter{
+		c:      f.c,
+		songs:  f.songs,
+		recent: append([]recentPlay(nil), f.recent...),
+		keep:   f.keep,
+	}
+}
+
+// Played records that id started playing at the given time. Plays have to be
+// recorded in order.
+func (f *Filter) Played(id int64, at time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.recent = append(f.recent, recentPlay{id: id, at: at})
+	drop := 0
+	for drop < len(f.recent)-f.keep {
+		if f.c.RepeatWindow > 0 && at.Sub(f.recent[drop].at) < f.c.RepeatWindow {
+			break
+		}
+		drop++
+	}
+	f.recent = f.recent[drop:]
+}
+
+// rule is one of the constraints; it reports whether a candidate breaks it.
+type rule func(id int64, info SongInfo) bool
+
+// rules returns the enabled constraints, the ones given up first when nothing
+// passes them all at the end.
+func (f *Filter) rules(now time.Time) []rule {
+	var rules []rule
+	last := func(n int) []recentPlay {
+		return f.recent[max(0, len(f.recent)-n):]
+	}
+
+	if f.c.RepeatPlays > 0 || f.c.RepeatWindow > 0 {
+		rules = append(rules, func(id int64, _ SongInfo) bool {
+			for i, p := range f.recent {
+				if p.id != id {
+					continue
+				}
+				if len(f.recent)-i <= f.c.RepeatPlays || now.Sub(p.at) < f.c.RepeatWindow {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	if f.c.ArtistGap > 0 {
+		rules = append(rules, func(_ int64, info SongInfo) bool {
+			for _, p := range last(f.c.ArtistGap) {
+				if info.Artist != "" && f.songs[p.id].Artist == info.Artist {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	if f.c.AlbumGap > 0 {
+		rules = append(rules, func(_ int64, info SongInfo) bool {
+			for _, p := range last(f.c.AlbumGap) {
+				if info.AlbumID != 0 && f.songs[p.id].AlbumID == info.AlbumID {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	if f.c.GenreShare > 0 {
+		rules = append(rules, func(_ int64, info SongInfo) bool {
+			if info.Genre == "" {
+				return false
+			}
+			same := 1
+			for _, p := range last(f.c.GenreWindow - 1) {
+				if f.songs[p.id].Genre == info.Genre {
+					same++
+				}
+			}
+			return float64(same) > f.c.GenreShare*float64(f.c.GenreWindow)
+		})
+	}
+	return rules
+}
+
+// Apply returns the candidates of probs that pass the constraints, with their
+// probabilities normalized again. When none pass, the rules are given up one
+// by one, genre first and repeats last, so that a pick is always possible.
+func (f *Filter) Apply(probs map[int64]float64, now time.Time) map[int64]float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rules := f.rules(now)
+	for n := len(rules); n > 0; n-- {
+		kept := make(map[int64]float64, len(probs))
+		var sum float64
+		for id, p := range probs {
+			if !breaks(rules[:n], id, f.songs[id]) {
+				kept[id] = p
+				sum += p
+			}
+		}
+		if sum > 0 {
+			for id := range kept {
+				kept[id] /= sum
+			}
+			return kept
+		}
+	}
+	return probs
+}
+
+// Allowed reports whether id passes every constraint.
+func (f *Filter) Allowed(id int64, now time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !breaks(f.rules(now), id, f.songs[id])
+}
+
+func breaks(rules []rule, id int64, info SongInfo) bool {
+	for _, r := range rules {
+		if r(id, info) {
+			return true
+		}
+	}
+	return false
+}
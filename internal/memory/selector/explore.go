@@ -0,0 +1,192 @@
+package selector
+
+import (
+	"GO_player/internal/memory/runtime"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type ExploreMode string
+
+const (
+	ExploreOff ExploreMode = "off"
+	// ExploreEpsilon leaves the graph with a fixed chance and plays a rarely
+	// played song picked at random.
+	ExploreEpsilon ExploreMode = "epsilon"
+	// ExploreUCB gives every rarely played song an upper confidence bonus
+	// that shrinks with its play count and grows slowly with all plays, and
+	// leaves the graph when the largest bonus beats the most likely edge. Both
+	// modes always explore from a song the graph does not lead away from.
+	ExploreUCB ExploreMode = "ucb"
+)
+
+func ParseExploreMode(s string) (ExploreMode, error) {
+	switch m := ExploreMode(s); m {
+	case ExploreOff, ExploreEpsilon, ExploreUCB:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown exploration mode %q", s)
+}
+
+type ExploreOptions struct {
+	Mode ExploreMode
+	// Epsilon is the chance that a pick explores in epsilon mode.
+	Epsilon float64
+	// UCBScale weighs the UCB bonus against the edge probabilities.
+	UCBScale float64
+	// MaxEdges is how many incoming edges a song may have and still count
+	// as rarely played.
+	MaxEdges int
+	// RewardScale and PenaltyScale multiply the feedback on transitions that
+	// were picked by exploring. A skipped discovery says less about the song
+	// before it than a skipped pick of the graph, so penalties are halved by
+	// default.
+	RewardScale  float64
+	PenaltyScale float64
+}
+
+const (
+	defaultEpsilon      = 0.05
+	defaultUCBScale     = 0.25
+	defaultMaxEdges     = 1
+	defaultPenaltyScale = 0.5
+)
+
+// Explorer occasionally picks songs the graph does not lead to, so that the
+// repertoire does not shrink to what was played before.
+type Explorer struct {
+	mu      sync.Mutex
+	opts    ExploreOptions
+	songs   []int64
+	plays   map[int64]int
+	total   int
+	filter  *Filter
+	ratings *Ratings
+}
+
+func NewExplorer(opts ExploreOptions) *Explorer {
+	if opts.Mode == "" {
+		opts.Mode = ExploreOff
+	}
+	if opts.Epsilon <= 0 || opts.Epsilon >= 1 {
+		opts.Epsilon = defaultEpsilon
+	}
+	if opts.UCBScale <= 0 {
+		opts.UCBScale = defaultUCBScale
+	}
+	if opts.MaxEdges <= 0 {
+		opts.MaxEdges = defaultMaxEdges
+	}
+	if opts.RewardScale <= 0 {
+		opts.RewardScale = 1
+	}
+	if opts.PenaltyScale <= 0 {
+		opts.PenaltyScale = defaultPenaltyScale
+	}
+	return &Explorer{opts: opts, plays: make(map[int64]int)}
+}
+
+func (e *Explorer) Options() ExploreOptions {
+	return e.opts
+}
+
+// SetSongs sets the songs exploration may pick from.
+func (e *Explorer) SetSongs(ids []int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.songs = append([]int64(nil), ids...)
+}
+
+// SetPlayCounts replaces how often each song was played, typically counted
+// from the listening history.
+func (e *Explorer) SetPlayCounts(counts map[int64]int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.plays = make(map[int64]int, len(counts))
+	e.total = 0
+	for id, n := range counts {
+		e.plays[id] = n
+		e.total += n
+	}
+}
+
+// SetFilter keeps exploration from picking songs that f rules out.
+func (e *Explorer) SetFilter(f *Filter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.filter = f
+}
+
+// SetRatings keeps exploration from picking banned songs.
+func (e *Explorer) SetRatings(r *Ratings) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ratings = r
+}
+
+// Played counts a play of id.
+func (e *Explorer) Played(id int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.plays[id]++
+	e.total++
+}
+
+// Next returns a song to explore after fromID, or false when the pick should
+// be left to the selector.
+func (e *Explorer) Next(fromID int64, runtimeGraph *runtime.RuntimeGraph) (toID int64, ok bool) {
+	if e.opts.Mode == ExploreOff {
+		return 0, false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	var rare []int64
+	for _, id := range e.songs {
+		if id == fromID || (e.filter != nil && !e.filter.Allowed(id, now)) {
+			continue
+		}
+		if e.ratings != nil && e.ratings.Banned(id) {
+			continue
+		}
+		if runtimeGraph.Incoming(id) <= e.opts.MaxEdges {
+			rare = append(rare, id)
+		}
+	}
+	if len(rare) == 0 {
+		return 0, false
+	}
+
+	var top float64
+	for _, p := range runtimeGraph.GetEdges(fromID) {
+		top = max(top, p)
+	}
+
+	if e.opts.Mode == ExploreEpsilon {
+		if top > 0 && rand.Float64() >= e.opts.Epsilon {
+			return 0, false
+		}
+		return rare[rand.Intn(len(rare))], true
+	}
+
+	var best []int64
+	bestBonus := -1.0
+	logTotal := math.Log(float64(e.total + 1))
+	for _, id := range rare {
+		bonus := e.opts.UCBScale * math.Sqrt(logTotal/float64(e.plays[id]+1))
+		switch {
+		case bonus > bestBonus:
+			best, bestBonus = []int64{id}, bonus
+		case bonus == bestBonus:
+			best = append(best, id)
+		}
+	}
+	if top > 0 && bestBonus <= top {
+		return 0, false
+	}
+	return best[rand.Intn(len(best))], true
+}
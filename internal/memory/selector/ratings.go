@@ -0,0 +1,91 @@
+package selector
+
+import "sync"
+
+const defaultPinBoost = 2.0
+
+// Ratings holds the songs the user banned or pinned. Banned songs are never
+// picked, whatever else gives way; the probability of pinned songs is
+// multiplied by the pin boost before the selector picks.
+type Ratings struct {
+	mu       sync.RWMutex
+	banned   map[int64]bool
+	pinned   map[int64]bool
+	pinBoost float64
+}
+
+// NewRatings returns ratings with the given pin boost, 2 when it is not
+// above 1.
+func NewRatings(pinBoost float64) *Ratings {
+	if pinBoost <= 1 {
+		pinBoost = defaultPinBoost
+	}
+	return &Ratings{banned: make(map[int64]bool), pinned: make(map[int64]bool), pinBoost: pinBoost}
+}
+
+// Ban bans id, or lifts the ban. A banned song is no longer pinned.
+func (r *Ratings) Ban(id int64, banned bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if banned {
+		r.banned[id] = true
+		delete(r.pinned, id)
+	} else {
+		delete(r.banned, id)
+	}
+}
+
+// Pin pins id, or unpins it. A pinned song is no longer banned.
+func (r *Ratings) Pin(id int64, pinned bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if pinned {
+		r.pinned[id] = true
+		delete(r.banned, id)
+	} else {
+		delete(r.pinned, id)
+	}
+}
+
+func (r *Ratings) Banned(id int64) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.banned[id]
+}
+
+func (r *Ratings) Pinned(id int64) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pinned[id]
+}
+
+// Apply drops the banned candidates of probs, boosts the pinned ones and
+// normalizes the probabilities again. Nothing is left when every candidate
+// is banned.
+func (r *Ratings) Apply(probs map[int64]float64) map[int64]float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.banned) == 0 && len(r.pinned) == 0 {
+		return probs
+	}
+
+	kept := make(map[int64]float64, len(probs))
+	var sum float64
+	for id, p := range probs {
+		if r.banned[id] {
+			continue
+		}
+		if r.pinned[id] {
+			p *= r.pinBoost
+		}
+		kept[id] = p
+		sum += p
+	}
+	if sum == 0 {
+		return map[int64]float64{}
+	}
+	for id := range kept {
+		kept[id] /= sum
+	}
+	return kept
+}
@@ -5,12 +5,15 @@ import (
 	"math"
 	"math/rand"
 	"sort"
+	"time"
 )
 
 type Selector struct {
 	giniHigh float64
 	giniLow  float64
 	topK     int64
+	filter   *Filter
+	ratings  *Ratings
 }
 
 func NewSelector() *Selector {
@@ -43,6 +46,26 @@ func NewSelectorWithParameters(giniHigh, giniLow float64, topK int64) *Selector
 	}
 }
 
+// SetFilter makes Next choose only among the candidates that pass f; nil
+// removes the filter.
+func (s *Selector) SetFilter(f *Filter) {
+	s.filter = f
+}
+
+func (s *Selector) Filter() *Filter {
+	return s.filter
+}
+
+// SetRatings makes Next skip banned songs and favour pinned ones; nil
+// removes the ratings.
+func (s *Selector) SetRatings(r *Ratings) {
+	s.ratings = r
+}
+
+func (s *Selector) Ratings() *Ratings {
+	return s.ratings
+}
+
 func computeTopK(N int, ratio float64) int {
 	KMin := max(3, int(math.Ceil(float64(N)*0.05)))
 	KMax := max(KMin+1, int(math.Ceil(float64(N)*0.3)))
@@ -72,6 +95,14 @@ func (s *Selector) Next(fromID int64, runtimeGraph *runtime.RuntimeGraph) (toID
 	if len(probs) == 0 {
 		return 0, false
 	}
+	if s.ratings != nil {
+		if probs = s.ratings.Apply(probs); len(probs) == 0 {
+			return 0, false
+		}
+	}
+	if s.filter != nil {
+		probs = s.filter.Apply(probs, time.Now())
+	}
 	gini := computeGini(probs)
 
 	ratio := (gini - s.giniLow) / (s.giniHigh - s.giniLow)
@@ -0,0 +1,162 @@
+package memsync
+
+import (
+	"GO_player/internal/memory/crdt"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Replica is one side of a sync. Pull returns the changes made after the
+// given vector, including local learning not yet recorded; Push merges a
+// peer's changes.
+type Replica interface {
+	Vector() (crdt.Vector, error)
+	Pull(since crdt.Vector) (*crdt.Delta, error)
+	Push(delta *crdt.Delta) error
+}
+
+type Result struct {
+	Received int `json:"received"`
+	Sent     int `json:"sent"`
+}
+
+// Sync exchanges the changes each side has not seen yet: local first takes
+// what remote learned, then sends back what remote is missing, which now also
+// covers what local learned in the meantime.
+func Sync(local, remote Replica) (*Result, error) {
+	since, err := local.Vector()
+	if err != nil {
+		return nil, err
+	}
+	in, err := remote.Pull(since)
+	if err != nil {
+		return nil, err
+	}
+	if err := local.Push(in); err != nil {
+		return nil, err
+	}
+
+	out, err := local.Pull(in.Vector)
+	if err != nil {
+		return nil, err
+	}
+	if err := remote.Push(out); err != nil {
+		return nil, err
+	}
+	return &Result{Received: len(in.Entries), Sent: len(out.Entries)}, nil
+}
+
+// NewHandler serves a replica under /sync/vector, /sync/pull and /sync/push.
+func NewHandler(r Replica) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sync/vector", func(w http.ResponseWriter, req *http.Request) {
+		v, err := r.Vector()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, v)
+	})
+	mux.HandleFunc("POST /sync/pull", func(w http.ResponseWriter, req *http.Request) {
+		var since crdt.Vector
+		if err := json.NewDecoder(req.Body).Decode(&since); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		d, err := r.Pull(since)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, d)
+	})
+	mux.HandleFunc("POST /sync/push", func(w http.ResponseWriter, req *http.Request) {
+		var d crdt.Delta
+		if err := json.NewDecoder(req.Body).Decode(&d); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := r.Push(&d); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// Client is a Replica served by NewHandler on another machine.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), http: httpClient}
+}
+
+func (c *Client) Vector() (crdt.Vector, error) {
+	var v crdt.Vector
+	if err := c.do(http.MethodGet, "/sync/vector", nil, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (c *Client) Pull(since crdt.Vector) (*crdt.Delta, error) {
+	var d crdt.Delta
+	if err := c.do(http.MethodPost, "/sync/pull", since, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (c *Client) Push(delta *crdt.Delta) error {
+	return c.do(http.MethodPost, "/sync/push", delta, nil)
+}
+
+func (c *Client) do(method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -2,10 +2,15 @@ package models
 
 import "GO_player/internal/memory/basegraph"
 
+// Album describes an album of the catalog. Crossfade is how many seconds its
+// songs overlap when played one after another, 0 for gapless joins, and nil
+// to use the player's default. Loudness combines the measured songs.
 type Album struct {
 	ID        int64                `json:"id"`
 	Title     string               `json:"title"`
 	Songs     int64                `json:"id_songs"`
+	Crossfade *float64             `json:"crossfade,omitempty"`
+	Loudness  *Loudness            `json:"loudness,omitempty"`
 	BaseGraph *basegraph.BaseGraph `json:"-"`
 }
 
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Features describe how a song sounds. Tempo is in beats per minute, Loudness
+// in LUFS and Centroid, the spectral centre of mass, in Hz. Key is the pitch
+// class of the tonic, 0 being C. Size and ModTime identify the file that was
+// analyzed.
+type Features struct {
+	Tempo    float64   `json:"tempo"`
+	Loudness float64   `json:"loudness"`
+	Centroid float64   `json:"centroid"`
+	Key      int       `json:"key"`
+	Minor    bool      `json:"minor"`
+	Size     int64     `json:"size,omitempty"`
+	ModTime  time.Time `json:"mod_time,omitzero"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Loudness is an EBU R128 measurement. Integrated is in LUFS, Peak is the
+// largest absolute sample value and Duration is in seconds. For a song, Size
+// and ModTime identify the file that was measured.
+type Loudness struct {
+	Integrated float64   `json:"integrated"`
+	Peak       float64   `json:"peak"`
+	Duration   float64   `json:"duration"`
+	Size       int64     `json:"size,omitempty"`
+	ModTime    time.Time `json:"mod_time,omitzero"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+type PlayOutcome string
+
+const (
+	OutcomeCompleted PlayOutcome = "completed"
+	OutcomeSkipped   PlayOutcome = "skipped"
+	OutcomeBack      PlayOutcome = "back"
+)
+
+// PlayEvent is one entry of the listening history. Listened and Duration are
+// in seconds; AlbumID is 0 for songs played in radio mode. Explored marks songs
+// the player picked to explore rather than by following the graph.
+type PlayEvent struct {
+	SongID     int64       `json:"song_id"`
+	PreviousID int64       `json:"previous_id"`
+	AlbumID    int64       `json:"album_id"`
+	StartedAt  time.Time   `json:"started_at"`
+	Listened   float64     `json:"listened"`
+	Duration   float64     `json:"duration"`
+	Outcome    PlayOutcome `json:"outcome"`
+	Explored   bool        `json:"explored,omitempty"`
+}
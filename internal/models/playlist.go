@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Playlist is an ordered list of songs. A song may appear more than once.
+type Playlist struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	SongIDs   []int64   `json:"song_ids"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+}
@@ -0,0 +1,8 @@
+package models
+
+import "time"
+
+type Profile struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Rating is what the user said about a song. A banned song is never picked
+// by the player on its own, and a pinned one is always welcome.
+type Rating struct {
+	SongID    int64     `json:"song_id"`
+	Banned    bool      `json:"banned,omitempty"`
+	Pinned    bool      `json:"pinned,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -1,7 +1,16 @@
 package models
 
+// Song describes a track of the catalog. Duration is in seconds and 0 when it
+// is not known; Loudness and Features are nil until the file has been
+// analyzed.
 type Song struct {
-	ID    int64  `json:"id"`
-	Title string `json:"title"`
-	Path  string `json:"path"`
+	ID       int64     `json:"id"`
+	Title    string    `json:"title"`
+	Path     string    `json:"path"`
+	Artist   string    `json:"artist"`
+	Genre    string    `json:"genre,omitempty"`
+	AlbumID  int64     `json:"album_id"`
+	Duration float64   `json:"duration"`
+	Loudness *Loudness `json:"loudness,omitempty"`
+	Features *Features `json:"features,omitempty"`
 }
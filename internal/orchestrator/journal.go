@@ -0,0 +1,201 @@
+package orchestrator
+
+import (
+	"GO_player/internal/memory/feedback"
+	"GO_player/internal/memory/runtime"
+	"errors"
+	"time"
+)
+
+// maxJournal bounds how much recent feedback can still be undone.
+const maxJournal = 32
+
+var (
+	ErrFeedbackNotFound = errors.New("feedback is no longer in the journal")
+	ErrFeedbackDropped  = errors.New("feedback was dropped with its runtime graph")
+)
+
+// Feedback is what one play or signal taught the graph. ID is the handle
+// Undo takes.
+type Feedback struct {
+	ID     uint64
+	FromID int64
+	ToID   int64
+	Update feedback.Update
+	At     time.Time
+	// Folded is set once a rebuild moved the update into the base graph.
+	Folded bool
+}
+
+type transition struct {
+	fromID, toID int64
+}
+
+// journalEntry is a Feedback together with what is needed to take it back:
+// the runtime graph it went into, the cooldown it replaced and, once folded,
+// what the fold did to the base graph.
+type journalEntry struct {
+	Feedback
+	rg *runtime.RuntimeGraph
+
+	cooldownTs   time.Time
+	prevCooldown float64
+	prevTs       time.Time
+
+	penalized bool
+	removed   float64
+}
+
+// record applies u to rg and keeps it in the journal.
+func (o *Orchestrator) record(rg *runtime.RuntimeGraph, fromID, toID int64, u feedback.Update) (Feedback, bool) {
+	if u.Empty() {
+		return Feedback{}, false
+	}
+	o.feedbackSeq++
+	e := &journalEntry{
+		Feedback: Feedback{ID: o.feedbackSeq, FromID: fromID, ToID: toID, Update: u, At: time.Now()},
+		rg:       rg,
+	}
+	if u.Cooldown > 0 {
+		e.prevCooldown, e.prevTs, _ = rg.Cooldown(fromID, toID)
+	}
+	o.apply(rg, fromID, toID, u)
+	if u.Cooldown > 0 {
+		_, e.cooldownTs, _ = rg.Cooldown(fromID, toID)
+	}
+
+	if len(o.journal) == maxJournal {
+		o.journal = o.journal[1:]
+	}
+	o.journal = append(o.journal, e)
+	return e.Feedback, true
+}
+
+// markFolded notes which journal entries a fold of rg moved into the base
+// graph, and what the fold did there.
+func (o *Orchestrator) markFolded(rg *runtime.RuntimeGraph, penalized map[transition]bool, removed map[transition]float64) {
+	cleared := make(map[transition]bool)
+	for i := len(o.journal) - 1; i >= 0; i-- {
+		e := o.journal[i]
+		if e.rg != rg || e.Folded {
+			continue
+		}
+		t := transition{e.FromID, e.ToID}
+		e.Folded = true
+		e.penalized = e.Update.Penalty > 0 && penalized[t]
+		// Only the latest clear of a transition gives its weight back.
+		if e.Update.Clear && !cleared[t] {
+			e.removed = removed[t]
+			cleared[t] = true
+		}
+	}
+}
+
+// Journal returns the feedback that can still be undone, oldest first.
+func (o *Orchestrator) Journal() []Feedback {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	out := make([]Feedback, len(o.journal))
+	for i, e := range o.journal {
+		out[i] = e.Feedback
+	}
+	return out
+}
+
+// LastFeedback returns the most recent feedback that can still be undone.
+func (o *Orchestrator) LastFeedback() (Feedback, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if len(o.journal) == 0 {
+		return Feedback{}, false
+	}
+	return o.journal[len(o.journal)-1].Feedback, true
+}
+
+// Undo takes back the feedback with the given ID. While it is still pending in
+// the runtime graph its bonus, penalty and cooldown are reversed there; once a
+// rebuild folded it, the base graph is corrected instead and the runtime graph
+// rebuilt, and the returned Feedback has Folded set so that the caller can
+// persist the graph.
+func (o *Orchestrator) Undo(id uint64) (Feedback, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.state == stateShutDown {
+		return Feedback{}, ErrFeedbackNotFound
+	}
+
+	i := -1
+	for j, e := range o.journal {
+		if e.ID == id {
+			i = j
+			break
+		}
+	}
+	if i < 0 {
+		return Feedback{}, ErrFeedbackNotFound
+	}
+	e := o.journal[i]
+	o.journal = append(o.journal[:i], o.journal[i+1:]...)
+
+	current := o.runtimeGraph.Load()
+	switch {
+	case e.Folded:
+		o.undoFolded(e, current)
+	case e.rg == current:
+		o.undoRuntime(e)
+	default:
+		return e.Feedback, ErrFeedbackDropped
+	}
+	o.prepared = nil
+	return e.Feedback, nil
+}
+
+func (o *Orchestrator) undoRuntime(e *journalEntry) {
+	u, rg := e.Update, e.rg
+	if u.Clear && !o.clearedElsewhere(e) {
+		rg.Unclear(e.FromID, e.ToID)
+	}
+	if u.Reward > 0 {
+		rg.Unreinforce(e.FromID, e.ToID, u.Reward)
+	}
+	if u.Penalty > 0 {
+		rg.Unpenalty(e.FromID, e.ToID, u.Penalty)
+	}
+	// A later cooldown on the same transition replaced this one; keep it.
+	if _, ts, ok := rg.Cooldown(e.FromID, e.ToID); u.Cooldown > 0 && ok && ts.Equal(e.cooldownTs) {
+		rg.RestoreCooldown(e.FromID, e.ToID, e.prevCooldown, e.prevTs)
+	}
+}
+
+// undoFolded corrects the base graph for feedback a rebuild already folded
+// into it. Its cooldown went away with the old runtime graph.
+func (o *Orchestrator) undoFolded(e *journalEntry, current *runtime.RuntimeGraph) {
+	if current != nil {
+		o.foldRuntime(current)
+	}
+	if e.removed > 0 {
+		o.baseGraph.Adjust(e.FromID, e.ToID, e.removed)
+	}
+	if e.Update.Reward > 0 {
+		// The fold reinforced the transition and, through the runtime
+		// bonus on the edge from 0, that edge as well.
+		o.baseGraph.Adjust(e.FromID, e.ToID, -e.Update.Reward)
+		o.baseGraph.Adjust(0, e.ToID, -e.Update.Reward)
+	}
+	if e.penalized {
+		o.baseGraph.Adjust(e.FromID, e.ToID, e.Update.Penalty)
+	}
+	o.runtimeGraph.Store(o.newRuntimeGraph(o.baseGraph, "feedback undone"))
+}
+
+// clearedElsewhere reports whether another pending entry also cleared the
+// transition e cleared, in which case it stays cleared.
+func (o *Orchestrator) clearedElsewhere(e *journalEntry) bool {
+	for _, other := range o.journal {
+		if other != e && other.rg == e.rg && !other.Folded && other.Update.Clear &&
+			other.FromID == e.FromID && other.ToID == e.ToID {
+			return true
+		}
+	}
+	return false
+}
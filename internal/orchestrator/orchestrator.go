@@ -2,6 +2,7 @@ package orchestrator
 
 import (
 	"GO_player/internal/memory/basegraph"
+	"GO_player/internal/memory/feedback"
 	"GO_player/internal/memory/runtime"
 	"GO_player/internal/memory/selector"
 	"GO_player/internal/playback"
@@ -23,6 +24,17 @@ const (
 	stateShutDown
 )
 
+// preparedPick is a selection made by PrepareNext while fromID was playing.
+type preparedPick struct {
+	fromID   int64
+	toID     int64
+	explored bool
+}
+
+// maxExplored bounds how many exploration picks are remembered while their
+// feedback is pending.
+const maxExplored = 8
+
 type Orchestrator struct {
 	baseGraph           *basegraph.BaseGraph
 	rebuildChan         chan bool
@@ -32,7 +44,15 @@ type Orchestrator struct {
 	maxRuntimeGraphDiff float64
 	diffChan            chan struct{}
 	selector            *selector.Selector
+	explorer            *selector.Explorer
+	policy              feedback.Policy
+	explored            []preparedPick
+	journal             []*journalEntry
+	feedbackSeq         uint64
+	currentExplored     bool
 	playbackChain       *playback.PlaybackChain
+	prepared            *preparedPick
+	prior               map[int64]map[int64]float64
 	wg                  *sync.WaitGroup
 	mu                  sync.RWMutex
 	state               runState
@@ -54,6 +74,9 @@ func NewOrchestrator(bg *basegraph.BaseGraph, rg *runtime.RuntimeGraph, s *selec
 	if s == nil {
 		s = selector.NewSelector()
 	}
+	if s.Ratings() == nil {
+		s.SetRatings(selector.NewRatings(0))
+	}
 	if pb == nil {
 		pb = &playback.PlaybackChain{}
 	}
@@ -65,6 +88,7 @@ func NewOrchestrator(bg *basegraph.BaseGraph, rg *runtime.RuntimeGraph, s *selec
 		maxRuntimeGraphDiff: 50.0,
 		diffChan:            make(chan struct{}, 5),
 		selector:            s,
+		policy:              feedback.DefaultPolicy(),
 		playbackChain:       pb,
 		wg:                  wg,
 		mu:                  sync.RWMutex{},
@@ -96,6 +120,18 @@ func (o *Orchestrator) GetPlayBackChain() *playback.PlaybackChain {
 	return o.playbackChain
 }
 
+func (o *Orchestrator) GetRuntimeGraph() *runtime.RuntimeGraph {
+	return o.runtimeGraph.Load()
+}
+
+// Filter returns the constraints the selector enforces, nil when there are
+// none.
+func (o *Orchestrator) Filter() *selector.Filter {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.selector.Filter()
+}
+
 func (o *Orchestrator) GetBGRebuildChan() <-chan bool {
 	o.mu.RLock()
 	defer o.mu.RUnlock()
@@ -114,6 +150,22 @@ func (o *Orchestrator) rebuildRuntime(rebuildReason string) {
 		return
 	}
 
+	if o.foldRuntime(current) {
+		addChainSignal(o, o.rebuildChan, true)
+	}
+
+	o.stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	o.lifecycle.Store(&lifecycle{ctx: ctx, cancel: cancel})
+
+	newRG := o.newRuntimeGraph(o.baseGraph, rebuildReason)
+	o.runtimeGraph.Store(newRG)
+
+	o.start()
+}
+
+func (o *Orchestrator) foldRuntime(current *runtime.RuntimeGraph) bool {
 	runtimeBonuses := current.GetBonuses()
 	for fromID := range runtimeBonuses {
 		for toID := range runtimeBonuses[fromID] {
@@ -121,26 +173,275 @@ func (o *Orchestrator) rebuildRuntime(rebuildReason string) {
 		}
 	}
 
+	penalized := make(map[transition]bool)
 	runtimePenalty := current.GetPenalty()
 	for fromID := range runtimePenalty {
 		for toID := range runtimePenalty[fromID] {
-			o.baseGraph.Penalty(fromID, toID, runtimePenalty[fromID][toID])
+			if o.baseGraph.Penalty(fromID, toID, runtimePenalty[fromID][toID]) {
+				penalized[transition{fromID, toID}] = true
+			}
 		}
 	}
-	if runtimePenalty != nil || runtimeBonuses != nil {
-		addChainSignal(o, o.rebuildChan, true)
+
+	removed := make(map[transition]float64)
+	runtimeCleared := current.GetCleared()
+	for fromID := range runtimeCleared {
+		for toID := range runtimeCleared[fromID] {
+			removed[transition{fromID, toID}] = o.baseGraph.Remove(fromID, toID)
+		}
 	}
+	o.markFolded(current, penalized, removed)
+	return runtimePenalty != nil || runtimeBonuses != nil || runtimeCleared != nil
+}
 
-	o.stop()
+// FlushLearning folds the pending runtime learning into the base graph right
+// away and starts a fresh runtime graph from it. Unlike a scheduled rebuild it
+// does not signal the rebuild channel; the caller persists the graph itself.
+func (o *Orchestrator) FlushLearning() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.state == stateShutDown {
+		return
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	o.lifecycle.Store(&lifecycle{ctx: ctx, cancel: cancel})
+	current := o.runtimeGraph.Load()
+	if current == nil {
+		return
+	}
+	o.foldRuntime(current)
 
-	newRG := runtime.NewRuntimeGraph()
-	newRG.RebuildFromBase(o.baseGraph, rebuildReason)
+	newRG := o.newRuntimeGraph(o.baseGraph, "learning flushed")
 	o.runtimeGraph.Store(newRG)
+}
 
-	o.start()
+// RebaseGraph folds the pending runtime learning into the base graph and then
+// replaces the base graph with the one returned by fn, all under one lock so
+// that no feedback is lost in between.
+func (o *Orchestrator) RebaseGraph(fn func(current *basegraph.BaseGraph) *basegraph.BaseGraph) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.state == stateShutDown {
+		return
+	}
+
+	if current := o.runtimeGraph.Load(); current != nil {
+		o.foldRuntime(current)
+	}
+	bg := fn(o.baseGraph)
+	if bg == nil {
+		bg = o.baseGraph
+	}
+
+	o.baseGraph = bg
+	newRG := o.newRuntimeGraph(bg, "base graph rebased")
+	o.runtimeGraph.Store(newRG)
+}
+
+// ReplaceBaseGraph swaps in a new base graph and rebuilds the runtime graph
+// from it. Runtime learning that was not flushed before is dropped.
+func (o *Orchestrator) ReplaceBaseGraph(bg *basegraph.BaseGraph) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.state == stateShutDown || bg == nil {
+		return
+	}
+
+	o.baseGraph = bg
+	o.prepared = nil
+	newRG := o.newRuntimeGraph(bg, "base graph replaced")
+	o.runtimeGraph.Store(newRG)
+}
+
+// SetPrior sets the pseudo-edges every runtime graph starts with, see
+// RuntimeGraph.SetPrior. They are not part of the base graph and are never
+// persisted.
+func (o *Orchestrator) SetPrior(prior map[int64]map[int64]float64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.state == stateShutDown {
+		return
+	}
+
+	o.prior = prior
+	o.prepared = nil
+	if current := o.runtimeGraph.Load(); current != nil {
+		current.SetPrior(prior)
+	}
+}
+
+// SetExplorer makes the orchestrator explore with e before asking the
+// selector; nil turns exploration off.
+func (o *Orchestrator) SetExplorer(e *selector.Explorer) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if e != nil {
+		e.SetRatings(o.selector.Ratings())
+	}
+	o.explorer = e
+	o.prepared = nil
+}
+
+// SetRatings replaces the banned and pinned songs.
+func (o *Orchestrator) SetRatings(r *selector.Ratings) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if r == nil {
+		r = selector.NewRatings(0)
+	}
+	o.selector.SetRatings(r)
+	if o.explorer != nil {
+		o.explorer.SetRatings(r)
+	}
+	o.prepared = nil
+}
+
+func (o *Orchestrator) Ratings() *selector.Ratings {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.selector.Ratings()
+}
+
+// Ban keeps id from being picked, or lifts the ban. Songs the user queues
+// still play.
+func (o *Orchestrator) Ban(id int64, banned bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.selector.Ratings().Ban(id, banned)
+	if banned && o.prepared != nil && o.prepared.toID == id {
+		o.prepared = nil
+	}
+}
+
+// Pin makes id more likely to be picked and keeps skips from counting
+// against it, or unpins it.
+func (o *Orchestrator) Pin(id int64, pinned bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.selector.Ratings().Pin(id, pinned)
+}
+
+// Rate applies a thumbs up or down on the transition from fromID to toID to
+// the base graph right away, with the update the feedback policy gives a like
+// or a dislike, rather than waiting for the next rebuild. Pending runtime
+// learning is folded in first; the caller persists the graph.
+func (o *Orchestrator) Rate(fromID, toID int64, up bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.state == stateShutDown {
+		return
+	}
+
+	u := o.policy.Signal(feedback.SignalDislike)
+	if up {
+		u = o.policy.Signal(feedback.SignalLike)
+	}
+	if current := o.runtimeGraph.Load(); current != nil {
+		o.foldRuntime(current)
+	}
+	if u.Clear {
+		o.baseGraph.Remove(fromID, toID)
+	}
+	o.baseGraph.Reinforce(fromID, toID, u.Reward)
+	o.baseGraph.Penalty(fromID, toID, u.Penalty)
+
+	o.prepared = nil
+	rg := o.newRuntimeGraph(o.baseGraph, "transition rated")
+	if u.Cooldown > 0 {
+		rg.AddCooldown(fromID, toID, u.Cooldown)
+	}
+	o.runtimeGraph.Store(rg)
+}
+
+// SetFeedbackPolicy sets how the graph learns from feedback; nil restores the
+// default policy.
+func (o *Orchestrator) SetFeedbackPolicy(p feedback.Policy) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if p == nil {
+		p = feedback.DefaultPolicy()
+	}
+	o.policy = p
+}
+
+func (o *Orchestrator) FeedbackPolicy() feedback.Policy {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.policy
+}
+
+// Explored reports whether the transition from fromID to toID was picked by
+// exploring and still waits for its feedback.
+func (o *Orchestrator) Explored(fromID, toID int64) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	for _, p := range o.explored {
+		if p.fromID == fromID && p.toID == toID {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentTransition returns the song playing now and the one played before
+// it, 0 for either when there is none.
+func (o *Orchestrator) CurrentTransition() (fromID, toID int64) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	pc := o.playbackChain
+	if n := len(pc.BackStack); n > 0 {
+		fromID = pc.BackStack[n-1]
+	}
+	return fromID, pc.Current
+}
+
+// CurrentExplored reports whether the song the last PlayNext moved to was
+// picked by exploring.
+func (o *Orchestrator) CurrentExplored() bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.currentExplored
+}
+
+// takeExplored forgets the exploration tag of a transition and reports
+// whether it had one.
+func (o *Orchestrator) takeExplored(fromID, toID int64) bool {
+	for i, p := range o.explored {
+		if p.fromID == fromID && p.toID == toID {
+			o.explored = append(o.explored[:i], o.explored[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// pick chooses the song after fromID, exploring first when an explorer is set.
+func (o *Orchestrator) pick(fromID int64, rg *runtime.RuntimeGraph) (preparedPick, bool) {
+	if o.explorer != nil {
+		if toID, ok := o.explorer.Next(fromID, rg); ok {
+			return preparedPick{fromID: fromID, toID: toID, explored: true}, true
+		}
+	}
+	toID, ok := o.selector.Next(fromID, rg)
+	return preparedPick{fromID: fromID, toID: toID}, ok
+}
+
+// played moves the playback chain to a picked song.
+func (o *Orchestrator) played(p preparedPick) {
+	o.playbackChain.Next(p.toID)
+	o.currentExplored = p.explored
+	if p.explored {
+		if len(o.explored) == maxExplored {
+			o.explored = o.explored[1:]
+		}
+		o.explored = append(o.explored, p)
+	}
+}
+
+func (o *Orchestrator) newRuntimeGraph(bg *basegraph.BaseGraph, reason string) *runtime.RuntimeGraph {
+	rg := runtime.NewRuntimeGraph()
+	rg.RebuildFromBase(bg, reason)
+	rg.SetPrior(o.prior)
+	return rg
 }
 
 func (o *Orchestrator) start() {
@@ -241,30 +542,69 @@ func addChainSignal[T any](o *Orchestrator, ch chan T, v T) {
 	}
 }
 
-func (o *Orchestrator) ProcessFeedback(fromID, toID int64, listened, duration float64) {
+// ProcessFeedback learns from how long toID was listened to after fromID and
+// returns what was learned, which Undo can take back. Plays of a song without
+// a known duration teach nothing.
+func (o *Orchestrator) ProcessFeedback(fromID, toID int64, listened, duration float64) (Feedback, bool) {
 	o.mu.Lock()
 	defer o.mu.Unlock()
 	if o.state == stateShutDown {
-		return
+		return Feedback{}, false
 	}
+	explored := o.takeExplored(fromID, toID)
 	if o.playbackChain.LearningFrozen {
-		return
+		return Feedback{}, false
+	}
+	progress, ok := feedback.Progress(listened, duration)
+	if !ok {
+		return Feedback{}, false
 	}
 
 	rg := o.runtimeGraph.Load()
 	if rg == nil {
-		return
+		return Feedback{}, false
 	}
 
-	progress := listened / duration
-	if progress >= 0.33 {
-		rg.Reinforce(fromID, toID, 1)
-	} else if progress < 0.1 {
-		rg.Penalty(fromID, toID, 2)
-		rg.AddCooldown(fromID, toID, 0.2)
-	} else {
-		rg.Penalty(fromID, toID, 1)
-		rg.AddCooldown(fromID, toID, 0.1)
+	u := o.policy.Played(progress)
+	if o.selector.Ratings().Pinned(toID) {
+		u.Penalty, u.Cooldown = 0, 0
+	}
+	if explored && o.explorer != nil {
+		opts := o.explorer.Options()
+		u.Reward *= opts.RewardScale
+		u.Penalty *= opts.PenaltyScale
+	}
+	return o.record(rg, fromID, toID, u)
+}
+
+// Signal applies explicit feedback on the transition from fromID to toID. It
+// is taken even while learning is frozen, since it was asked for.
+func (o *Orchestrator) Signal(fromID, toID int64, s feedback.Signal) (Feedback, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.state == stateShutDown {
+		return Feedback{}, false
+	}
+
+	rg := o.runtimeGraph.Load()
+	if rg == nil {
+		return Feedback{}, false
+	}
+	return o.record(rg, fromID, toID, o.policy.Signal(s))
+}
+
+func (o *Orchestrator) apply(rg *runtime.RuntimeGraph, fromID, toID int64, u feedback.Update) {
+	if u.Clear {
+		rg.Clear(fromID, toID)
+	}
+	if u.Reward > 0 {
+		rg.Reinforce(fromID, toID, u.Reward)
+	}
+	if u.Penalty > 0 {
+		rg.Penalty(fromID, toID, u.Penalty)
+	}
+	if u.Cooldown > 0 {
+		rg.AddCooldown(fromID, toID, u.Cooldown)
 	}
 	addChainSignal(o, o.diffChan, struct{}{})
 }
@@ -276,11 +616,83 @@ func (o *Orchestrator) PlayNext() (int64, bool) {
 		return 0, false
 	}
 
+	prepared := o.prepared
+	o.prepared = nil
+	o.currentExplored = false
+
 	id, ok := o.playForward()
+	if !ok {
+		id, ok = o.playQueued()
+	}
+	if !ok && prepared != nil && prepared.fromID == o.playbackChain.Current {
+		o.played(*prepared)
+		id, ok = prepared.toID, true
+	}
+	if !ok {
+		id, ok = o.generateNext()
+	}
+	if ok && o.explorer != nil {
+		o.explorer.Played(id)
+	}
 	if ok {
-		return id, true
+		o.recordPlay(id)
+	}
+	return id, ok
+}
+
+// recordPlay tells the selector's filter that id started playing.
+func (o *Orchestrator) recordPlay(id int64) {
+	if f := o.selector.Filter(); f != nil {
+		f.Played(id, time.Now())
+	}
+}
+
+// PrepareNext returns the song PlayNext would play without moving the
+// playback chain, so that a player can load it before the current song ends.
+// A pick of the selector is kept and played by the next PlayNext unless the
+// current song changes first; the forward stack and the queue are only read,
+// so editing the queue in between still takes effect.
+func (o *Orchestrator) PrepareNext() (int64, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.state == stateShutDown {
+		return 0, false
+	}
+
+	pc := o.playbackChain
+	if n := len(pc.ForwardStack); n > 0 {
+		return pc.ForwardStack[n-1], true
+	}
+	if len(pc.Queue) > 0 {
+		return pc.Queue[0], true
+	}
+	if o.prepared != nil && o.prepared.fromID == pc.Current {
+		return o.prepared.toID, true
+	}
+
+	rg := o.runtimeGraph.Load()
+	if rg == nil {
+		return 0, false
 	}
-	return o.generateNext()
+	p, ok := o.pick(pc.Current, rg)
+	if !ok {
+		return 0, false
+	}
+	o.prepared = &p
+	return p.toID, true
+}
+
+// playQueued plays the head of the user queue. Unlike replaying the forward
+// stack this is a new transition, so learning applies to it.
+func (o *Orchestrator) playQueued() (int64, bool) {
+	id, ok := o.playbackChain.Dequeue()
+	if !ok {
+		return 0, false
+	}
+
+	o.playbackChain.UnfreezeLearning()
+
+	return id, true
 }
 
 func (o *Orchestrator) generateNext() (int64, bool) {
@@ -294,14 +706,14 @@ func (o *Orchestrator) generateNext() (int64, bool) {
 		return 0, false
 	}
 
-	toID, ok := o.selector.Next(fromID, rg)
+	p, ok := o.pick(fromID, rg)
 	if !ok {
 		return 0, false
 	}
 
-	o.playbackChain.Next(toID)
+	o.played(p)
 
-	return toID, true
+	return p.toID, true
 }
 
 func (o *Orchestrator) playForward() (int64, bool) {
@@ -326,8 +738,69 @@ func (o *Orchestrator) PlayBack() (int64, bool) {
 	if !ok {
 		return 0, false
 	}
+	o.prepared = nil
 
 	o.playbackChain.FreezeLearning()
+	o.recordPlay(id)
 
 	return id, true
 }
+
+func (o *Orchestrator) Enqueue(ids ...int64) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.state == stateShutDown {
+		return false
+	}
+	o.playbackChain.Enqueue(ids...)
+	return true
+}
+
+func (o *Orchestrator) InsertNext(id int64) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.state == stateShutDown {
+		return false
+	}
+	o.playbackChain.InsertNext(id)
+	return true
+}
+
+func (o *Orchestrator) RemoveFromQueue(index int) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.state == stateShutDown {
+		return false
+	}
+	return o.playbackChain.Remove(index)
+}
+
+func (o *Orchestrator) MoveInQueue(from, to int) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.state == stateShutDown {
+		return false
+	}
+	return o.playbackChain.Move(from, to)
+}
+
+func (o *Orchestrator) ClearQueue() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.state == stateShutDown {
+		return false
+	}
+	o.playbackChain.ClearQueue()
+	return true
+}
+
+func (o *Orchestrator) Queue() []int64 {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.state == stateShutDown {
+		return nil
+	}
+	queue := make([]int64, len(o.playbackChain.Queue))
+	copy(queue, o.playbackChain.Queue)
+	return queue
+}
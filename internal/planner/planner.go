@@ -0,0 +1,192 @@
+package planner
+
+import (
+	"GO_player/internal/memory/runtime"
+	"GO_player/internal/memory/selector"
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	defaultBeamWidth = 8
+	// defaultSongLength stands in for songs whose duration is not known.
+	defaultSongLength = 210 * time.Second
+)
+
+type Options struct {
+	// Count is how many songs to plan and Duration how long the plan should
+	// last; planning stops at whichever is reached first. One of them is
+	// required.
+	Count    int
+	Duration time.Duration
+	// BeamWidth is how many partial plans are kept at each step.
+	BeamWidth int
+	// Filter, when set, keeps the plan diverse. It is cloned, not changed.
+	// A song is never planned twice either way.
+	Filter *selector.Filter
+	// Ratings, when set, keep banned songs out of the plan and favour pinned
+	// ones.
+	Ratings *selector.Ratings
+	// Length returns the duration of a song, false when it is not known.
+	Length func(songID int64) (time.Duration, bool)
+	// Start is the time the plan starts playing, for the time based
+	// constraints. It defaults to now.
+	Start time.Time
+}
+
+// Plan is a sequence of songs. LogProb is the log of the product of its
+// transition probabilities.
+type Plan struct {
+	SongIDs  []int64       `json:"song_ids"`
+	LogProb  float64       `json:"log_prob"`
+	Duration time.Duration `json:"duration"`
+}
+
+type beam struct {
+	ids      []int64
+	planned  map[int64]bool
+	logProb  float64
+	duration time.Duration
+	filter   *selector.Filter
+}
+
+func (b *beam) done(opts Options) bool {
+	return (opts.Count > 0 && len(b.ids) >= opts.Count) ||
+		(opts.Duration > 0 && b.duration >= opts.Duration)
+}
+
+// mean is the average log probability of a transition, which compares plans
+// of different lengths.
+func (b *beam) mean() float64 {
+	if len(b.ids) == 0 {
+		return math.Inf(-1)
+	}
+	return b.logProb / float64(len(b.ids))
+}
+
+// Build plans the songs to play after fromID with a beam search over the
+// transition probabilities of rg: at each step every kept plan is extended by
+// each allowed next song, and the BeamWidth most likely plans go on. A plan
+// that reaches a song the graph leads nowhere from ends early; the result is
+// the most likely complete plan, or the longest one when none completes.
+func Build(rg *runtime.RuntimeGraph, fromID int64, opts Options) (*Plan, error) {
+	if opts.Count <= 0 && opts.Duration <= 0 {
+		return nil, errors.New("a song count or a duration is required")
+	}
+	if opts.BeamWidth <= 0 {
+		opts.BeamWidth = defaultBeamWidth
+	}
+	if opts.Start.IsZero() {
+		opts.Start = time.Now()
+	}
+	length := func(id int64) time.Duration {
+		if opts.Length != nil {
+			if d, ok := opts.Length(id); ok && d > 0 {
+				return d
+			}
+		}
+		return defaultSongLength
+	}
+
+	start := &beam{planned: make(map[int64]bool)}
+	if opts.Filter != nil {
+		start.filter = opts.Filter.Clone()
+	}
+	type candidate struct {
+		from    *beam
+		id      int64
+		logProb float64
+		at      time.Time
+	}
+	beams := []*beam{start}
+	var ended []*beam
+	for len(beams) > 0 {
+		var next []candidate
+		for _, b := range beams {
+			last := fromID
+			if len(b.ids) > 0 {
+				last = b.ids[len(b.ids)-1]
+			}
+			at := opts.Start.Add(b.duration)
+			extended := false
+			probs := rg.GetEdges(last)
+			if opts.Ratings != nil {
+				probs = opts.Ratings.Apply(probs)
+			}
+			for id, p := range probs {
+				if p <= 0 || id == 0 || b.planned[id] {
+					continue
+				}
+				if b.filter != nil && !b.filter.Allowed(id, at) {
+					continue
+				}
+				next = append(next, candidate{from: b, id: id, logProb: b.logProb + math.Log(p), at: at})
+				extended = true
+			}
+			if !extended {
+				ended = append(ended, b)
+			}
+		}
+
+		sort.Slice(next, func(i, j int) bool {
+			if next[i].logProb != next[j].logProb {
+				return next[i].logProb > next[j].logProb
+			}
+			return next[i].id < next[j].id
+		})
+		beams = nil
+		for i, c := range next {
+			if i == opts.BeamWidth {
+				break
+			}
+			b := c.from.extend(c.id, c.logProb, length(c.id), c.at)
+			if b.done(opts) {
+				ended = append(ended, b)
+				continue
+			}
+			beams = append(beams, b)
+		}
+	}
+
+	var best *beam
+	for _, b := range ended {
+		if best == nil || better(b, best, opts) {
+			best = b
+		}
+	}
+	if best == nil || len(best.ids) == 0 {
+		return nil, errors.New("the graph leads nowhere from the start song")
+	}
+	return &Plan{SongIDs: best.ids, LogProb: best.logProb, Duration: best.duration}, nil
+}
+
+func (b *beam) extend(id int64, logProb float64, length time.Duration, at time.Time) *beam {
+	nb := &beam{
+		ids:      append(append(make([]int64, 0, len(b.ids)+1), b.ids...), id),
+		planned:  make(map[int64]bool, len(b.planned)+1),
+		logProb:  logProb,
+		duration: b.duration + length,
+	}
+	for planned := range b.planned {
+		nb.planned[planned] = true
+	}
+	nb.planned[id] = true
+	if b.filter != nil {
+		nb.filter = b.filter.Clone()
+		nb.filter.Played(id, at)
+	}
+	return nb
+}
+
+// better prefers complete plans, then longer ones, then the more likely.
+func better(a, b *beam, opts Options) bool {
+	if a.done(opts) != b.done(opts) {
+		return a.done(opts)
+	}
+	if !a.done(opts) && len(a.ids) != len(b.ids) {
+		return len(a.ids) > len(b.ids)
+	}
+	return a.mean() > b.mean()
+}
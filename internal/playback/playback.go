@@ -5,6 +5,7 @@ type PlaybackChain struct {
 	Current        int64   `json:"current"`
 	ForwardStack   []int64 `json:"forward_stack"`
 	LearningFrozen bool    `json:"learning_frozen"`
+	Queue          []int64 `json:"queue"`
 }
 
 func (pc *PlaybackChain) Back() (int64, bool) {
@@ -52,3 +53,45 @@ func (pc *PlaybackChain) UnfreezeLearning() {
 	}
 	pc.LearningFrozen = false
 }
+
+// Enqueue appends songs to the end of the user queue.
+func (pc *PlaybackChain) Enqueue(ids ...int64) {
+	pc.Queue = append(pc.Queue, ids...)
+}
+
+// InsertNext puts a song at the head of the user queue.
+func (pc *PlaybackChain) InsertNext(id int64) {
+	pc.Queue = append([]int64{id}, pc.Queue...)
+}
+
+func (pc *PlaybackChain) Remove(index int) bool {
+	if index < 0 || index >= len(pc.Queue) {
+		return false
+	}
+	pc.Queue = append(pc.Queue[:index], pc.Queue[index+1:]...)
+	return true
+}
+
+func (pc *PlaybackChain) Move(from, to int) bool {
+	if from < 0 || from >= len(pc.Queue) || to < 0 || to >= len(pc.Queue) {
+		return false
+	}
+	id := pc.Queue[from]
+	pc.Queue = append(pc.Queue[:from], pc.Queue[from+1:]...)
+	pc.Queue = append(pc.Queue[:to], append([]int64{id}, pc.Queue[to:]...)...)
+	return true
+}
+
+func (pc *PlaybackChain) ClearQueue() {
+	pc.Queue = pc.Queue[:0]
+}
+
+// Dequeue moves the head of the user queue into Current.
+func (pc *PlaybackChain) Dequeue() (int64, bool) {
+	if len(pc.Queue) == 0 {
+		return 0, false
+	}
+	id := pc.Queue[0]
+	pc.Queue = pc.Queue[1:]
+	return pc.Next(id)
+}
@@ -0,0 +1,83 @@
+package playlist
+
+import (
+	"GO_player/internal/catalog"
+	"GO_player/internal/models"
+	"errors"
+	"time"
+)
+
+const defaultSeedWeight = 1.0
+
+type ImportOptions struct {
+	// Name names the playlist; it defaults to the name the file gives.
+	Name string
+	// Dir is the directory relative paths in the file are taken from,
+	// normally the one the file is in.
+	Dir string
+	// Seed reinforces the transitions between consecutive songs, by
+	// SeedWeight which defaults to 1. See Seed.
+	Seed       bool
+	SeedWeight float64
+}
+
+type ImportResult struct {
+	Playlist *models.Playlist `json:"playlist"`
+	Missing  []Entry          `json:"missing"`
+	Seeded   int              `json:"seeded"`
+}
+
+// Import saves the songs of a playlist file that are in the catalog as a new
+// playlist. Entries that match no song are reported and left out.
+func Import(cat catalog.Catalog, file *File, opts ImportOptions) (*ImportResult, error) {
+	if opts.SeedWeight <= 0 {
+		opts.SeedWeight = defaultSeedWeight
+	}
+	songs, err := cat.ListSongs()
+	if err != nil {
+		return nil, err
+	}
+	ids, missing := NewResolver(songs).Resolve(file, opts.Dir)
+	if len(ids) == 0 {
+		return nil, errors.New("no song of the playlist is in the catalog")
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = file.Name
+	}
+	now := time.Now().UTC()
+	p := &models.Playlist{Name: name, SongIDs: ids, CreatedAt: now, UpdatedAt: now}
+	if err := cat.SavePlaylist(p); err != nil {
+		return nil, err
+	}
+
+	res := &ImportResult{Playlist: p, Missing: missing}
+	if res.Missing == nil {
+		res.Missing = []Entry{}
+	}
+	if opts.Seed {
+		if res.Seeded, err = Seed(cat, ids, opts.SeedWeight); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Songs loads the songs of a playlist in order, skipping songs that were
+// removed from the catalog since.
+func Songs(cat catalog.Catalog, p *models.Playlist) ([]*models.Song, error) {
+	songs := make([]*models.Song, 0, len(p.SongIDs))
+	for _, id := range p.SongIDs {
+		song, err := cat.LoadSong(id)
+		if err != nil {
+			return nil, err
+		}
+		if song.ID == 0 && song.Path == "" {
+			continue
+		}
+		song.ID = id
+		songs = append(songs, song)
+	}
+	return songs, nil
+}
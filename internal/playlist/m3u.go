@@ -0,0 +1,71 @@
+package playlist
+
+import (
+	"GO_player/internal/models"
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WriteM3U8 writes songs as an extended M3U playlist in UTF-8, one file path
+// per song.
+func WriteM3U8(w io.Writer, name string, songs []*models.Song) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#EXTM3U")
+	if name != "" {
+		fmt.Fprintf(bw, "#PLAYLIST:%s\n", oneLine(name))
+	}
+	for _, song := range songs {
+		length := -1
+		if song.Duration > 0 {
+			length = int(math.Round(song.Duration))
+		}
+		fmt.Fprintf(bw, "#EXTINF:%d,%s\n", length, displayName(song))
+		fmt.Fprintln(bw, song.Path)
+	}
+	return bw.Flush()
+}
+
+// parseM3U reads plain and extended M3U. Unknown directives are skipped, and
+// an #EXTINF line describes the path that follows it.
+func parseM3U(r io.Reader) (*File, error) {
+	file := &File{}
+	var pending Entry
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	first := true
+	for sc.Scan() {
+		line := sc.Text()
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXTINF:"):
+			length, title, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			// The length may be followed by attributes, as in
+			// #EXTINF:-1 tvg-id="x",Title.
+			length, _, _ = strings.Cut(strings.TrimSpace(length), " ")
+			pending = Entry{Title: strings.TrimSpace(title)}
+			if d, err := strconv.ParseFloat(length, 64); err == nil && d > 0 {
+				pending.Duration = d
+			}
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			file.Name = strings.TrimSpace(strings.TrimPrefix(line, "#PLAYLIST:"))
+		case strings.HasPrefix(line, "#"):
+		default:
+			pending.Path = line
+			file.Entries = append(file.Entries, pending)
+			pending = Entry{}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
@@ -0,0 +1,88 @@
+package playlist
+
+import (
+	"GO_player/internal/models"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+type Format string
+
+const (
+	FormatM3U8 Format = "m3u8"
+	FormatPLS  Format = "pls"
+	FormatXSPF Format = "xspf"
+)
+
+// FormatOf guesses the format of a playlist file from its extension. Plain
+// .m3u files are read as extended M3U too.
+func FormatOf(path string) (Format, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".m3u", ".m3u8":
+		return FormatM3U8, nil
+	case ".pls":
+		return FormatPLS, nil
+	case ".xspf":
+		return FormatXSPF, nil
+	default:
+		return "", fmt.Errorf("unknown playlist extension %q", ext)
+	}
+}
+
+// Entry is one track of a playlist file. Duration is in seconds, 0 when the
+// file does not say.
+type Entry struct {
+	Path     string
+	Title    string
+	Duration float64
+}
+
+// File is a playlist as read from a file. Its name is empty when the format
+// or the file has none.
+type File struct {
+	Name    string
+	Entries []Entry
+}
+
+func Parse(format Format, r io.Reader) (*File, error) {
+	switch format {
+	case FormatM3U8:
+		return parseM3U(r)
+	case FormatPLS:
+		return parsePLS(r)
+	case FormatXSPF:
+		return parseXSPF(r)
+	default:
+		return nil, fmt.Errorf("unknown playlist format %q", format)
+	}
+}
+
+func Write(w io.Writer, format Format, name string, songs []*models.Song) error {
+	switch format {
+	case FormatM3U8:
+		return WriteM3U8(w, name, songs)
+	case FormatPLS:
+		return WritePLS(w, songs)
+	case FormatXSPF:
+		return WriteXSPF(w, name, songs)
+	default:
+		return fmt.Errorf("unknown playlist format %q", format)
+	}
+}
+
+// displayName is "Artist - Title", or whichever of them is known.
+func displayName(song *models.Song) string {
+	name := song.Title
+	if song.Artist != "" && name != "" {
+		name = song.Artist + " - " + name
+	} else if name == "" {
+		name = song.Artist
+	}
+	return oneLine(name)
+}
+
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,109 @@
+package playlist
+
+import (
+	"GO_player/internal/models"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WritePLS writes songs as a version 2 PLS playlist.
+func WritePLS(w io.Writer, songs []*models.Song) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "[playlist]")
+	for i, song := range songs {
+		n := i + 1
+		length := -1
+		if song.Duration > 0 {
+			length = int(math.Round(song.Duration))
+		}
+		fmt.Fprintf(bw, "File%d=%s\n", n, song.Path)
+		if name := displayName(song); name != "" {
+			fmt.Fprintf(bw, "Title%d=%s\n", n, name)
+		}
+		fmt.Fprintf(bw, "Length%d=%d\n", n, length)
+	}
+	fmt.Fprintf(bw, "NumberOfEntries=%d\n", len(songs))
+	fmt.Fprintln(bw, "Version=2")
+	return bw.Flush()
+}
+
+// parsePLS reads the [playlist] section of a PLS file. Entries are ordered by
+// their number, which need not be contiguous, and keys are matched without
+// regard to case.
+func parsePLS(r io.Reader) (*File, error) {
+	entries := make(map[int]*Entry)
+	entry := func(n int) *Entry {
+		if entries[n] == nil {
+			entries[n] = &Entry{}
+		}
+		return entries[n]
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	section := ""
+	sawSection := false
+	for sc.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(sc.Text(), "\ufeff"))
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			sawSection = sawSection || section == "playlist"
+			continue
+		}
+		if section != "playlist" {
+			continue
+		}
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, val = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(val)
+		for _, field := range []string{"file", "title", "length"} {
+			if !strings.HasPrefix(key, field) {
+				continue
+			}
+			n, err := strconv.Atoi(key[len(field):])
+			if err != nil {
+				break
+			}
+			switch field {
+			case "file":
+				entry(n).Path = val
+			case "title":
+				entry(n).Title = val
+			case "length":
+				if d, err := strconv.ParseFloat(val, 64); err == nil && d > 0 {
+					entry(n).Duration = d
+				}
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if !sawSection {
+		return nil, errors.New("no [playlist] section")
+	}
+
+	numbers := make([]int, 0, len(entries))
+	for n := range entries {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	file := &File{}
+	for _, n := range numbers {
+		if entries[n].Path != "" {
+			file.Entries = append(file.Entries, *entries[n])
+		}
+	}
+	return file, nil
+}
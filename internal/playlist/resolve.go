@@ -0,0 +1,61 @@
+package playlist
+
+import (
+	"GO_player/internal/models"
+	"path/filepath"
+)
+
+// Resolver finds the songs of the catalog that the entries of a playlist
+// file point to.
+type Resolver struct {
+	byPath map[string]int64
+	// byName holds the songs by file name, or 0 when several songs share it.
+	byName map[string]int64
+}
+
+func NewResolver(songs []*models.Song) *Resolver {
+	r := &Resolver{byPath: make(map[string]int64), byName: make(map[string]int64)}
+	for _, song := range songs {
+		if song.Path == "" {
+			continue
+		}
+		r.byPath[cleanPath(song.Path, "")] = song.ID
+		name := filepath.Base(song.Path)
+		if _, ok := r.byName[name]; ok {
+			r.byName[name] = 0
+		} else {
+			r.byName[name] = song.ID
+		}
+	}
+	return r
+}
+
+// Resolve returns the song of every entry in order, and the entries that
+// match no song. Relative paths are taken relative to dir, the directory of
+// the playlist file. A path that matches no song path exactly still resolves
+// when exactly one song has the same file name, which covers playlists made
+// on another machine.
+func (r *Resolver) Resolve(file *File, dir string) (songIDs []int64, missing []Entry) {
+	for _, e := range file.Entries {
+		if id, ok := r.byPath[cleanPath(e.Path, dir)]; ok {
+			songIDs = append(songIDs, id)
+			continue
+		}
+		if id := r.byName[filepath.Base(e.Path)]; id != 0 {
+			songIDs = append(songIDs, id)
+			continue
+		}
+		missing = append(missing, e)
+	}
+	return songIDs, missing
+}
+
+func cleanPath(path, dir string) string {
+	if !filepath.IsAbs(path) && dir != "" {
+		path = filepath.Join(dir, path)
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,94 @@
+package playlist
+
+import (
+	"GO_player/internal/catalog"
+	"GO_player/internal/memory/basegraph"
+	"GO_player/internal/models"
+	"errors"
+)
+
+// Seed reinforces the transition between every two consecutive songs of a
+// playlist by weight, since someone chose to put them one after the other.
+// Transitions within an album go to the album's graph and the others to the
+// library graph. As in the importer, songs without an album belong to album
+// 0. It returns how many transitions were reinforced.
+func Seed(cat catalog.Catalog, songIDs []int64, weight float64) (int, error) {
+	if weight <= 0 {
+		return 0, errors.New("seed weight must be positive")
+	}
+
+	var seeded int
+	err := cat.Update(func(uow catalog.UnitOfWork) error {
+		seeded = 0
+		albums := make(map[int64]*basegraph.BaseGraph)
+		var library *basegraph.BaseGraph
+		graph := func(from, to *models.Song) (*basegraph.BaseGraph, error) {
+			if from.AlbumID != to.AlbumID {
+				if library == nil {
+					edges, err := uow.LoadLibraryGraphEdges()
+					if err != nil {
+						return nil, err
+					}
+					if library, err = fromEdges(edges); err != nil {
+						return nil, err
+					}
+				}
+				return library, nil
+			}
+			albumID := from.AlbumID
+			if albums[albumID] == nil {
+				edges, err := uow.LoadBaseGraphEdges(albumID)
+				if err != nil {
+					return nil, err
+				}
+				if albums[albumID], err = fromEdges(edges); err != nil {
+					return nil, err
+				}
+			}
+			return albums[albumID], nil
+		}
+
+		for i := 1; i < len(songIDs); i++ {
+			fromID, toID := songIDs[i-1], songIDs[i]
+			if fromID == toID {
+				continue
+			}
+			from, err := uow.LoadSong(fromID)
+			if err != nil {
+				return err
+			}
+			to, err := uow.LoadSong(toID)
+			if err != nil {
+				return err
+			}
+			bg, err := graph(from, to)
+			if err != nil {
+				return err
+			}
+			bg.Reinforce(fromID, toID, weight)
+			seeded++
+		}
+
+		for albumID, bg := range albums {
+			if err := uow.SaveBaseGraph(albumID, bg); err != nil {
+				return err
+			}
+		}
+		if library != nil {
+			return uow.SaveLibraryGraphEdges(library.GetEdges())
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return seeded, nil
+}
+
+func fromEdges(edges map[int64]map[int64]float64) (*basegraph.BaseGraph, error) {
+	bg := basegraph.NewBaseGraph()
+	if err := bg.SetEdges(edges); err != nil {
+		return nil, err
+	}
+	return bg, nil
+}
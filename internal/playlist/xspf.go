@@ -0,0 +1,116 @@
+package playlist
+
+import (
+	"GO_player/internal/models"
+	"encoding/xml"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+const xspfNamespace = "http://xspf.org/ns/0/"
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version string      `xml:"version,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location []string `xml:"location"`
+	Title    string   `xml:"title,omitempty"`
+	Creator  string   `xml:"creator,omitempty"`
+	// Duration is in milliseconds.
+	Duration int64 `xml:"duration,omitempty"`
+}
+
+// WriteXSPF writes songs as an XSPF playlist with file URIs as locations.
+func WriteXSPF(w io.Writer, name string, songs []*models.Song) error {
+	doc := xspfPlaylist{Version: "1", Title: name}
+	for _, song := range songs {
+		doc.Tracks = append(doc.Tracks, xspfTrack{
+			Location: []string{fileURI(song.Path)},
+			Title:    song.Title,
+			Creator:  song.Artist,
+			Duration: int64(song.Duration * 1000),
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// parseXSPF reads the first location of every track. Tracks without one
+// cannot be resolved to a file and are left out.
+func parseXSPF(r io.Reader) (*File, error) {
+	var doc xspfPlaylist
+	dec := xml.NewDecoder(r)
+	// Accept files that leave out the namespace.
+	dec.DefaultSpace = xspfNamespace
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	file := &File{Name: strings.TrimSpace(doc.Title)}
+	for _, t := range doc.Tracks {
+		if len(t.Location) == 0 {
+			continue
+		}
+		e := Entry{Path: uriPath(strings.TrimSpace(t.Location[0])), Title: strings.TrimSpace(t.Title)}
+		if creator := strings.TrimSpace(t.Creator); creator != "" && e.Title != "" {
+			e.Title = creator + " - " + e.Title
+		}
+		if t.Duration > 0 {
+			e.Duration = float64(t.Duration) / 1000
+		}
+		file.Entries = append(file.Entries, e)
+	}
+	return file, nil
+}
+
+// fileURI turns an absolute path into a file URI; relative paths become
+// relative URI references.
+func fileURI(path string) string {
+	u := url.URL{Path: filepath.ToSlash(path)}
+	if filepath.IsAbs(path) {
+		u.Scheme = "file"
+		if !strings.HasPrefix(u.Path, "/") {
+			// A Windows drive letter, file:///C:/...
+			u.Path = "/" + u.Path
+		}
+	}
+	return u.String()
+}
+
+// uriPath turns a file URI or relative reference back into a path. Anything
+// else, such as a web URL, is returned unchanged so that it fails to resolve.
+func uriPath(location string) string {
+	u, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Host != "" && u.Host != "localhost" {
+			return location
+		}
+		path := u.Path
+		if len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+			path = path[1:]
+		}
+		return filepath.FromSlash(path)
+	case "":
+		return filepath.FromSlash(u.Path)
+	default:
+		return location
+	}
+}
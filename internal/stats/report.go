@@ -0,0 +1,95 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Period:\t%s\n", period(r.From, r.To))
+	fmt.Fprintf(tw, "Plays:\t%d\n", r.Plays)
+	fmt.Fprintf(tw, "Average completion:\t%.1f%%\n", r.AverageCompletion*100)
+
+	section(tw, "Top songs", "SONG\tPLAYS")
+	for _, s := range r.TopSongs {
+		fmt.Fprintf(tw, "%s\t%d\n", songName(s.SongID, s.Title), s.Plays)
+	}
+
+	section(tw, "Top transitions", "FROM\tTO\tPLAYS\tWEIGHT")
+	for _, t := range r.TopTransitions {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%.2f\n", t.FromID, t.ToID, t.Plays, t.Weight)
+	}
+
+	section(tw, "Skip rate", "SONG\tPLAYS\tSKIPS\tRATE")
+	for _, s := range r.SkipRates {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.0f%%\n", songName(s.SongID, s.Title), s.Plays, s.Skips, s.Rate*100)
+	}
+
+	section(tw, "Listening time per day", "DAY\tTIME")
+	for _, l := range r.Daily {
+		fmt.Fprintf(tw, "%s\t%s\n", l.Start.Format("2006-01-02"), seconds(l.Seconds))
+	}
+
+	section(tw, "Listening time per week", "WEEK OF\tTIME")
+	for _, l := range r.Weekly {
+		fmt.Fprintf(tw, "%s\t%s\n", l.Start.Format("2006-01-02"), seconds(l.Seconds))
+	}
+
+	section(tw, "Sticky songs", "SONG\tSCORE\tCYCLE")
+	for _, s := range r.Sticky {
+		fmt.Fprintf(tw, "%s\t%.2f\t%s\n", songName(s.SongID, s.Title), s.Score, cycle(s.Cycle))
+	}
+
+	section(tw, "Never selected", "SONG")
+	for _, s := range r.NeverSelected {
+		fmt.Fprintf(tw, "%s\n", songName(s.SongID, s.Title))
+	}
+
+	return tw.Flush()
+}
+
+func section(w io.Writer, title, header string) {
+	fmt.Fprintf(w, "\n%s\n%s\n", title, header)
+}
+
+func period(from, to time.Time) string {
+	f, t := "beginning", "now"
+	if !from.IsZero() {
+		f = from.Format(time.DateTime)
+	}
+	if !to.IsZero() {
+		t = to.Format(time.DateTime)
+	}
+	return f + " - " + t
+}
+
+func songName(id int64, title string) string {
+	if title == "" {
+		return fmt.Sprintf("#%d", id)
+	}
+	return fmt.Sprintf("#%d %s", id, title)
+}
+
+func seconds(s float64) string {
+	return (time.Duration(s) * time.Second).String()
+}
+
+func cycle(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprint(id)
+	}
+	return strings.Join(parts, " > ")
+}
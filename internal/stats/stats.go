@@ -0,0 +1,372 @@
+package stats
+
+import (
+	"GO_player/internal/catalog"
+	"GO_player/internal/models"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	defaultTop = 10
+	maxCycle   = 3
+)
+
+type Options struct {
+	From     time.Time
+	To       time.Time
+	Top      int
+	Location *time.Location
+}
+
+type SongCount struct {
+	SongID int64  `json:"song_id"`
+	Title  string `json:"title,omitempty"`
+	Plays  int    `json:"plays"`
+}
+
+type TransitionCount struct {
+	FromID int64   `json:"from_id"`
+	ToID   int64   `json:"to_id"`
+	Plays  int     `json:"plays"`
+	Weight float64 `json:"weight"`
+}
+
+type SkipRate struct {
+	SongID int64   `json:"song_id"`
+	Title  string  `json:"title,omitempty"`
+	Plays  int     `json:"plays"`
+	Skips  int     `json:"skips"`
+	Rate   float64 `json:"rate"`
+}
+
+type ListeningTime struct {
+	Start   time.Time `json:"start"`
+	Seconds float64   `json:"seconds"`
+}
+
+// StickySong scores how strongly a song's graph leads back to it: the weight
+// of the weakest edge on its best cycle of up to three transitions.
+type StickySong struct {
+	SongID int64   `json:"song_id"`
+	Title  string  `json:"title,omitempty"`
+	Score  float64 `json:"score"`
+	Cycle  []int64 `json:"cycle"`
+}
+
+type SongRef struct {
+	SongID int64  `json:"song_id"`
+	Title  string `json:"title,omitempty"`
+}
+
+type Report struct {
+	From              time.Time         `json:"from"`
+	To                time.Time         `json:"to"`
+	Plays             int               `json:"plays"`
+	TopSongs          []SongCount       `json:"top_songs"`
+	TopTransitions    []TransitionCount `json:"top_transitions"`
+	SkipRates         []SkipRate        `json:"skip_rates"`
+	AverageCompletion float64           `json:"average_completion"`
+	Daily             []ListeningTime   `json:"daily"`
+	Weekly            []ListeningTime   `json:"weekly"`
+	Sticky            []StickySong      `json:"sticky"`
+	NeverSelected     []SongRef         `json:"never_selected"`
+}
+
+// Input is what a report is computed from. Edges is the combined graph of
+// every album and the library.
+type Input struct {
+	Events []*models.PlayEvent
+	Songs  []*models.Song
+	Edges  map[int64]map[int64]float64
+}
+
+// Load reads the events of the period, the songs and all graphs of the
+// catalog's profile and computes the report.
+func Load(cat catalog.Catalog, opts Options) (*Report, error) {
+	events, err := cat.ListPlayEvents(opts.From, opts.To)
+	if err != nil {
+		return nil, err
+	}
+	songs, err := cat.ListSongs()
+	if err != nil {
+		return nil, err
+	}
+
+	edges := make(map[int64]map[int64]float64)
+	ids, err := cat.ListBaseGraphIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		album, err := cat.LoadBaseGraphEdges(id)
+		if err != nil {
+			return nil, err
+		}
+		addEdges(edges, album)
+	}
+	learned, err := cat.LoadLibraryGraphEdges()
+	if err != nil {
+		return nil, err
+	}
+	addEdges(edges, learned)
+
+	return Compute(Input{Events: events, Songs: songs, Edges: edges}, opts), nil
+}
+
+func addEdges(dst, src map[int64]map[int64]float64) {
+	for fromID, neighbors := range src {
+		if dst[fromID] == nil {
+			dst[fromID] = make(map[int64]float64, len(neighbors))
+		}
+		for toID, weight := range neighbors {
+			dst[fromID][toID] += weight
+		}
+	}
+}
+
+func Compute(in Input, opts Options) *Report {
+	if opts.Top <= 0 {
+		opts.Top = defaultTop
+	}
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+
+	titles := make(map[int64]string, len(in.Songs))
+	for _, song := range in.Songs {
+		titles[song.ID] = song.Title
+	}
+
+	report := &Report{From: opts.From, To: opts.To, Plays: len(in.Events)}
+	report.TopSongs = topSongs(in.Events, titles, opts.Top)
+	report.TopTransitions = topTransitions(in.Events, in.Edges, opts.Top)
+	report.SkipRates = skipRates(in.Events, titles)
+	report.AverageCompletion = averageCompletion(in.Events)
+	report.Daily = listeningTime(in.Events, func(t time.Time) time.Time {
+		return dayStart(t.In(opts.Location))
+	})
+	report.Weekly = listeningTime(in.Events, func(t time.Time) time.Time {
+		return weekStart(t.In(opts.Location))
+	})
+	report.Sticky = stickySongs(in.Edges, titles, opts.Top)
+	report.NeverSelected = neverSelected(in.Events, in.Edges, in.Songs)
+	return report
+}
+
+func topSongs(events []*models.PlayEvent, titles map[int64]string, top int) []SongCount {
+	counts := make(map[int64]int)
+	for _, e := range events {
+		counts[e.SongID]++
+	}
+
+	res := make([]SongCount, 0, len(counts))
+	for id, plays := range counts {
+		res = append(res, SongCount{SongID: id, Title: titles[id], Plays: plays})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Plays != res[j].Plays {
+			return res[i].Plays > res[j].Plays
+		}
+		return res[i].SongID < res[j].SongID
+	})
+	return limit(res, top)
+}
+
+func topTransitions(events []*models.PlayEvent, edges map[int64]map[int64]float64, top int) []TransitionCount {
+	type edge struct{ from, to int64 }
+	counts := make(map[edge]int)
+	for _, e := range events {
+		if e.PreviousID == 0 {
+			continue
+		}
+		counts[edge{e.PreviousID, e.SongID}]++
+	}
+
+	res := make([]TransitionCount, 0, len(counts))
+	for t, plays := range counts {
+		res = append(res, TransitionCount{FromID: t.from, ToID: t.to, Plays: plays, Weight: edges[t.from][t.to]})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Plays != res[j].Plays {
+			return res[i].Plays > res[j].Plays
+		}
+		if res[i].Weight != res[j].Weight {
+			return res[i].Weight > res[j].Weight
+		}
+		if res[i].FromID != res[j].FromID {
+			return res[i].FromID < res[j].FromID
+		}
+		return res[i].ToID < res[j].ToID
+	})
+	return limit(res, top)
+}
+
+// skipRates counts a play as skipped when it was skipped or left with back.
+func skipRates(events []*models.PlayEvent, titles map[int64]string) []SkipRate {
+	rates := make(map[int64]*SkipRate)
+	for _, e := range events {
+		r := rates[e.SongID]
+		if r == nil {
+			r = &SkipRate{SongID: e.SongID, Title: titles[e.SongID]}
+			rates[e.SongID] = r
+		}
+		r.Plays++
+		if e.Outcome != models.OutcomeCompleted {
+			r.Skips++
+		}
+	}
+
+	res := make([]SkipRate, 0, len(rates))
+	for _, r := range rates {
+		r.Rate = float64(r.Skips) / float64(r.Plays)
+		res = append(res, *r)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Rate != res[j].Rate {
+			return res[i].Rate > res[j].Rate
+		}
+		if res[i].Plays != res[j].Plays {
+			return res[i].Plays > res[j].Plays
+		}
+		return res[i].SongID < res[j].SongID
+	})
+	return res
+}
+
+// averageCompletion only counts events whose duration is known.
+func averageCompletion(events []*models.PlayEvent) float64 {
+	sum := 0.0
+	n := 0
+	for _, e := range events {
+		if e.Duration <= 0 {
+			continue
+		}
+		sum += min(1.0, max(0.0, e.Listened/e.Duration))
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+func listeningTime(events []*models.PlayEvent, bucket func(t time.Time) time.Time) []ListeningTime {
+	totals := make(map[time.Time]float64)
+	for _, e := range events {
+		totals[bucket(e.StartedAt)] += max(0.0, e.Listened)
+	}
+
+	res := make([]ListeningTime, 0, len(totals))
+	for start, seconds := range totals {
+		res = append(res, ListeningTime{Start: start, Seconds: seconds})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Start.Before(res[j].Start)
+	})
+	return res
+}
+
+func dayStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// weekStart returns the Monday that starts t's week.
+func weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return dayStart(t).AddDate(0, 0, -offset)
+}
+
+func stickySongs(edges map[int64]map[int64]float64, titles map[int64]string, top int) []StickySong {
+	res := make([]StickySong, 0)
+	for songID := range edges {
+		score, cycle := bestCycle(edges, songID)
+		if score <= 0 {
+			continue
+		}
+		res = append(res, StickySong{SongID: songID, Title: titles[songID], Score: score, Cycle: cycle})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].SongID < res[j].SongID
+	})
+	return limit(res, top)
+}
+
+// bestCycle searches the cycles through start of up to maxCycle edges and
+// returns the one whose weakest edge is the strongest.
+func bestCycle(edges map[int64]map[int64]float64, start int64) (float64, []int64) {
+	var best float64
+	var bestPath []int64
+
+	var walk func(node int64, path []int64, weakest float64)
+	walk = func(node int64, path []int64, weakest float64) {
+		for next, weight := range edges[node] {
+			if weight <= 0 {
+				continue
+			}
+			w := min(weakest, weight)
+			if next == start {
+				if w > best {
+					best = w
+					bestPath = append(append([]int64{}, path...), start)
+				}
+				continue
+			}
+			if len(path) >= maxCycle || contains(path, next) {
+				continue
+			}
+			walk(next, append(path, next), w)
+		}
+	}
+	walk(start, []int64{start}, math.Inf(1))
+	return best, bestPath
+}
+
+func contains(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// neverSelected lists the songs no edge of the graphs leads to and that were
+// not played in the period. The graphs remember plays from before the period,
+// so a song is only listed when it was never picked at all.
+func neverSelected(events []*models.PlayEvent, edges map[int64]map[int64]float64, songs []*models.Song) []SongRef {
+	played := make(map[int64]bool, len(events))
+	for _, e := range events {
+		played[e.SongID] = true
+	}
+	for _, neighbors := range edges {
+		for toID, weight := range neighbors {
+			if weight > 0 {
+				played[toID] = true
+			}
+		}
+	}
+
+	res := make([]SongRef, 0)
+	for _, song := range songs {
+		if !played[song.ID] {
+			res = append(res, SongRef{SongID: song.ID, Title: song.Title})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].SongID < res[j].SongID
+	})
+	return res
+}
+
+func limit[T any](items []T, n int) []T {
+	if len(items) > n {
+		return items[:n]
+	}
+	return items
+}
@@ -0,0 +1,580 @@
+package storage
+
+import (
+	"GO_player/internal/logger"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+const (
+	defaultBackupInterval    = 20 * time.Minute
+	defaultBackupGenerations = 5
+	defaultBackupRetention   = 7 * 24 * time.Hour
+	defaultFullBackupEvery   = 6
+)
+
+type BackupKind string
+
+const (
+	BackupFull        BackupKind = "full"
+	BackupIncremental BackupKind = "incremental"
+)
+
+type BackupStatus struct {
+	LastAttempt time.Time
+	LastSuccess time.Time
+	LastError   error
+	Path        string
+	Kind        BackupKind
+	Size        int64
+	Version     uint64
+	Generations int
+	Verified    bool
+}
+
+// BackupGeneration is one file of a backup chain. A chain starts with a full
+// generation and continues with the incrementals taken after it.
+type BackupGeneration struct {
+	ID        int64      `json:"id"`
+	File      string     `json:"file"`
+	Kind      BackupKind `json:"kind"`
+	Since     uint64     `json:"since"`
+	Version   uint64     `json:"version"`
+	CreatedAt time.Time  `json:"created_at"`
+	Size      int64      `json:"size"`
+	KeyID     string     `json:"key_id,omitempty"`
+}
+
+type BackupManifest struct {
+	Generations []BackupGeneration `json:"generations"`
+}
+
+type backupRunner struct {
+	badger      *badger.DB
+	backupPath  string
+	interval    time.Duration
+	generations int
+	retention   time.Duration
+	fullEvery   int
+	verify      bool
+	key         []byte
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+	mu          sync.Mutex
+	state       runState
+	runMu       sync.Mutex
+	statusMu    sync.RWMutex
+	last        BackupStatus
+}
+
+func (b *backupRunner) start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == stateShutDown {
+		return
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	b.wg.Add(1)
+	go b.runBackupLoop()
+}
+
+func (b *backupRunner) stop() {
+	if b.cancel != nil {
+		b.cancel()
+	}
+	b.wg.Wait()
+}
+
+func (b *backupRunner) Shutdown() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == stateShutDown {
+		return
+	}
+	b.stop()
+	b.state = stateShutDown
+}
+
+func (b *backupRunner) runBackupLoop() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := b.run(); err != nil {
+				logger.Error("storage", "backup failed", err)
+			}
+		}
+	}
+}
+
+func (b *backupRunner) status() BackupStatus {
+	b.statusMu.RLock()
+	defer b.statusMu.RUnlock()
+	return b.last
+}
+
+func (b *backupRunner) run() error {
+	b.runMu.Lock()
+	defer b.runMu.Unlock()
+
+	startedAt := time.Now()
+	manifest, err := readManifest(b.backupPath)
+	if err != nil {
+		b.recordFailure(startedAt, err)
+		return err
+	}
+
+	kind, since := nextBackupKind(manifest, b.fullEvery, b.badger.MaxVersion(), keyID(b.key))
+	gen, err := b.doBackup(startedAt, kind, since)
+	if err != nil {
+		b.recordFailure(startedAt, err)
+		return err
+	}
+	manifest.Generations = append(manifest.Generations, gen)
+
+	verified := false
+	if b.verify {
+		if err := verifyChain(b.backupPath, manifest, gen.ID, b.key); err != nil {
+			_ = os.Remove(filepath.Join(filepath.Dir(b.backupPath), gen.File))
+			b.recordFailure(startedAt, err)
+			return err
+		}
+		verified = true
+	}
+
+	// The manifest goes to disk before any file is deleted, so that it never
+	// lists a generation that is gone.
+	manifest, pruned := b.prune(manifest, startedAt)
+	if err := writeManifest(b.backupPath, manifest); err != nil {
+		_ = os.Remove(filepath.Join(filepath.Dir(b.backupPath), gen.File))
+		b.recordFailure(startedAt, err)
+		return err
+	}
+	pruneErr := b.removeGenerations(pruned)
+
+	b.statusMu.Lock()
+	defer b.statusMu.Unlock()
+	b.last = BackupStatus{
+		LastAttempt: startedAt,
+		LastSuccess: startedAt,
+		LastError:   pruneErr,
+		Path:        filepath.Join(filepath.Dir(b.backupPath), gen.File),
+		Kind:        gen.Kind,
+		Size:        gen.Size,
+		Version:     gen.Version,
+		Generations: len(manifest.Generations),
+		Verified:    verified,
+	}
+	return pruneErr
+}
+
+func (b *backupRunner) recordFailure(at time.Time, err error) {
+	b.statusMu.Lock()
+	defer b.statusMu.Unlock()
+	b.last.LastAttempt = at
+	b.last.LastError = err
+}
+
+// nextBackupKind starts a new chain when there is none, the current one already
+// holds fullEvery generations, the database was restored to a point before the
+// chain's last version or the encryption key changed. Otherwise it continues
+// the chain with everything newer than the last dumped version.
+func nextBackupKind(manifest *BackupManifest, fullEvery int, dbVersion uint64, currentKeyID string) (BackupKind, uint64) {
+	if len(manifest.Generations) == 0 {
+		return BackupFull, 0
+	}
+	last := manifest.Generations[len(manifest.Generations)-1]
+	chain := chainEndingAt(manifest, len(manifest.Generations)-1)
+	if len(chain) == 0 || len(chain) >= fullEvery || last.Version > dbVersion || last.KeyID != currentKeyID {
+		return BackupFull, 0
+	}
+	return BackupIncremental, last.Version
+}
+
+// doBackup writes a dump to a temp file next to the backup path and renames it
+// into a new generation only after it is completely on disk.
+func (b *backupRunner) doBackup(ts time.Time, kind BackupKind, since uint64) (gen BackupGeneration, err error) {
+	dir := filepath.Dir(b.backupPath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return BackupGeneration{}, err
+	}
+
+	f, err := os.CreateTemp(dir, filepath.Base(b.backupPath)+".tmp-*")
+	if err != nil {
+		return BackupGeneration{}, err
+	}
+	tmpPath := f.Name()
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	version, err := b.writeDump(f, since)
+	if err != nil {
+		_ = f.Close()
+		return BackupGeneration{}, err
+	}
+	if version < since {
+		version = since
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return BackupGeneration{}, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return BackupGeneration{}, err
+	}
+	if err = f.Close(); err != nil {
+		return BackupGeneration{}, err
+	}
+
+	path := generationPath(b.backupPath, ts)
+	if err = os.Rename(tmpPath, path); err != nil {
+		return BackupGeneration{}, err
+	}
+	syncDir(dir)
+
+	return BackupGeneration{
+		ID:        ts.UnixNano(),
+		File:      filepath.Base(path),
+		Kind:      kind,
+		Since:     since,
+		Version:   version,
+		CreatedAt: ts,
+		Size:      info.Size(),
+		KeyID:     keyID(b.key),
+	}, nil
+}
+
+func (b *backupRunner) writeDump(w io.Writer, since uint64) (uint64, error) {
+	if len(b.key) == 0 {
+		return b.badger.Backup(w, since)
+	}
+
+	ew, err := newEncryptingWriter(w, b.key)
+	if err != nil {
+		return 0, err
+	}
+	version, err := b.badger.Backup(ew, since)
+	if err != nil {
+		return 0, err
+	}
+	return version, ew.Close()
+}
+
+// prune drops whole chains so that an incremental is never left without the
+// full generation it builds on. The newest chain is always kept. It returns
+// the manifest of what is kept and the generations dropped, whose files are
+// left for removeGenerations.
+func (b *backupRunner) prune(manifest *BackupManifest, now time.Time) (*BackupManifest, []BackupGeneration) {
+	chains := splitChains(manifest)
+
+	kept := &BackupManifest{}
+	var dropped []BackupGeneration
+	for i, chain := range chains {
+		newest := i == len(chains)-1
+		expired := now.Sub(chain[len(chain)-1].CreatedAt) > b.retention
+		if newest || (i >= len(chains)-b.generations && !expired) {
+			kept.Generations = append(kept.Generations, chain...)
+			continue
+		}
+		dropped = append(dropped, chain...)
+	}
+	return kept, dropped
+}
+
+func (b *backupRunner) removeGenerations(gens []BackupGeneration) error {
+	dir := filepath.Dir(b.backupPath)
+	var firstErr error
+	for _, gen := range gens {
+		if err := os.Remove(filepath.Join(dir, gen.File)); err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func generationPath(backupPath string, ts time.Time) string {
+	return fmt.Sprintf("%s.%020d", backupPath, ts.UnixNano())
+}
+
+func manifestPath(backupPath string) string {
+	return backupPath + ".manifest"
+}
+
+// readManifest loads the chain description. Generations written before the
+// manifest existed are picked up from disk as full backups.
+func readManifest(backupPath string) (*BackupManifest, error) {
+	data, err := os.ReadFile(manifestPath(backupPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return scanGenerations(backupPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("read backup manifest: %w", err)
+	}
+	sort.Slice(manifest.Generations, func(i, j int) bool {
+		return manifest.Generations[i].ID < manifest.Generations[j].ID
+	})
+	return &manifest, nil
+}
+
+func writeManifest(backupPath string, manifest *BackupManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := manifestPath(backupPath)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+func scanGenerations(backupPath string) (*BackupManifest, error) {
+	matches, err := filepath.Glob(backupPath + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &BackupManifest{}
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(match, backupPath+".")
+		if len(suffix) != 20 {
+			continue
+		}
+		nanos, err := strconv.ParseInt(suffix, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(match)
+		if err != nil {
+			continue
+		}
+		manifest.Generations = append(manifest.Generations, BackupGeneration{
+			ID:        nanos,
+			File:      filepath.Base(match),
+			Kind:      BackupFull,
+			CreatedAt: time.Unix(0, nanos),
+			Size:      info.Size(),
+		})
+	}
+
+	sort.Slice(manifest.Generations, func(i, j int) bool {
+		return manifest.Generations[i].ID < manifest.Generations[j].ID
+	})
+	return manifest, nil
+}
+
+func splitChains(manifest *BackupManifest) [][]BackupGeneration {
+	var chains [][]BackupGeneration
+	for _, gen := range manifest.Generations {
+		if gen.Kind == BackupFull || len(chains) == 0 {
+			chains = append(chains, []BackupGeneration{gen})
+			continue
+		}
+		chains[len(chains)-1] = append(chains[len(chains)-1], gen)
+	}
+	return chains
+}
+
+// chainEndingAt returns the full generation preceding index idx and every
+// incremental up to and including idx, or nil if there is no full to start from.
+func chainEndingAt(manifest *BackupManifest, idx int) []BackupGeneration {
+	start := -1
+	for i := idx; i >= 0; i-- {
+		if manifest.Generations[i].Kind == BackupFull {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+	return manifest.Generations[start : idx+1]
+}
+
+func findChain(manifest *BackupManifest, generationID int64) ([]BackupGeneration, error) {
+	for i, gen := range manifest.Generations {
+		if gen.ID != generationID {
+			continue
+		}
+		chain := chainEndingAt(manifest, i)
+		if chain == nil {
+			return nil, fmt.Errorf("backup generation %d has no full backup", generationID)
+		}
+		return chain, nil
+	}
+	return nil, fmt.Errorf("backup generation %d not found", generationID)
+}
+
+func verifyChain(backupPath string, manifest *BackupManifest, generationID int64, key []byte) error {
+	chain, err := findChain(manifest, generationID)
+	if err != nil {
+		return err
+	}
+
+	opts := badger.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := loadChain(db, filepath.Dir(backupPath), chain, key); err != nil {
+		return fmt.Errorf("verify backup: %w", err)
+	}
+	return nil
+}
+
+func loadChain(db *badger.DB, dir string, chain []BackupGeneration, key []byte) error {
+	for _, gen := range chain {
+		if err := loadFile(db, filepath.Join(dir, gen.File), gen.KeyID, key); err != nil {
+			return fmt.Errorf("load %s: %w", gen.File, err)
+		}
+	}
+	return nil
+}
+
+func loadFile(db *badger.DB, path, genKeyID string, key []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if genKeyID == "" {
+		return db.Load(f, 16)
+	}
+	if genKeyID != keyID(key) {
+		return fmt.Errorf("backup is encrypted with key %s", genKeyID)
+	}
+	r, err := newDecryptingReader(f, key)
+	if err != nil {
+		return err
+	}
+	return db.Load(r, 16)
+}
+
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
+
+func ListBackups(backupPath string) ([]BackupGeneration, error) {
+	manifest, err := readManifest(backupPath)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.Generations, nil
+}
+
+// RestoreBackup rebuilds the database at path as it was when the given
+// generation was taken, replaying its full backup and the incrementals up to it.
+// The database must not be open; key encrypts the restored store and decrypts
+// encrypted generations.
+func RestoreBackup(path, backupPath string, generationID int64, key []byte) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	manifest, err := readManifest(backupPath)
+	if err != nil {
+		return err
+	}
+	chain, err := findChain(manifest, generationID)
+	if err != nil {
+		return err
+	}
+	return restoreChain(path, filepath.Dir(backupPath), chain, key)
+}
+
+// restoreFromBackup restores the newest generation, stepping back through
+// older ones and finally a legacy single-file backup at backupPath.
+func restoreFromBackup(path, backupPath string, key []byte) error {
+	manifest, err := readManifest(backupPath)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(backupPath)
+	var lastErr error
+	for i := len(manifest.Generations) - 1; i >= 0; i-- {
+		chain := chainEndingAt(manifest, i)
+		if chain == nil {
+			continue
+		}
+		if lastErr = restoreChain(path, dir, chain, key); lastErr == nil {
+			return nil
+		}
+		logger.Error("storage", "restore of generation "+manifest.Generations[i].File+" failed", lastErr)
+	}
+
+	if info, err := os.Stat(backupPath); err == nil && !info.IsDir() {
+		legacy := []BackupGeneration{{File: filepath.Base(backupPath), Kind: BackupFull}}
+		if lastErr = restoreChain(path, dir, legacy, key); lastErr == nil {
+			return nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no backups found for %s", backupPath)
+	}
+	return lastErr
+}
+
+func restoreChain(path, dir string, chain []BackupGeneration, key []byte) error {
+	for _, gen := range chain {
+		if gen.KeyID != "" && gen.KeyID != keyID(key) {
+			return fmt.Errorf("backup %s is encrypted with key %s", gen.File, gen.KeyID)
+		}
+	}
+
+	if err := os.RemoveAll(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return err
+	}
+
+	db, err := badger.Open(badgerOptions(path, key))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return loadChain(db, dir, chain, key)
+}
@@ -0,0 +1,322 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+const (
+	keyDerivationIterations = 600000
+	saltSize                = 16
+	encryptedChunkSize      = 64 << 10
+	encryptionIndexCache    = 100 << 20
+)
+
+var encryptedBackupMagic = []byte("GOPLAYER-ENC1")
+
+var ErrInvalidKey = errors.New("encryption key must be 16, 24 or 32 bytes")
+
+func validateKey(key []byte) error {
+	switch len(key) {
+	case 0, 16, 24, 32:
+		return nil
+	default:
+		return ErrInvalidKey
+	}
+}
+
+// KeyFromPassphrase derives a 32 byte key from passphrase. The salt lives next
+// to the database in path+".salt" and is created on first use.
+func KeyFromPassphrase(path, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("empty passphrase")
+	}
+
+	saltPath := path + ".salt"
+	salt, err := os.ReadFile(saltPath)
+	if errors.Is(err, os.ErrNotExist) {
+		salt = make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(saltPath, salt, 0o600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if len(salt) != saltSize {
+		return nil, fmt.Errorf("salt file %s is corrupted", saltPath)
+	}
+
+	return pbkdf2.Key(sha256.New, passphrase, salt, keyDerivationIterations, 32)
+}
+
+// LoadKeyFile reads a key stored either as raw bytes or as hex text.
+func LoadKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if decoded, err := hex.DecodeString(strings.TrimSpace(string(data))); err == nil {
+		data = decoded
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("key file %s is empty", path)
+	}
+	if err := validateKey(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func keyID(key []byte) string {
+	if len(key) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+func badgerOptions(path string, key []byte) badger.Options {
+	opts := badger.DefaultOptions(path)
+	if len(key) > 0 {
+		opts = opts.WithEncryptionKey(key).WithIndexCacheSize(encryptionIndexCache)
+	}
+	return opts
+}
+
+// RotateEncryptionKey re-encrypts the closed database at path from oldKey to
+// newKey by streaming it into a fresh store. Either key may be empty to move
+// from or to an unencrypted database.
+func RotateEncryptionKey(path string, oldKey, newKey []byte) error {
+	if err := validateKey(oldKey); err != nil {
+		return err
+	}
+	if err := validateKey(newKey); err != nil {
+		return err
+	}
+
+	oldDB, err := badger.Open(badgerOptions(path, oldKey))
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".rotate"
+	if err := os.RemoveAll(tmpPath); err != nil {
+		_ = oldDB.Close()
+		return err
+	}
+	newDB, err := badger.Open(badgerOptions(tmpPath, newKey))
+	if err != nil {
+		_ = oldDB.Close()
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := oldDB.Backup(pw, 0)
+		_ = pw.CloseWithError(err)
+	}()
+	loadErr := newDB.Load(pr, 16)
+	_ = pr.CloseWithError(loadErr)
+
+	closeOldErr := oldDB.Close()
+	closeNewErr := newDB.Close()
+	if err := errors.Join(loadErr, closeOldErr, closeNewErr); err != nil {
+		_ = os.RemoveAll(tmpPath)
+		return err
+	}
+
+	oldPath := path + ".old"
+	if err := os.RemoveAll(oldPath); err != nil {
+		return err
+	}
+	if err := os.Rename(path, oldPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Rename(oldPath, path)
+		return err
+	}
+	return os.RemoveAll(oldPath)
+}
+
+// encryptingWriter seals the stream in AES-GCM chunks. Every chunk carries
+// its index and a final flag as additional data so that reordering or
+// truncating the file is detected on read.
+type encryptingWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	buf     []byte
+	counter uint64
+}
+
+func newEncryptingWriter(w io.Writer, key []byte) (*encryptingWriter, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, aead.NonceSize()-8)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(encryptedBackupMagic); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(prefix); err != nil {
+		return nil, err
+	}
+
+	return &encryptingWriter{w: w, aead: aead, prefix: prefix, buf: make([]byte, 0, encryptedChunkSize)}, nil
+}
+
+func (e *encryptingWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), encryptedChunkSize-len(e.buf))
+		e.buf = append(e.buf, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(e.buf) == encryptedChunkSize {
+			if err := e.flush(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (e *encryptingWriter) Close() error {
+	return e.flush(true)
+}
+
+func (e *encryptingWriter) flush(final bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.prefix, e.counter), e.buf, chunkAD(e.counter, final))
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(sealed)))
+	if _, err := e.w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+	e.counter++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+type decryptingReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	buf     []byte
+	counter uint64
+	done    bool
+}
+
+func newDecryptingReader(r io.Reader, key []byte) (*decryptingReader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, len(encryptedBackupMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(magic, encryptedBackupMagic) {
+		return nil, errors.New("backup is not encrypted")
+	}
+	prefix := make([]byte, aead.NonceSize()-8)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, err
+	}
+
+	return &decryptingReader{r: r, aead: aead, prefix: prefix}, nil
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptingReader) next() error {
+	var header [4]byte
+	if _, err := io.ReadFull(d.r, header[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > uint32(encryptedChunkSize+d.aead.Overhead()) {
+		return errors.New("backup decryption failed: corrupted chunk length")
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return err
+	}
+
+	nonce := chunkNonce(d.prefix, d.counter)
+	plain, err := d.aead.Open(nil, nonce, sealed, chunkAD(d.counter, false))
+	if err != nil {
+		plain, err = d.aead.Open(nil, nonce, sealed, chunkAD(d.counter, true))
+		if err != nil {
+			return errors.New("backup decryption failed: wrong key or corrupted file")
+		}
+		d.done = true
+	}
+	d.counter++
+	d.buf = plain
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, counter uint64) []byte {
+	nonce := make([]byte, len(prefix)+8)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint64(nonce[len(prefix):], counter)
+	return nonce
+}
+
+func chunkAD(counter uint64, final bool) []byte {
+	ad := make([]byte, 9)
+	binary.BigEndian.PutUint64(ad, counter)
+	if final {
+		ad[8] = 1
+	}
+	return ad
+}
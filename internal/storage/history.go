@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Play events are keyed by start time so that a prefix scan returns them in
+// order. The per-song index maps a song to the keys of its events.
+const (
+	historyPrefix     = "history/"
+	historySongPrefix = "history-song/"
+)
+
+var errStopScan = errors.New("stop scan")
+
+func historyKey(ns string, at, songID int64) string {
+	return fmt.Sprintf("%s%s%020d/%020d", ns, historyPrefix, at, songID)
+}
+
+func historySongKey(ns string, songID, at int64) string {
+	return fmt.Sprintf("%s%s%020d/%020d", ns, historySongPrefix, songID, at)
+}
+
+// keyNumber returns the number that follows prefix in an event or index key:
+// the timestamp of an event, the song of an index entry.
+func keyNumber(key, prefix string) (int64, bool) {
+	rest := strings.TrimPrefix(key, prefix)
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		rest = rest[:i]
+	}
+	at, err := strconv.ParseInt(rest, 10, 64)
+	return at, err == nil
+}
+
+func (w writer) AppendPlayEvent(at, songID int64, data []byte) error {
+	if at < 0 {
+		return fmt.Errorf("invalid play event time %d", at)
+	}
+	key := historyKey(w.ns, at, songID)
+	if err := w.w.set(key, data); err != nil {
+		return err
+	}
+	return w.w.set(historySongKey(w.ns, songID, at), []byte(key))
+}
+
+func (t txn) ListPlayEvents(from, to int64) ([][]byte, error) {
+	prefix := t.ns + historyPrefix
+	var res [][]byte
+	err := t.kv.scanFrom(prefix, historyKey(t.ns, max(from, 0), 0), func(key string, val []byte) error {
+		at, ok := keyNumber(key, prefix)
+		if !ok || at < from {
+			return nil
+		}
+		if at >= to {
+			return errStopScan
+		}
+		res = append(res, val)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopScan) {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (t txn) ListSongPlayEvents(songID, from, to int64) ([][]byte, error) {
+	prefix := fmt.Sprintf("%s%s%020d/", t.ns, historySongPrefix, songID)
+	var keys []string
+	err := t.kv.scanFrom(prefix, historySongKey(t.ns, songID, max(from, 0)), func(key string, val []byte) error {
+		at, ok := keyNumber(key, prefix)
+		if !ok || at < from {
+			return nil
+		}
+		if at >= to {
+			return errStopScan
+		}
+		keys = append(keys, string(val))
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopScan) {
+		return nil, err
+	}
+
+	var res [][]byte
+	for _, key := range keys {
+		val, err := t.kv.get(key)
+		if err != nil {
+			return nil, err
+		}
+		if val != nil {
+			res = append(res, val)
+		}
+	}
+	return res, nil
+}
+
+// ListRecentPlayEvents returns, in order, the last n events together with
+// every earlier one started at or after from.
+func (t txn) ListRecentPlayEvents(n int, from int64) ([][]byte, error) {
+	prefix := t.ns + historyPrefix
+	var res [][]byte
+	err := t.kv.scanReverse(prefix, func(key string, val []byte) error {
+		if len(res) >= n {
+			if at, ok := keyNumber(key, prefix); !ok || at < from {
+				return errStopScan
+			}
+		}
+		res = append(res, val)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopScan) {
+		return nil, err
+	}
+	slices.Reverse(res)
+	return res, nil
+}
+
+// CountPlayEvents returns how many times each song was played. It reads only
+// the keys of the per-song index.
+func (t txn) CountPlayEvents() (map[int64]int, error) {
+	prefix := t.ns + historySongPrefix
+	counts := make(map[int64]int)
+	err := t.kv.scanKeys(prefix, func(key string) error {
+		if songID, ok := keyNumber(key, prefix); ok {
+			counts[songID]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func (e entities) AppendPlayEvent(at, songID int64, data []byte) error {
+	return e.Update(func(tx Tx) error {
+		return tx.AppendPlayEvent(at, songID, data)
+	})
+}
+
+func (e entities) ListPlayEvents(from, to int64) ([][]byte, error) {
+	return viewResult(e, func(tx Tx) ([][]byte, error) {
+		return tx.ListPlayEvents(from, to)
+	})
+}
+
+func (e entities) ListSongPlayEvents(songID, from, to int64) ([][]byte, error) {
+	return viewResult(e, func(tx Tx) ([][]byte, error) {
+		return tx.ListSongPlayEvents(songID, from, to)
+	})
+}
+
+func (e entities) ListRecentPlayEvents(n int, from int64) ([][]byte, error) {
+	return viewResult(e, func(tx Tx) ([][]byte, error) {
+		return tx.ListRecentPlayEvents(n, from)
+	})
+}
+
+func (e entities) CountPlayEvents() (map[int64]int, error) {
+	return viewResult(e, func(tx Tx) (map[int64]int, error) {
+		return tx.CountPlayEvents()
+	})
+}
@@ -0,0 +1,291 @@
+package storage
+
+import (
+	"GO_player/internal/logger"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrReadOnlyTx = errors.New("write in a read-only transaction")
+
+// jsonFlushDelay is how long the JSON file backend gathers updates before it
+// rewrites the file.
+const jsonFlushDelay = time.Second
+
+// MemoryDB keeps every key in a map. With a path set it becomes the JSON file
+// backend. That rewrites the whole file, so updates are gathered for
+// jsonFlushDelay and written together; Shutdown writes what is left. It suits
+// small stores; an update made just before a crash can be lost.
+type MemoryDB struct {
+	entities
+	mu      sync.RWMutex
+	data    map[string][]byte
+	path    string
+	flushMu sync.Mutex
+	dirty   bool
+	timer   *time.Timer
+	err     error
+}
+
+func NewMemoryDB() *MemoryDB {
+	db := &MemoryDB{data: make(map[string][]byte)}
+	db.entities = entities{engine: memoryEngine{db: db}}
+	return db
+}
+
+func NewJSONFileDB(path string) (*MemoryDB, error) {
+	db := NewMemoryDB()
+
+	raw, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &db.data); err != nil {
+			return nil, err
+		}
+	}
+
+	db.path = path
+	return db, nil
+}
+
+// Shutdown writes out the updates the JSON file backend still holds and
+// returns the last error writing the file.
+func (db *MemoryDB) Shutdown() error {
+	if db.path == "" {
+		return nil
+	}
+	db.mu.Lock()
+	if db.timer != nil {
+		db.timer.Stop()
+		db.timer = nil
+	}
+	db.mu.Unlock()
+
+	db.flush()
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.err
+}
+
+// markDirty schedules a write of the file; the caller holds db.mu.
+func (db *MemoryDB) markDirty() {
+	db.dirty = true
+	if db.timer == nil {
+		db.timer = time.AfterFunc(jsonFlushDelay, db.flush)
+	}
+}
+
+// flush writes the file when there are updates it does not have yet. A
+// failed write is retried with the next update.
+func (db *MemoryDB) flush() {
+	db.flushMu.Lock()
+	defer db.flushMu.Unlock()
+
+	db.mu.Lock()
+	db.timer = nil
+	if !db.dirty {
+		db.mu.Unlock()
+		return
+	}
+	raw, err := json.Marshal(db.data)
+	db.dirty = false
+	db.mu.Unlock()
+
+	if err == nil {
+		err = writeJSONFile(db.path, raw)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.err = err
+	if err != nil {
+		logger.Error("storage", "writing json store failed", err)
+		db.dirty = true
+	}
+}
+
+func writeJSONFile(path string, raw []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	if _, err := f.Write(raw); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+type memoryEngine struct {
+	db *MemoryDB
+}
+
+func (e memoryEngine) update(fn func(kv kv) error) error {
+	e.db.mu.Lock()
+	defer e.db.mu.Unlock()
+
+	tx := newMemoryKV(e.db.data, false)
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	tx.apply(e.db.data)
+	if e.db.path != "" {
+		e.db.markDirty()
+	}
+	return nil
+}
+
+func (e memoryEngine) batch(fn func(w kvWriter) error) error {
+	return e.update(func(kv kv) error {
+		return fn(kv)
+	})
+}
+
+func (e memoryEngine) view(fn func(kv kv) error) error {
+	e.db.mu.RLock()
+	defer e.db.mu.RUnlock()
+	return fn(newMemoryKV(e.db.data, true))
+}
+
+// memoryKV stages writes on top of the committed map so that a failed update
+// leaves nothing behind.
+type memoryKV struct {
+	base     map[string][]byte
+	writes   map[string][]byte
+	deleted  map[string]bool
+	readOnly bool
+}
+
+func newMemoryKV(base map[string][]byte, readOnly bool) *memoryKV {
+	return &memoryKV{
+		base:     base,
+		writes:   make(map[string][]byte),
+		deleted:  make(map[string]bool),
+		readOnly: readOnly,
+	}
+}
+
+func (m *memoryKV) get(key string) ([]byte, error) {
+	if m.deleted[key] {
+		return nil, nil
+	}
+	if val, ok := m.writes[key]; ok {
+		return copyBytes(val), nil
+	}
+	if val, ok := m.base[key]; ok {
+		return copyBytes(val), nil
+	}
+	return nil, nil
+}
+
+func (m *memoryKV) set(key string, data []byte) error {
+	if m.readOnly {
+		return ErrReadOnlyTx
+	}
+	m.writes[key] = copyBytes(data)
+	delete(m.deleted, key)
+	return nil
+}
+
+func (m *memoryKV) delete(key string) error {
+	if m.readOnly {
+		return ErrReadOnlyTx
+	}
+	delete(m.writes, key)
+	m.deleted[key] = true
+	return nil
+}
+
+func (m *memoryKV) scan(prefix string, fn func(key string, val []byte) error) error {
+	return m.scanFrom(prefix, prefix, fn)
+}
+
+func (m *memoryKV) scanFrom(prefix, start string, fn func(key string, val []byte) error) error {
+	for _, key := range m.keys(prefix, start) {
+		val, _ := m.get(key)
+		if err := fn(key, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryKV) scanReverse(prefix string, fn func(key string, val []byte) error) error {
+	keys := m.keys(prefix, prefix)
+	for i := len(keys) - 1; i >= 0; i-- {
+		val, _ := m.get(keys[i])
+		if err := fn(keys[i], val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryKV) scanKeys(prefix string, fn func(key string) error) error {
+	for _, key := range m.keys(prefix, prefix) {
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keys returns the sorted keys with the given prefix that are not below start.
+func (m *memoryKV) keys(prefix, start string) []string {
+	keys := make([]string, 0)
+	for key := range m.base {
+		if strings.HasPrefix(key, prefix) && key >= start && !m.deleted[key] {
+			if _, staged := m.writes[key]; !staged {
+				keys = append(keys, key)
+			}
+		}
+	}
+	for key := range m.writes {
+		if strings.HasPrefix(key, prefix) && key >= start {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *memoryKV) apply(dst map[string][]byte) {
+	for key := range m.deleted {
+		delete(dst, key)
+	}
+	for key, val := range m.writes {
+		dst[key] = val
+	}
+}
+
+func copyBytes(src []byte) []byte {
+	if src == nil {
+		return nil
+	}
+	dst := make([]byte, len(src))
+	copy(dst, src)
+	return dst
+}
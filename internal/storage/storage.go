@@ -1,32 +1,26 @@
 package storage
 
 import (
-	"context"
 	"errors"
-	"fmt"
-	"os"
-	"sync"
 	"time"
 
 	"github.com/dgraph-io/badger/v3"
 )
 
-const defaultBackupInterval = 20 * time.Minute
-
 type DB struct {
+	entities
 	badger *badger.DB
 	backup *backupRunner
 }
 
-type backupRunner struct {
-	badger     *badger.DB
-	backupPath string
-	interval   time.Duration
-	ctx        context.Context
-	cancel     context.CancelFunc
-	wg         sync.WaitGroup
-	mu         sync.Mutex
-	state      runState
+type Options struct {
+	BackupPath        string
+	BackupInterval    time.Duration
+	BackupGenerations int
+	BackupRetention   time.Duration
+	FullBackupEvery   int
+	VerifyBackups     bool
+	EncryptionKey     []byte
 }
 
 type runState int
@@ -37,17 +31,41 @@ const (
 )
 
 func NewDB(path string, backupPath string, backupInterval time.Duration) (*DB, error) {
-	if backupPath == "" {
-		backupPath = path + ".backup"
+	return NewDBWithOptions(path, Options{
+		BackupPath:     backupPath,
+		BackupInterval: backupInterval,
+		VerifyBackups:  true,
+	})
+}
+
+func NewDBWithOptions(path string, options Options) (*DB, error) {
+	if options.BackupPath == "" {
+		options.BackupPath = path + ".backup"
+	}
+	if options.BackupInterval <= 0 {
+		options.BackupInterval = defaultBackupInterval
 	}
-	if backupInterval <= 0 {
-		backupInterval = defaultBackupInterval
+	if options.BackupGenerations <= 0 {
+		options.BackupGenerations = defaultBackupGenerations
+	}
+	if options.BackupRetention <= 0 {
+		options.BackupRetention = defaultBackupRetention
+	}
+	if options.FullBackupEvery <= 0 {
+		options.FullBackupEvery = defaultFullBackupEvery
 	}
 
-	opts := badger.DefaultOptions(path)
+	if err := validateKey(options.EncryptionKey); err != nil {
+		return nil, err
+	}
+
+	opts := badgerOptions(path, options.EncryptionKey)
 	badgerDB, err := badger.Open(opts)
+	if errors.Is(err, badger.ErrEncryptionKeyMismatch) {
+		return nil, err
+	}
 	if err != nil {
-		if restoreErr := restoreFromBackup(path, backupPath); restoreErr != nil {
+		if restoreErr := restoreFromBackup(path, options.BackupPath, options.EncryptionKey); restoreErr != nil {
 			return nil, err
 		}
 		badgerDB, err = badger.Open(opts)
@@ -57,13 +75,20 @@ func NewDB(path string, backupPath string, backupInterval time.Duration) (*DB, e
 	}
 
 	runner := &backupRunner{
-		badger:     badgerDB,
-		backupPath: backupPath,
-		interval:   backupInterval,
+		badger:      badgerDB,
+		backupPath:  options.BackupPath,
+		interval:    options.BackupInterval,
+		generations: options.BackupGenerations,
+		retention:   options.BackupRetention,
+		fullEvery:   options.FullBackupEvery,
+		verify:      options.VerifyBackups,
+		key:         options.EncryptionKey,
 	}
 	runner.start()
 
-	return &DB{badger: badgerDB, backup: runner}, nil
+	db := &DB{badger: badgerDB, backup: runner}
+	db.entities = entities{engine: badgerEngine{db: db}}
+	return db, nil
 }
 
 func (db *DB) Close() error {
@@ -77,306 +102,149 @@ func (db *DB) Shutdown() error {
 	return db.badger.Close()
 }
 
-func (b *backupRunner) start() {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	if b.state == stateShutDown {
-		return
+func (db *DB) BackupNow() error {
+	if db.backup == nil {
+		return errors.New("backups are disabled")
 	}
-	b.ctx, b.cancel = context.WithCancel(context.Background())
-	b.wg.Add(1)
-	go b.runBackupLoop()
+	return db.backup.run()
 }
 
-func (b *backupRunner) stop() {
-	if b.cancel != nil {
-		b.cancel()
+func (db *DB) Backups() ([]BackupGeneration, error) {
+	if db.backup == nil {
+		return nil, errors.New("backups are disabled")
 	}
-	b.wg.Wait()
+	return ListBackups(db.backup.backupPath)
 }
 
-func (b *backupRunner) Shutdown() {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	if b.state == stateShutDown {
-		return
+func (db *DB) BackupStatus() BackupStatus {
+	if db.backup == nil {
+		return BackupStatus{}
 	}
-	b.stop()
-	b.state = stateShutDown
+	return db.backup.status()
 }
 
-func (b *backupRunner) runBackupLoop() {
-	defer b.wg.Done()
-	ticker := time.NewTicker(b.interval)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-b.ctx.Done():
-			return
-		case <-ticker.C:
-			_, err := b.doBackup()
-			if err != nil {
-				//TODO: handle error
-			}
-		}
-	}
+type badgerKV struct {
+	txn *badger.Txn
 }
 
-func (b *backupRunner) doBackup() (version uint64, err error) {
-	f, err := os.Create(b.backupPath)
-	if err != nil {
-		return 0, err
+func (b badgerKV) get(key string) ([]byte, error) {
+	item, err := b.txn.Get([]byte(key))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
 	}
-	defer func() {
-		if closeErr := f.Close(); closeErr != nil && err == nil {
-			err = closeErr
-		}
-	}()
-	version, err = b.badger.Backup(f, 0)
-	return version, err
-}
-
-func restoreFromBackup(path, backupPath string) error {
-	info, err := os.Stat(backupPath)
-	if err != nil {
-		return err
-	}
-	if info.IsDir() {
-		return fmt.Errorf("backup path %s is a directory", backupPath)
-	}
-
-	if err := os.RemoveAll(path); err != nil && !os.IsNotExist(err) {
-		return err
-	}
-	if err := os.MkdirAll(path, 0o755); err != nil {
-		return err
-	}
-
-	opts := badger.DefaultOptions(path)
-	db, err := badger.Open(opts)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-
-	f, err := os.Open(backupPath)
 	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	if err := db.Load(f, 16); err != nil {
-		return err
+		return nil, err
 	}
+	return item.ValueCopy(nil)
+}
 
-	return nil
+func (b badgerKV) set(key string, data []byte) error {
+	return b.txn.Set([]byte(key), data)
 }
 
-func (db *DB) SetSong(songID int64, data []byte) error {
-	key := fmt.Sprintf("song/%d", songID)
-	return db.runTxnReadWrite(func(txn *badger.Txn) error {
-		return txn.Set([]byte(key), data)
-	})
+func (b badgerKV) delete(key string) error {
+	return b.txn.Delete([]byte(key))
 }
 
-func (db *DB) GetSong(id int64) ([]byte, error) {
-	key := fmt.Sprintf("song/%d", id)
+func (b badgerKV) scan(prefix string, fn func(key string, val []byte) error) error {
+	return b.scanFrom(prefix, prefix, fn)
+}
 
-	var res []byte
-
-	err := db.runTxnReadOnly(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(key))
-		if errors.Is(err, badger.ErrKeyNotFound) {
-			return nil
-		}
-		if err != nil {
-			return err
-		}
+func (b badgerKV) scanFrom(prefix, start string, fn func(key string, val []byte) error) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = true
+	it := b.txn.NewIterator(opts)
+	defer it.Close()
 
+	p := []byte(prefix)
+	if start < prefix {
+		start = prefix
+	}
+	for it.Seek([]byte(start)); it.ValidForPrefix(p); it.Next() {
+		item := it.Item()
 		val, err := item.ValueCopy(nil)
 		if err != nil {
 			return err
 		}
-
-		res = append(res, val...)
-		return nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	return res, nil
-}
-
-func (db *DB) ListSongs() ([][]byte, error) {
-	var res [][]byte
-
-	err := db.runTxnReadOnly(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchValues = true
-		it := txn.NewIterator(opts)
-		defer it.Close()
-
-		prefix := []byte("song/")
-
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			item := it.Item()
-			val, err := item.ValueCopy(nil)
-			if err != nil {
-				return err
-			}
-			res = append(res, val)
+		if err := fn(string(item.Key()), val); err != nil {
+			return err
 		}
-		return nil
-	})
-
-	if err != nil {
-		return nil, err
 	}
-
-	return res, nil
-}
-
-func (db *DB) SetAlbum(albumID int64, data []byte) error {
-	key := fmt.Sprintf("album/%d", albumID)
-	return db.runTxnReadWrite(func(txn *badger.Txn) error {
-		return txn.Set([]byte(key), data)
-	})
+	return nil
 }
 
-func (db *DB) GetAlbum(id int64) ([]byte, error) {
-	key := fmt.Sprintf("album/%d", id)
-
-	var res []byte
+func (b badgerKV) scanReverse(prefix string, fn func(key string, val []byte) error) error {
+	opts := badger.DefaultIteratorOptions
+	opts.Reverse = true
+	it := b.txn.NewIterator(opts)
+	defer it.Close()
 
-	err := db.runTxnReadOnly(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(key))
-		if errors.Is(err, badger.ErrKeyNotFound) {
-			return nil
-		}
+	// A reverse iterator seeks to the last key not above the given one.
+	p := []byte(prefix)
+	for it.Seek(append([]byte(prefix), 0xff)); it.ValidForPrefix(p); it.Next() {
+		item := it.Item()
+		val, err := item.ValueCopy(nil)
 		if err != nil {
 			return err
 		}
-		val, err := item.ValueCopy(nil)
-		if err != nil {
+		if err := fn(string(item.Key()), val); err != nil {
 			return err
 		}
-
-		res = append(res, val...)
-		return nil
-	})
-
-	if err != nil {
-		return nil, err
 	}
-	return res, nil
+	return nil
 }
 
-func (db *DB) ListAlbums() ([][]byte, error) {
-	var res [][]byte
-
-	err := db.runTxnReadOnly(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchValues = true
-		it := txn.NewIterator(opts)
-		defer it.Close()
+func (b badgerKV) scanKeys(prefix string, fn func(key string) error) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = []byte(prefix)
+	it := b.txn.NewIterator(opts)
+	defer it.Close()
 
-		prefix := []byte("album/")
-
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			item := it.Item()
-			val, err := item.ValueCopy(nil)
-			if err != nil {
-				return err
-			}
-
-			res = append(res, val)
+	for it.Rewind(); it.Valid(); it.Next() {
+		if err := fn(string(it.Item().Key())); err != nil {
+			return err
 		}
-		return nil
-	})
-
-	if err != nil {
-		return nil, err
 	}
-
-	return res, nil
+	return nil
 }
 
-func (db *DB) SetBaseGraph(albumID int64, data []byte) error {
-	key := fmt.Sprintf("graph/%d", albumID)
-
-	return db.runTxnReadWrite(func(txn *badger.Txn) error {
-		return txn.Set([]byte(key), data)
-	})
+type badgerBatchKV struct {
+	wb *badger.WriteBatch
 }
 
-func (db *DB) GetBaseGraph(albumID int64) ([]byte, error) {
-	key := fmt.Sprintf("graph/%d", albumID)
-
-	var res []byte
+func (b badgerBatchKV) set(key string, data []byte) error {
+	return b.wb.Set([]byte(key), data)
+}
 
-	err := db.runTxnReadOnly(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(key))
-		if errors.Is(err, badger.ErrKeyNotFound) {
-			return nil
-		}
-		if err != nil {
-			return err
-		}
+func (b badgerBatchKV) delete(key string) error {
+	return b.wb.Delete([]byte(key))
+}
 
-		val, err := item.ValueCopy(nil)
-		if err != nil {
-			return err
-		}
+type badgerEngine struct {
+	db *DB
+}
 
-		res = append(res, val...)
-		return nil
+func (e badgerEngine) update(fn func(kv kv) error) error {
+	return e.db.runTxnReadWrite(func(txn *badger.Txn) error {
+		return fn(badgerKV{txn: txn})
 	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	return res, nil
 }
 
-func (db *DB) SetPlaybackSession(data []byte) error {
-	key := "session/playback"
-
-	return db.runTxnReadWrite(func(txn *badger.Txn) error {
-		return txn.Set([]byte(key), data)
+func (e badgerEngine) view(fn func(kv kv) error) error {
+	return e.db.runTxnReadOnly(func(txn *badger.Txn) error {
+		return fn(badgerKV{txn: txn})
 	})
 }
 
-func (db *DB) GetPlaybackSession() ([]byte, error) {
-	key := "session/playback"
-
-	var res []byte
-
-	err := db.runTxnReadOnly(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(key))
-		if errors.Is(err, badger.ErrKeyNotFound) {
-			return nil
-		}
-		if err != nil {
-			return err
-		}
-
-		val, err := item.ValueCopy(nil)
-		if err != nil {
-			return err
-		}
-
-		res = append(res, val...)
-		return nil
-	})
+func (e badgerEngine) batch(fn func(w kvWriter) error) error {
+	wb := e.db.badger.NewWriteBatch()
+	defer wb.Cancel()
 
-	if err != nil {
-		return nil, err
+	if err := fn(badgerBatchKV{wb: wb}); err != nil {
+		return err
 	}
-
-	return res, nil
+	return wb.Flush()
 }
 
 const maxRetries = 3
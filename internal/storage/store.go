@@ -0,0 +1,629 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Tx is the set of entity operations available inside a transaction. Getters
+// return nil data without an error when the key does not exist. Play event
+// times are Unix nanoseconds; ranges include from and exclude to.
+type Tx interface {
+	SetSong(songID int64, data []byte) error
+	GetSong(id int64) ([]byte, error)
+	ListSongs() ([][]byte, error)
+	SetAlbum(albumID int64, data []byte) error
+	GetAlbum(id int64) ([]byte, error)
+	ListAlbums() ([][]byte, error)
+	SetBaseGraph(albumID int64, data []byte) error
+	GetBaseGraph(albumID int64) ([]byte, error)
+	// GetPlaybackSession and DeletePlaybackSession reach the single playback
+	// session kept before sessions were per album. It is only read to migrate
+	// it.
+	GetPlaybackSession() ([]byte, error)
+	DeletePlaybackSession() error
+	SetAlbumSession(albumID int64, data []byte) error
+	GetAlbumSession(albumID int64) ([]byte, error)
+	SetLibraryGraph(data []byte) error
+	GetLibraryGraph() ([]byte, error)
+	SetLibraryPenalties(data []byte) error
+	GetLibraryPenalties() ([]byte, error)
+	SetLibrarySession(data []byte) error
+	GetLibrarySession() ([]byte, error)
+	ListBaseGraphIDs() ([]int64, error)
+	SetProfile(name string, data []byte) error
+	GetProfile(name string) ([]byte, error)
+	ListProfiles() ([][]byte, error)
+	SetSyncState(data []byte) error
+	GetSyncState() ([]byte, error)
+	SetPlaylist(id int64, data []byte) error
+	GetPlaylist(id int64) ([]byte, error)
+	ListPlaylists() ([][]byte, error)
+	DeletePlaylist(id int64) error
+	SetRating(songID int64, data []byte) error
+	GetRating(songID int64) ([]byte, error)
+	ListRatings() ([][]byte, error)
+	DeleteRating(songID int64) error
+	AppendPlayEvent(at, songID int64, data []byte) error
+	ListPlayEvents(from, to int64) ([][]byte, error)
+	ListSongPlayEvents(songID, from, to int64) ([][]byte, error)
+	ListRecentPlayEvents(n int, from int64) ([][]byte, error)
+	CountPlayEvents() (map[int64]int, error)
+}
+
+// Batch is the write-only subset of Tx used for bulk loads.
+type Batch interface {
+	SetSong(songID int64, data []byte) error
+	SetAlbum(albumID int64, data []byte) error
+	SetBaseGraph(albumID int64, data []byte) error
+	SetAlbumSession(albumID int64, data []byte) error
+	SetLibraryGraph(data []byte) error
+	SetLibraryPenalties(data []byte) error
+	SetLibrarySession(data []byte) error
+	SetProfile(name string, data []byte) error
+	SetSyncState(data []byte) error
+	SetPlaylist(id int64, data []byte) error
+	SetRating(songID int64, data []byte) error
+	AppendPlayEvent(at, songID int64, data []byte) error
+}
+
+// Store is a storage backend. Every Tx method called on the store directly
+// runs in its own transaction; Update and View group several of them.
+// Update retries fn on conflicts, so fn must be safe to run more than once.
+// WriteBatch is meant for bulk imports: it is faster than Update but large
+// batches may be committed in several steps.
+//
+// Profile returns a view of the same backend in which the graphs, playback
+// sessions and play history belong to the named user, while songs, albums and
+// the profile registry stay shared. The view does not own the backend, so its
+// Shutdown does nothing.
+type Store interface {
+	Tx
+	Update(fn func(tx Tx) error) error
+	View(fn func(tx Tx) error) error
+	WriteBatch(fn func(b Batch) error) error
+	Profile(name string) (Store, error)
+	Shutdown() error
+}
+
+type BackendKind string
+
+const (
+	BackendBadger BackendKind = "badger"
+	BackendMemory BackendKind = "memory"
+	BackendJSON   BackendKind = "json"
+)
+
+func Open(kind BackendKind, path string, options Options) (Store, error) {
+	switch kind {
+	case "", BackendBadger:
+		if path == "" {
+			return nil, errors.New("empty db path")
+		}
+		return NewDBWithOptions(path, options)
+	case BackendMemory:
+		return NewMemoryDB(), nil
+	case BackendJSON:
+		if path == "" {
+			return nil, errors.New("empty db path")
+		}
+		return NewJSONFileDB(path)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", kind)
+	}
+}
+
+type kvWriter interface {
+	set(key string, data []byte) error
+	delete(key string) error
+}
+
+// kv is the raw key/value access a backend provides inside a transaction.
+type kv interface {
+	kvWriter
+	get(key string) ([]byte, error)
+	scan(prefix string, fn func(key string, val []byte) error) error
+	// scanFrom is scan starting at the first key not below start.
+	scanFrom(prefix, start string, fn func(key string, val []byte) error) error
+	// scanReverse is scan from the last key down.
+	scanReverse(prefix string, fn func(key string, val []byte) error) error
+	// scanKeys is scan without reading the values.
+	scanKeys(prefix string, fn func(key string) error) error
+}
+
+type engine interface {
+	update(fn func(kv kv) error) error
+	view(fn func(kv kv) error) error
+	batch(fn func(w kvWriter) error) error
+}
+
+func songKey(id int64) string {
+	return fmt.Sprintf("song/%d", id)
+}
+
+func albumKey(id int64) string {
+	return fmt.Sprintf("album/%d", id)
+}
+
+func graphKey(ns string, albumID int64) string {
+	return fmt.Sprintf("%sgraph/%d", ns, albumID)
+}
+
+func playbackKey(ns string) string {
+	return ns + "session/playback"
+}
+
+func albumSessionKey(ns string, albumID int64) string {
+	return fmt.Sprintf("%ssession/album/%d", ns, albumID)
+}
+
+func libraryGraphKey(ns string) string {
+	return ns + "graph/library"
+}
+
+func libraryPenaltiesKey(ns string) string {
+	return ns + "penalty/library"
+}
+
+func librarySessionKey(ns string) string {
+	return ns + "session/library"
+}
+
+func syncStateKey(ns string) string {
+	return ns + "sync/state"
+}
+
+func playlistKey(ns string, id int64) string {
+	return fmt.Sprintf("%splaylist/%d", ns, id)
+}
+
+func ratingKey(ns string, songID int64) string {
+	return fmt.Sprintf("%srating/%d", ns, songID)
+}
+
+func profileKey(name string) string {
+	return profilePrefix + name
+}
+
+// profileNamespace is the key prefix of a user's own data. The default
+// profile keeps the original unprefixed layout.
+func profileNamespace(name string) string {
+	if name == "" {
+		return ""
+	}
+	return "user/" + name + "/"
+}
+
+func ValidateProfileName(name string) error {
+	if name == "" {
+		return errors.New("empty profile name")
+	}
+	if strings.ContainsAny(name, "/\x00") {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	return nil
+}
+
+const (
+	songPrefix    = "song/"
+	albumPrefix   = "album/"
+	profilePrefix = "profile/"
+)
+
+func scanValues(kv kv, prefix string) ([][]byte, error) {
+	var res [][]byte
+	err := kv.scan(prefix, func(_ string, val []byte) error {
+		res = append(res, val)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+type writer struct {
+	w  kvWriter
+	ns string
+}
+
+func (w writer) SetSong(songID int64, data []byte) error {
+	return w.w.set(songKey(songID), data)
+}
+
+func (w writer) SetAlbum(albumID int64, data []byte) error {
+	return w.w.set(albumKey(albumID), data)
+}
+
+func (w writer) SetBaseGraph(albumID int64, data []byte) error {
+	return w.w.set(graphKey(w.ns, albumID), data)
+}
+
+func (w writer) SetAlbumSession(albumID int64, data []byte) error {
+	return w.w.set(albumSessionKey(w.ns, albumID), data)
+}
+
+func (w writer) SetLibraryGraph(data []byte) error {
+	return w.w.set(libraryGraphKey(w.ns), data)
+}
+
+func (w writer) SetLibraryPenalties(data []byte) error {
+	return w.w.set(libraryPenaltiesKey(w.ns), data)
+}
+
+func (w writer) SetLibrarySession(data []byte) error {
+	return w.w.set(librarySessionKey(w.ns), data)
+}
+
+func (w writer) SetProfile(name string, data []byte) error {
+	if err := ValidateProfileName(name); err != nil {
+		return err
+	}
+	return w.w.set(profileKey(name), data)
+}
+
+type txn struct {
+	writer
+	kv kv
+}
+
+func newTxn(kv kv, ns string) txn {
+	return txn{writer: writer{w: kv, ns: ns}, kv: kv}
+}
+
+func (t txn) GetSong(id int64) ([]byte, error) {
+	return t.kv.get(songKey(id))
+}
+
+func (t txn) ListSongs() ([][]byte, error) {
+	return scanValues(t.kv, songPrefix)
+}
+
+func (t txn) GetAlbum(id int64) ([]byte, error) {
+	return t.kv.get(albumKey(id))
+}
+
+func (t txn) ListAlbums() ([][]byte, error) {
+	return scanValues(t.kv, albumPrefix)
+}
+
+func (t txn) GetBaseGraph(albumID int64) ([]byte, error) {
+	return t.kv.get(graphKey(t.ns, albumID))
+}
+
+func (t txn) GetPlaybackSession() ([]byte, error) {
+	return t.kv.get(playbackKey(t.ns))
+}
+
+func (t txn) DeletePlaybackSession() error {
+	return t.kv.delete(playbackKey(t.ns))
+}
+
+func (t txn) GetAlbumSession(albumID int64) ([]byte, error) {
+	return t.kv.get(albumSessionKey(t.ns, albumID))
+}
+
+func (t txn) GetLibraryGraph() ([]byte, error) {
+	return t.kv.get(libraryGraphKey(t.ns))
+}
+
+func (t txn) GetLibraryPenalties() ([]byte, error) {
+	return t.kv.get(libraryPenaltiesKey(t.ns))
+}
+
+func (t txn) GetLibrarySession() ([]byte, error) {
+	return t.kv.get(librarySessionKey(t.ns))
+}
+
+func (t txn) ListBaseGraphIDs() ([]int64, error) {
+	prefix := t.ns + "graph/"
+	var ids []int64
+	err := t.kv.scan(prefix, func(key string, _ []byte) error {
+		id, err := strconv.ParseInt(strings.TrimPrefix(key, prefix), 10, 64)
+		if err != nil {
+			return nil
+		}
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (w writer) SetSyncState(data []byte) error {
+	return w.w.set(syncStateKey(w.ns), data)
+}
+
+func (t txn) GetSyncState() ([]byte, error) {
+	return t.kv.get(syncStateKey(t.ns))
+}
+
+func (w writer) SetPlaylist(id int64, data []byte) error {
+	return w.w.set(playlistKey(w.ns, id), data)
+}
+
+func (t txn) GetPlaylist(id int64) ([]byte, error) {
+	return t.kv.get(playlistKey(t.ns, id))
+}
+
+func (t txn) ListPlaylists() ([][]byte, error) {
+	return scanValues(t.kv, t.ns+"playlist/")
+}
+
+func (t txn) DeletePlaylist(id int64) error {
+	return t.kv.delete(playlistKey(t.ns, id))
+}
+
+func (w writer) SetRating(songID int64, data []byte) error {
+	return w.w.set(ratingKey(w.ns, songID), data)
+}
+
+func (t txn) GetRating(songID int64) ([]byte, error) {
+	return t.kv.get(ratingKey(t.ns, songID))
+}
+
+func (t txn) ListRatings() ([][]byte, error) {
+	return scanValues(t.kv, t.ns+"rating/")
+}
+
+func (t txn) DeleteRating(songID int64) error {
+	return t.kv.delete(ratingKey(t.ns, songID))
+}
+
+func (t txn) GetProfile(name string) ([]byte, error) {
+	return t.kv.get(profileKey(name))
+}
+
+func (t txn) ListProfiles() ([][]byte, error) {
+	return scanValues(t.kv, profilePrefix)
+}
+
+// entities implements the Store operations on top of an engine so that every
+// backend shares the same key layout.
+type entities struct {
+	engine engine
+	ns     string
+}
+
+func (e entities) Update(fn func(tx Tx) error) error {
+	return e.engine.update(func(kv kv) error {
+		return fn(newTxn(kv, e.ns))
+	})
+}
+
+func (e entities) View(fn func(tx Tx) error) error {
+	return e.engine.view(func(kv kv) error {
+		return fn(newTxn(kv, e.ns))
+	})
+}
+
+func (e entities) WriteBatch(fn func(b Batch) error) error {
+	return e.engine.batch(func(w kvWriter) error {
+		return fn(writer{w: w, ns: e.ns})
+	})
+}
+
+func (e entities) Profile(name string) (Store, error) {
+	if err := ValidateProfileName(name); err != nil {
+		return nil, err
+	}
+	return profileStore{entities{engine: e.engine, ns: profileNamespace(name)}}, nil
+}
+
+type profileStore struct {
+	entities
+}
+
+func (p profileStore) Shutdown() error {
+	return nil
+}
+
+func viewResult[T any](e entities, fn func(tx Tx) (T, error)) (T, error) {
+	var res T
+	err := e.View(func(tx Tx) error {
+		var err error
+		res, err = fn(tx)
+		return err
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return res, nil
+}
+
+func (e entities) SetSong(songID int64, data []byte) error {
+	return e.Update(func(tx Tx) error {
+		return tx.SetSong(songID, data)
+	})
+}
+
+func (e entities) GetSong(id int64) ([]byte, error) {
+	return viewResult(e, func(tx Tx) ([]byte, error) {
+		return tx.GetSong(id)
+	})
+}
+
+func (e entities) ListSongs() ([][]byte, error) {
+	return viewResult(e, func(tx Tx) ([][]byte, error) {
+		return tx.ListSongs()
+	})
+}
+
+func (e entities) SetAlbum(albumID int64, data []byte) error {
+	return e.Update(func(tx Tx) error {
+		return tx.SetAlbum(albumID, data)
+	})
+}
+
+func (e entities) GetAlbum(id int64) ([]byte, error) {
+	return viewResult(e, func(tx Tx) ([]byte, error) {
+		return tx.GetAlbum(id)
+	})
+}
+
+func (e entities) ListAlbums() ([][]byte, error) {
+	return viewResult(e, func(tx Tx) ([][]byte, error) {
+		return tx.ListAlbums()
+	})
+}
+
+func (e entities) SetBaseGraph(albumID int64, data []byte) error {
+	return e.Update(func(tx Tx) error {
+		return tx.SetBaseGraph(albumID, data)
+	})
+}
+
+func (e entities) GetBaseGraph(albumID int64) ([]byte, error) {
+	return viewResult(e, func(tx Tx) ([]byte, error) {
+		return tx.GetBaseGraph(albumID)
+	})
+}
+
+func (e entities) GetPlaybackSession() ([]byte, error) {
+	return viewResult(e, func(tx Tx) ([]byte, error) {
+		return tx.GetPlaybackSession()
+	})
+}
+
+func (e entities) DeletePlaybackSession() error {
+	return e.Update(func(tx Tx) error {
+		return tx.DeletePlaybackSession()
+	})
+}
+
+func (e entities) ListBaseGraphIDs() ([]int64, error) {
+	return viewResult(e, func(tx Tx) ([]int64, error) {
+		return tx.ListBaseGraphIDs()
+	})
+}
+
+func (e entities) SetProfile(name string, data []byte) error {
+	return e.Update(func(tx Tx) error {
+		return tx.SetProfile(name, data)
+	})
+}
+
+func (e entities) GetProfile(name string) ([]byte, error) {
+	return viewResult(e, func(tx Tx) ([]byte, error) {
+		return tx.GetProfile(name)
+	})
+}
+
+func (e entities) ListProfiles() ([][]byte, error) {
+	return viewResult(e, func(tx Tx) ([][]byte, error) {
+		return tx.ListProfiles()
+	})
+}
+
+func (e entities) SetAlbumSession(albumID int64, data []byte) error {
+	return e.Update(func(tx Tx) error {
+		return tx.SetAlbumSession(albumID, data)
+	})
+}
+
+func (e entities) GetAlbumSession(albumID int64) ([]byte, error) {
+	return viewResult(e, func(tx Tx) ([]byte, error) {
+		return tx.GetAlbumSession(albumID)
+	})
+}
+
+func (e entities) SetLibraryGraph(data []byte) error {
+	return e.Update(func(tx Tx) error {
+		return tx.SetLibraryGraph(data)
+	})
+}
+
+func (e entities) GetLibraryGraph() ([]byte, error) {
+	return viewResult(e, func(tx Tx) ([]byte, error) {
+		return tx.GetLibraryGraph()
+	})
+}
+
+func (e entities) SetLibraryPenalties(data []byte) error {
+	return e.Update(func(tx Tx) error {
+		return tx.SetLibraryPenalties(data)
+	})
+}
+
+func (e entities) GetLibraryPenalties() ([]byte, error) {
+	return viewResult(e, func(tx Tx) ([]byte, error) {
+		return tx.GetLibraryPenalties()
+	})
+}
+
+func (e entities) SetLibrarySession(data []byte) error {
+	return e.Update(func(tx Tx) error {
+		return tx.SetLibrarySession(data)
+	})
+}
+
+func (e entities) GetLibrarySession() ([]byte, error) {
+	return viewResult(e, func(tx Tx) ([]byte, error) {
+		return tx.GetLibrarySession()
+	})
+}
+
+func (e entities) SetSyncState(data []byte) error {
+	return e.Update(func(tx Tx) error {
+		return tx.SetSyncState(data)
+	})
+}
+
+func (e entities) GetSyncState() ([]byte, error) {
+	return viewResult(e, func(tx Tx) ([]byte, error) {
+		return tx.GetSyncState()
+	})
+}
+
+func (e entities) SetPlaylist(id int64, data []byte) error {
+	return e.Update(func(tx Tx) error {
+		return tx.SetPlaylist(id, data)
+	})
+}
+
+func (e entities) GetPlaylist(id int64) ([]byte, error) {
+	return viewResult(e, func(tx Tx) ([]byte, error) {
+		return tx.GetPlaylist(id)
+	})
+}
+
+func (e entities) ListPlaylists() ([][]byte, error) {
+	return viewResult(e, func(tx Tx) ([][]byte, error) {
+		return tx.ListPlaylists()
+	})
+}
+
+func (e entities) DeletePlaylist(id int64) error {
+	return e.Update(func(tx Tx) error {
+		return tx.DeletePlaylist(id)
+	})
+}
+
+func (e entities) SetRating(songID int64, data []byte) error {
+	return e.Update(func(tx Tx) error {
+		return tx.SetRating(songID, data)
+	})
+}
+
+func (e entities) GetRating(songID int64) ([]byte, error) {
+	return viewResult(e, func(tx Tx) ([]byte, error) {
+		return tx.GetRating(songID)
+	})
+}
+
+func (e entities) ListRatings() ([][]byte, error) {
+	return viewResult(e, func(tx Tx) ([][]byte, error) {
+		return tx.ListRatings()
+	})
+}
+
+func (e entities) DeleteRating(songID int64) error {
+	return e.Update(func(tx Tx) error {
+		return tx.DeleteRating(songID)
+	})
+}
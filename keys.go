@@ -0,0 +1,60 @@
+package main
+
+import (
+	"GO_player/internal/storage"
+	"errors"
+	"flag"
+	"os"
+)
+
+type keyFlags struct {
+	keyFile       string
+	passphraseEnv string
+}
+
+func (k *keyFlags) register(fs *flag.FlagSet, prefix string) {
+	fs.StringVar(&k.keyFile, prefix+"key-file", "", "file holding the encryption key (raw or hex)")
+	fs.StringVar(&k.passphraseEnv, prefix+"passphrase-env", "", "environment variable holding the passphrase")
+}
+
+// load returns nil when neither a key file nor a passphrase was given.
+func (k *keyFlags) load(dbPath string) ([]byte, error) {
+	if k.keyFile != "" && k.passphraseEnv != "" {
+		return nil, errors.New("use either a key file or a passphrase, not both")
+	}
+	if k.keyFile != "" {
+		return storage.LoadKeyFile(k.keyFile)
+	}
+	if k.passphraseEnv != "" {
+		passphrase := os.Getenv(k.passphraseEnv)
+		if passphrase == "" {
+			return nil, errors.New("passphrase variable " + k.passphraseEnv + " is empty")
+		}
+		return storage.KeyFromPassphrase(dbPath, passphrase)
+	}
+	return nil, nil
+}
+
+func runRotateKey(args []string) error {
+	fs := flag.NewFlagSet("rotate-key", flag.ContinueOnError)
+	dbPath := fs.String("db", "", "database directory")
+	var oldKey, newKey keyFlags
+	oldKey.register(fs, "old-")
+	newKey.register(fs, "new-")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dbPath == "" {
+		return errors.New("-db is required")
+	}
+
+	from, err := oldKey.load(*dbPath)
+	if err != nil {
+		return err
+	}
+	to, err := newKey.load(*dbPath)
+	if err != nil {
+		return err
+	}
+	return storage.RotateEncryptionKey(*dbPath, from, to)
+}
@@ -1,6 +1,57 @@
 package main
 
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{name: "rotate-key", summary: "re-encrypt the database with a new key", run: runRotateKey},
+	{name: "import-history", summary: "seed the graphs from a Last.fm, ListenBrainz or Spotify export", run: runImportHistory},
+	{name: "stats", summary: "print listening statistics", run: runStats},
+	{name: "export", summary: "write a profile's songs, graphs, sessions and history to a bundle", run: runExport},
+	{name: "import", summary: "load a bundle into a profile", run: runImport},
+	{name: "analyze", summary: "measure the loudness and audio features of new and changed songs", run: runAnalyze},
+	{name: "play", summary: "play an album or the library through the audio engine", run: runPlay},
+	{name: "plan", summary: "plan a playlist ahead of time and export or queue it", run: runPlan},
+	{name: "import-playlist", summary: "store M3U8, PLS or XSPF playlists and optionally seed the graphs", run: runImportPlaylist},
+	{name: "export-playlist", summary: "write a stored playlist as M3U8, PLS or XSPF", run: runExportPlaylist},
+	{name: "playlists", summary: "list or delete the stored playlists", run: runPlaylists},
+	{name: "ratings", summary: "ban, pin or list songs the player should avoid or favour", run: runRatings},
+}
+
 func main() {
-	// MVP skeleton.
-	// Entry point will be implemented in later stages (simulator).
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != os.Args[1] {
+			continue
+		}
+		if err := cmd.run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: GO_player <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", cmd.name, cmd.summary)
+	}
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"GO_player/internal/app"
+	"GO_player/internal/models"
+	"GO_player/internal/planner"
+	"GO_player/internal/playlist"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+func runPlan(args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	var store storeFlags
+	store.register(fs)
+	albumID := fs.Int64("album", 0, "album to plan from")
+	radio := fs.Bool("radio", false, "plan across the whole library")
+	count := fs.Int("count", 0, "number of songs to plan")
+	duration := fs.Duration("duration", 0, "how long the playlist should last, e.g. 2h")
+	beam := fs.Int("beam", 0, "partial playlists kept at each step (default 8)")
+	out := fs.String("out", "", "write the playlist to this file instead of standard output")
+	format := fs.String("format", "", "m3u8, pls or xspf (default from -out, else m3u8)")
+	save := fs.String("save", "", "also store the playlist in the catalog under this name")
+	enqueue := fs.Bool("enqueue", false, "also add the playlist to the play queue")
+	constraints := registerConstraints(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *count <= 0 && *duration <= 0 {
+		return errors.New("-count or -duration is required")
+	}
+
+	cat, db, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer db.Shutdown()
+
+	a, err := app.NewAppWithStore(db, app.Options{
+		AlbumID:     *albumID,
+		Profile:     store.profile,
+		Radio:       *radio,
+		Constraints: *constraints,
+	})
+	if err != nil {
+		return err
+	}
+	defer a.Shutdown()
+
+	plan, err := a.Plan(planner.Options{Count: *count, Duration: *duration, BeamWidth: *beam})
+	if err != nil {
+		return err
+	}
+	songs := make([]*models.Song, 0, len(plan.SongIDs))
+	for _, id := range plan.SongIDs {
+		song, err := cat.LoadSong(id)
+		if err != nil {
+			return err
+		}
+		song.ID = id
+		songs = append(songs, song)
+	}
+
+	if err := writePlaylist(*out, playlist.Format(*format), *save, songs); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "planned %d songs, %s\n", len(plan.SongIDs), plan.Duration.Round(time.Second))
+
+	if *save != "" {
+		p, err := a.SavePlaylist(*save, plan.SongIDs)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "saved as playlist %d\n", p.ID)
+	}
+
+	if *enqueue {
+		return a.EnqueuePlan(plan)
+	}
+	return nil
+}
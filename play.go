@@ -0,0 +1,129 @@
+package main
+
+import (
+	"GO_player/internal/app"
+	"GO_player/internal/audio"
+	"GO_player/internal/loudness"
+	"GO_player/internal/memory/feedback"
+	"GO_player/internal/memory/selector"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+)
+
+func runPlay(args []string) error {
+	fs := flag.NewFlagSet("play", flag.ContinueOnError)
+	var store storeFlags
+	store.register(fs)
+	albumID := fs.Int64("album", 0, "album to play")
+	radio := fs.Bool("radio", false, "play across the whole library")
+	out := fs.String("out", "", "write the audio to this WAV file instead of discarding it")
+	realtime := fs.Bool("realtime", false, "take as long as the songs last when discarding the audio")
+	count := fs.Int("count", 0, "stop after this many songs (0 plays until the graph runs out)")
+	gain := fs.String("gain", string(loudness.ModeTrack), "loudness normalization: off, track or album")
+	target := fs.Float64("target", loudness.DefaultTarget, "loudness target in LUFS")
+	crossfade := fs.Duration("crossfade", 0, "overlap between songs for albums without their own setting (0 is gapless)")
+	explore := fs.String("explore", string(selector.ExploreOff), "exploration of rarely played songs: off, epsilon or ucb")
+	epsilon := fs.Float64("epsilon", 0, "chance that a pick explores in epsilon mode (default 0.05)")
+	policy := fs.String("feedback", "thresholds", "how plays are learned from: thresholds or curve")
+	constraints := registerConstraints(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	mode, err := loudness.ParseMode(*gain)
+	if err != nil {
+		return err
+	}
+	exploreMode, err := selector.ParseExploreMode(*explore)
+	if err != nil {
+		return err
+	}
+	feedbackPolicy, err := feedback.ParsePolicy(*policy)
+	if err != nil {
+		return err
+	}
+
+	_, db, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer db.Shutdown()
+
+	a, err := app.NewAppWithStore(db, app.Options{
+		AlbumID:     *albumID,
+		Profile:     store.profile,
+		Radio:       *radio,
+		Explore:     selector.ExploreOptions{Mode: exploreMode, Epsilon: *epsilon},
+		Constraints: *constraints,
+		Feedback:    feedbackPolicy,
+	})
+	if err != nil {
+		return err
+	}
+	defer a.Shutdown()
+
+	var output audio.Output = &audio.NullOutput{Realtime: *realtime}
+	if *out != "" {
+		if output, err = audio.CreateWAV(*out); err != nil {
+			return err
+		}
+	}
+
+	ended := make(chan audio.Track)
+	engine := a.NewEngine(output, audio.Options{
+		Crossfade:  *crossfade,
+		GainFor:    a.LoudnessGain(mode, *target),
+		OnTrackEnd: func(t audio.Track) { ended <- t },
+	})
+	if err := engine.Play(); err != nil {
+		return err
+	}
+	stopped := make(chan struct{})
+	go func() {
+		engine.Wait()
+		close(stopped)
+	}()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	played := 0
+loop:
+	for *count <= 0 || played < *count {
+		select {
+		case t := <-ended:
+			played++
+			fmt.Printf("%d\t%.1fs/%.1fs\n", t.SongID, t.Listened.Seconds(), t.Duration.Seconds())
+		case <-stopped:
+			break loop
+		case <-interrupt:
+			break loop
+		}
+	}
+
+	// Drain track ends so the playback goroutine is not left blocked in the
+	// callback while the engine closes.
+	go func() {
+		for range ended {
+		}
+	}()
+	err = engine.Close()
+	close(ended)
+	if serr := a.Save(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// registerConstraints adds the flags of the anti-repetition constraints.
+func registerConstraints(fs *flag.FlagSet) *selector.Constraints {
+	var c selector.Constraints
+	fs.IntVar(&c.RepeatPlays, "no-repeat", 0, "do not repeat a song within this many plays")
+	fs.DurationVar(&c.RepeatWindow, "no-repeat-for", 0, "do not repeat a song within this time")
+	fs.IntVar(&c.ArtistGap, "artist-gap", 0, "songs to play between two of the same artist")
+	fs.IntVar(&c.AlbumGap, "album-gap", 0, "songs to play between two of the same album in radio mode")
+	fs.Float64Var(&c.GenreShare, "genre-share", 0, "largest share of one genre in the last 10 plays, 0 to 1")
+	return &c
+}
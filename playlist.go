@@ -0,0 +1,177 @@
+package main
+
+import (
+	"GO_player/internal/models"
+	"GO_player/internal/playlist"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func runImportPlaylist(args []string) error {
+	fs := flag.NewFlagSet("import-playlist", flag.ContinueOnError)
+	var store storeFlags
+	store.register(fs)
+	name := fs.String("name", "", "playlist name (default the name in the file, or the file name)")
+	format := fs.String("format", "", "m3u8, pls or xspf (default from the file extension)")
+	seed := fs.Bool("seed", false, "reinforce the transitions between consecutive songs in the graphs")
+	weight := fs.Float64("seed-weight", 0, "how much each transition is reinforced (default 1)")
+	fs.Usage = func() {
+		fs.Output().Write([]byte("usage: GO_player import-playlist -db PATH [flags] FILE...\n"))
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("no playlist files given")
+	}
+	if *name != "" && fs.NArg() > 1 {
+		return errors.New("-name needs a single playlist file")
+	}
+
+	files := make([]*playlist.File, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		file, err := readPlaylist(path, playlist.Format(*format))
+		if err != nil {
+			return err
+		}
+		if file.Name == "" {
+			file.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		files = append(files, file)
+	}
+
+	cat, db, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer db.Shutdown()
+
+	results := make([]*playlist.ImportResult, 0, len(files))
+	for i, file := range files {
+		res, err := playlist.Import(cat, file, playlist.ImportOptions{
+			Name:       *name,
+			Dir:        filepath.Dir(fs.Arg(i)),
+			Seed:       *seed,
+			SeedWeight: *weight,
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", fs.Arg(i), err)
+		}
+		results = append(results, res)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+func readPlaylist(path string, format playlist.Format) (*playlist.File, error) {
+	if format == "" {
+		var err error
+		if format, err = playlist.FormatOf(path); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	file, err := playlist.Parse(format, f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return file, nil
+}
+
+func runExportPlaylist(args []string) error {
+	fs := flag.NewFlagSet("export-playlist", flag.ContinueOnError)
+	var store storeFlags
+	store.register(fs)
+	id := fs.Int64("id", 0, "playlist to export")
+	format := fs.String("format", "", "m3u8, pls or xspf (default from -out, else m3u8)")
+	out := fs.String("out", "", "file to write instead of standard output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *id <= 0 {
+		return errors.New("-id is required")
+	}
+
+	cat, db, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer db.Shutdown()
+
+	p, err := cat.LoadPlaylist(*id)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return fmt.Errorf("no playlist %d", *id)
+	}
+	songs, err := playlist.Songs(cat, p)
+	if err != nil {
+		return err
+	}
+	return writePlaylist(*out, playlist.Format(*format), p.Name, songs)
+}
+
+// writePlaylist writes to path, or to standard output when it is empty. The
+// format defaults to the one of the extension of path, then to M3U8.
+func writePlaylist(path string, format playlist.Format, name string, songs []*models.Song) error {
+	if format == "" {
+		format = playlist.FormatM3U8
+		if path != "" {
+			if f, err := playlist.FormatOf(path); err == nil {
+				format = f
+			}
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return playlist.Write(w, format, name, songs)
+}
+
+func runPlaylists(args []string) error {
+	fs := flag.NewFlagSet("playlists", flag.ContinueOnError)
+	var store storeFlags
+	store.register(fs)
+	del := fs.Int64("delete", 0, "delete this playlist instead of listing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cat, db, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer db.Shutdown()
+
+	if *del > 0 {
+		return cat.DeletePlaylist(*del)
+	}
+	playlists, err := cat.ListPlaylists()
+	if err != nil {
+		return err
+	}
+	for _, p := range playlists {
+		fmt.Printf("%d\t%d songs\t%s\n", p.ID, len(p.SongIDs), p.Name)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"GO_player/internal/models"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+func runRatings(args []string) error {
+	fs := flag.NewFlagSet("ratings", flag.ContinueOnError)
+	var store storeFlags
+	store.register(fs)
+	ban := fs.Int64("ban", 0, "song never to pick again")
+	unban := fs.Int64("unban", 0, "song to lift the ban of")
+	pin := fs.Int64("pin", 0, "song that is always welcome")
+	unpin := fs.Int64("unpin", 0, "song to unpin")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var songID int64
+	var change func(r *models.Rating)
+	set := 0
+	for _, c := range []struct {
+		id     int64
+		change func(r *models.Rating)
+	}{
+		{*ban, func(r *models.Rating) { r.Banned, r.Pinned = true, false }},
+		{*unban, func(r *models.Rating) { r.Banned = false }},
+		{*pin, func(r *models.Rating) { r.Pinned, r.Banned = true, false }},
+		{*unpin, func(r *models.Rating) { r.Pinned = false }},
+	} {
+		if c.id != 0 {
+			songID, change = c.id, c.change
+			set++
+		}
+	}
+	if set > 1 {
+		return errors.New("only one of -ban, -unban, -pin and -unpin at a time")
+	}
+
+	cat, db, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer db.Shutdown()
+
+	if change != nil {
+		if songID < 0 {
+			return errors.New("invalid song id")
+		}
+		rating, err := cat.LoadRating(songID)
+		if err != nil {
+			return err
+		}
+		if rating == nil {
+			rating = &models.Rating{SongID: songID}
+		}
+		change(rating)
+		rating.UpdatedAt = time.Now().UTC()
+		return cat.SaveRating(rating)
+	}
+
+	ratings, err := cat.ListRatings()
+	if err != nil {
+		return err
+	}
+	for _, r := range ratings {
+		state := "pinned"
+		if r.Banned {
+			state = "banned"
+		}
+		song, err := cat.LoadSong(r.SongID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d\t%s\t%s - %s\n", r.SongID, state, song.Artist, song.Title)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"GO_player/internal/stats"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	var store storeFlags
+	store.register(fs)
+	from := fs.String("from", "", "first day of the period (YYYY-MM-DD)")
+	to := fs.String("to", "", "last day of the period (YYYY-MM-DD)")
+	top := fs.Int("top", 10, "length of the top lists")
+	format := fs.String("format", "text", "output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	opts := stats.Options{Top: *top, Location: time.Local}
+	var err error
+	if opts.From, err = parseDay(*from); err != nil {
+		return err
+	}
+	if opts.To, err = parseDay(*to); err != nil {
+		return err
+	}
+	if !opts.To.IsZero() {
+		opts.To = opts.To.AddDate(0, 0, 1)
+	}
+
+	cat, db, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer db.Shutdown()
+
+	report, err := stats.Load(cat, opts)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		return report.WriteJSON(os.Stdout)
+	}
+	return report.WriteText(os.Stdout)
+}
+
+func parseDay(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation(time.DateOnly, s, time.Local)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"GO_player/internal/catalog"
+	"GO_player/internal/storage"
+	"errors"
+	"flag"
+)
+
+// storeFlags are the flags shared by the commands that open the database.
+type storeFlags struct {
+	path    string
+	backend string
+	profile string
+	key     keyFlags
+}
+
+func (s *storeFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&s.path, "db", "", "database path")
+	fs.StringVar(&s.backend, "backend", string(storage.BackendBadger), "storage backend: badger or json")
+	fs.StringVar(&s.profile, "profile", "", "user profile")
+	s.key.register(fs, "")
+}
+
+// open returns the catalog of the selected profile and the store behind it,
+// which the caller shuts down.
+func (s *storeFlags) open() (catalog.Catalog, storage.Store, error) {
+	if s.path == "" {
+		return nil, nil, errors.New("-db is required")
+	}
+	key, err := s.key.load(s.path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	db, err := storage.Open(storage.BackendKind(s.backend), s.path, storage.Options{EncryptionKey: key})
+	if err != nil {
+		return nil, nil, err
+	}
+	cat, err := catalog.NewProfileCatalog(db, s.profile)
+	if err != nil {
+		_ = db.Shutdown()
+		return nil, nil, err
+	}
+	return cat, db, nil
+}